@@ -0,0 +1,169 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/shiponcs/femProject/internal/auth"
+	"github.com/shiponcs/femProject/internal/middleware"
+	"github.com/shiponcs/femProject/internal/store"
+	"github.com/shiponcs/femProject/utils"
+)
+
+// AdminHandler serves the user management endpoints, routed behind the
+// policy.ManageUsers permission.
+type AdminHandler struct {
+	userStore    store.UserStore
+	tokenStore   store.TokenStore
+	accessTokens auth.AccessTokens
+	loginLimiter *auth.LoginLimiter
+	logger       *slog.Logger
+}
+
+func NewAdminHandler(userStore store.UserStore, tokenStore store.TokenStore, accessTokens auth.AccessTokens, loginLimiter *auth.LoginLimiter, logger *slog.Logger) *AdminHandler {
+	return &AdminHandler{
+		userStore:    userStore,
+		tokenStore:   tokenStore,
+		accessTokens: accessTokens,
+		loginLimiter: loginLimiter,
+		logger:       logger,
+	}
+}
+
+func (h *AdminHandler) HandleListUsers(w http.ResponseWriter, r *http.Request) {
+	users, err := h.userStore.ListUsers(r.Context())
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "ListUsers", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"users": users})
+}
+
+// readOtherUserID reads the user id of the route, admins can't manage their
+// own account through these endpoints so they can't lock themselves out.
+func (h *AdminHandler) readOtherUserID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	userID, err := utils.ReadParam(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid user id"})
+		return 0, false
+	}
+
+	if int(userID) == middleware.GetUser(r).ID {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "you can't change your own account here"})
+		return 0, false
+	}
+	return int(userID), true
+}
+
+// HandleUpdateRole logs the user out everywhere so the tokens they get next
+// carry the new role.
+func (h *AdminHandler) HandleUpdateRole(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.readOtherUserID(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Role string `json:"role"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request payload"})
+		return
+	}
+
+	err = h.userStore.UpdateRole(r.Context(), userID, req.Role)
+	if errors.Is(err, store.ErrUnknownRole) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "user not found"})
+		return
+	}
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "UpdateRole", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	err = logOutEverywhere(r.Context(), h.tokenStore, h.accessTokens, userID)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "logOutEverywhere", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	user, err := h.userStore.GetUserByID(r.Context(), userID)
+	if err != nil || user == nil {
+		h.logger.ErrorContext(r.Context(), "GetUserByID", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"user": user})
+}
+
+func (h *AdminHandler) HandleDeleteUser(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.readOtherUserID(w, r)
+	if !ok {
+		return
+	}
+
+	// sessions have to be revoked before their tokens cascade away with the
+	// user
+	err := logOutEverywhere(r.Context(), h.tokenStore, h.accessTokens, userID)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "logOutEverywhere", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	err = h.userStore.DeleteUser(r.Context(), userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "user not found"})
+		return
+	}
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "DeleteUser", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleUnlockUser lifts the login lockout of a user after too many failed
+// attempts. Lockouts of client IPs expire on their own.
+func (h *AdminHandler) HandleUnlockUser(w http.ResponseWriter, r *http.Request) {
+	userID, err := utils.ReadParam(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid user id"})
+		return
+	}
+
+	user, err := h.userStore.GetUserByID(r.Context(), int(userID))
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "GetUserByID", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	if user == nil {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "user not found"})
+		return
+	}
+
+	err = h.loginLimiter.Unlock(r.Context(), user.Username)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "Unlock", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
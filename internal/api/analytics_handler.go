@@ -0,0 +1,135 @@
+package api
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/shiponcs/femProject/internal/middleware"
+	"github.com/shiponcs/femProject/internal/store"
+	"github.com/shiponcs/femProject/utils"
+)
+
+// defaultAnalyticsDays is how far back analytics look without a from date.
+const defaultAnalyticsDays = 12 * 7
+
+type AnalyticsHandler struct {
+	analyticsStore store.AnalyticsStore
+	logger         *slog.Logger
+}
+
+func NewAnalyticsHandler(analyticsStore store.AnalyticsStore, logger *slog.Logger) *AnalyticsHandler {
+	return &AnalyticsHandler{
+		analyticsStore: analyticsStore,
+		logger:         logger,
+	}
+}
+
+// readAnalyticsRange reads from and to (YYYY-MM-DD, inclusive), bucket
+// (day, week or month) and tz. It defaults to the last twelve weeks up to
+// today in UTC, bucketed by defaultBucket.
+func (h *AnalyticsHandler) readAnalyticsRange(r *http.Request, defaultBucket string) (store.AnalyticsRange, error) {
+	query := r.URL.Query()
+	analyticsRange := store.AnalyticsRange{
+		UserID: middleware.GetUser(r).ID,
+		Bucket: query.Get("bucket"),
+	}
+	if analyticsRange.Bucket == "" {
+		analyticsRange.Bucket = defaultBucket
+	}
+
+	loc, err := readLocation(r)
+	if err != nil {
+		return analyticsRange, err
+	}
+	analyticsRange.Timezone = loc.String()
+
+	analyticsRange.To = today(loc)
+	if query.Get("to") != "" {
+		analyticsRange.To, err = parseDate(query.Get("to"))
+		if err != nil {
+			return analyticsRange, errors.New("to must be formatted as YYYY-MM-DD")
+		}
+	}
+
+	analyticsRange.From = analyticsRange.To.AddDate(0, 0, -defaultAnalyticsDays)
+	if query.Get("from") != "" {
+		analyticsRange.From, err = parseDate(query.Get("from"))
+		if err != nil {
+			return analyticsRange, errors.New("from must be formatted as YYYY-MM-DD")
+		}
+	}
+
+	if analyticsRange.From.After(analyticsRange.To) {
+		return analyticsRange, errors.New("from can't be after to")
+	}
+	if analyticsRange.To.Sub(analyticsRange.From) > 5*366*24*time.Hour {
+		return analyticsRange, errors.New("the range can't span more than five years")
+	}
+
+	return analyticsRange, nil
+}
+
+func (h *AnalyticsHandler) writeStoreError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, store.ErrInvalidBucket) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+	h.logger.ErrorContext(r.Context(), "analytics", "error", err)
+	utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+}
+
+func (h *AnalyticsHandler) HandleGetTotals(w http.ResponseWriter, r *http.Request) {
+	analyticsRange, err := h.readAnalyticsRange(r, "week")
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	totals, err := h.analyticsStore.Totals(analyticsRange)
+	if err != nil {
+		h.writeStoreError(w, r, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"totals": totals})
+}
+
+func (h *AnalyticsHandler) HandleGetExerciseProgression(w http.ResponseWriter, r *http.Request) {
+	exerciseID, err := utils.ReadParam(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid exercise id"})
+		return
+	}
+
+	analyticsRange, err := h.readAnalyticsRange(r, "week")
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	progression, err := h.analyticsStore.ExerciseProgression(analyticsRange, exerciseID)
+	if err != nil {
+		h.writeStoreError(w, r, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"progression": progression})
+}
+
+func (h *AnalyticsHandler) HandleGetMuscleGroupVolume(w http.ResponseWriter, r *http.Request) {
+	analyticsRange, err := h.readAnalyticsRange(r, "week")
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	volume, err := h.analyticsStore.MuscleGroupVolume(analyticsRange)
+	if err != nil {
+		h.writeStoreError(w, r, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"muscle_groups": volume})
+}
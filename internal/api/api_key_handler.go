@@ -0,0 +1,125 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/shiponcs/femProject/internal/middleware"
+	"github.com/shiponcs/femProject/internal/store"
+	"github.com/shiponcs/femProject/utils"
+)
+
+type APIKeyHandler struct {
+	apiKeyStore store.APIKeyStore
+	logger      *slog.Logger
+}
+
+func NewAPIKeyHandler(apiKeyStore store.APIKeyStore, logger *slog.Logger) *APIKeyHandler {
+	return &APIKeyHandler{
+		apiKeyStore: apiKeyStore,
+		logger:      logger,
+	}
+}
+
+type createAPIKeyRequest struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+	// ExpiresInDays is optional, keys without it never expire.
+	ExpiresInDays *int `json:"expires_in_days"`
+}
+
+func (h *APIKeyHandler) validateCreateAPIKeyRequest(req *createAPIKeyRequest) error {
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		return errors.New("name is required")
+	}
+	if len(req.Name) > 100 {
+		return errors.New("name can't be greater than 100 characters")
+	}
+	if len(req.Scopes) == 0 {
+		return errors.New("at least one scope is required, one of " + strings.Join(store.APIScopes, ", "))
+	}
+	if req.ExpiresInDays != nil && *req.ExpiresInDays < 1 {
+		return errors.New("expires_in_days must be at least 1")
+	}
+	return nil
+}
+
+// HandleCreateAPIKey returns the new key in plaintext. It can't be shown
+// again later.
+func (h *APIKeyHandler) HandleCreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	var req createAPIKeyRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request payload"})
+		return
+	}
+
+	err = h.validateCreateAPIKeyRequest(&req)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	var expiresAt *time.Time
+	if req.ExpiresInDays != nil {
+		expiry := time.Now().AddDate(0, 0, *req.ExpiresInDays)
+		expiresAt = &expiry
+	}
+
+	currentUser := middleware.GetUser(r)
+
+	key, err := h.apiKeyStore.CreateAPIKey(currentUser.ID, req.Name, req.Scopes, expiresAt)
+	if errors.Is(err, store.ErrUnknownAPIScope) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "scopes must be among " + strings.Join(store.APIScopes, ", ")})
+		return
+	}
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "CreateAPIKey", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"api_key": key})
+}
+
+func (h *APIKeyHandler) HandleListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+
+	keys, err := h.apiKeyStore.ListAPIKeys(currentUser.ID)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "ListAPIKeys", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"api_keys": keys})
+}
+
+func (h *APIKeyHandler) HandleDeleteAPIKey(w http.ResponseWriter, r *http.Request) {
+	keyID, err := utils.ReadParam(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid api key id"})
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+
+	err = h.apiKeyStore.DeleteAPIKey(currentUser.ID, keyID)
+	if errors.Is(err, sql.ErrNoRows) {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "api key not found"})
+		return
+	}
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "DeleteAPIKey", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,45 @@
+package api
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+)
+
+// backgroundTasks counts the running background tasks so a shutdown can
+// wait for them, see WaitForBackground.
+var backgroundTasks sync.WaitGroup
+
+// background runs fn outside of the request, e.g. to send an email, so a
+// slow mail server doesn't hold the response. A panic in fn is logged
+// instead of taking the server down.
+func background(logger *slog.Logger, fn func()) {
+	backgroundTasks.Add(1)
+	go func() {
+		defer backgroundTasks.Done()
+		defer func() {
+			if err := recover(); err != nil {
+				logger.Error("background task", "error", err)
+			}
+		}()
+		fn()
+	}()
+}
+
+// WaitForBackground waits until every background task has finished, or
+// returns the error of ctx when it is done first. Call it after the server
+// stopped taking requests, so no new tasks are started.
+func WaitForBackground(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		backgroundTasks.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,31 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWaitForBackground(t *testing.T) {
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&logs, nil))
+
+	release := make(chan struct{})
+	background(logger, func() { <-release })
+	background(logger, func() { panic("mail server exploded") })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := WaitForBackground(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), time.Second, "gave up at the deadline")
+
+	close(release)
+	assert.NoError(t, WaitForBackground(context.Background()))
+	assert.Contains(t, logs.String(), "mail server exploded")
+}
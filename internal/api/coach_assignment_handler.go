@@ -0,0 +1,176 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/shiponcs/femProject/internal/middleware"
+	"github.com/shiponcs/femProject/internal/store"
+	"github.com/shiponcs/femProject/utils"
+)
+
+type createAssignmentRequest struct {
+	TemplateID int64  `json:"template_id"`
+	Note       string `json:"note"`
+	// DueDate is optional, formatted as YYYY-MM-DD.
+	DueDate string `json:"due_date"`
+}
+
+// HandleCreateAssignment assigns one of the coach's templates to an athlete
+// they coach.
+func (h *CoachHandler) HandleCreateAssignment(w http.ResponseWriter, r *http.Request) {
+	athleteID, ok := authorizeAthlete(w, r, h.policy, h.logger)
+	if !ok {
+		return
+	}
+
+	var req createAssignmentRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request payload"})
+		return
+	}
+
+	assignment := &store.Assignment{
+		CoachID:    middleware.GetUser(r).ID,
+		AthleteID:  athleteID,
+		TemplateID: req.TemplateID,
+		Note:       strings.TrimSpace(req.Note),
+	}
+	if req.DueDate != "" {
+		dueDate, err := parseDate(req.DueDate)
+		if err != nil {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "due_date must be formatted as YYYY-MM-DD"})
+			return
+		}
+		assignment.DueDate = &dueDate
+	}
+
+	owner, err := h.templateStore.GetTemplateOwner(r.Context(), req.TemplateID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		h.logger.ErrorContext(r.Context(), "GetTemplateOwner", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	// coaches can only assign their own templates
+	if err != nil || owner != assignment.CoachID {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "template not found"})
+		return
+	}
+
+	err = h.assignmentStore.CreateAssignment(r.Context(), assignment)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "CreateAssignment", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"assignment": assignment})
+}
+
+// HandleListAthleteAssignments shows the coach what they assigned to the
+// athlete and what was started.
+func (h *CoachHandler) HandleListAthleteAssignments(w http.ResponseWriter, r *http.Request) {
+	athleteID, ok := authorizeAthlete(w, r, h.policy, h.logger)
+	if !ok {
+		return
+	}
+
+	assignments, err := h.assignmentStore.ListAssignments(r.Context(), middleware.GetUser(r).ID, athleteID)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "ListAssignments", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"assignments": assignments})
+}
+
+func (h *CoachHandler) HandleListMyAssignments(w http.ResponseWriter, r *http.Request) {
+	assignments, err := h.assignmentStore.ListAssignmentsForAthlete(r.Context(), middleware.GetUser(r).ID)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "ListAssignmentsForAthlete", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"assignments": assignments})
+}
+
+// HandleStartAssignment logs a workout pre-filled from the assigned
+// template, like starting one of your own templates.
+func (h *CoachHandler) HandleStartAssignment(w http.ResponseWriter, r *http.Request) {
+	assignmentID, err := utils.ReadParam(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid assignment id"})
+		return
+	}
+
+	var req struct {
+		PerformedAt *time.Time `json:"performed_at"`
+	}
+	// the body is optional
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request payload"})
+			return
+		}
+	}
+
+	currentUser := middleware.GetUser(r)
+	assignment, err := h.assignmentStore.GetAssignment(r.Context(), assignmentID)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "GetAssignment", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	if assignment == nil || assignment.AthleteID != currentUser.ID {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "assignment not found"})
+		return
+	}
+	if assignment.WorkoutID != nil {
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": store.ErrAssignmentStarted.Error()})
+		return
+	}
+
+	template, err := h.templateStore.GetTemplateByID(r.Context(), assignment.TemplateID)
+	if err != nil || template == nil {
+		h.logger.ErrorContext(r.Context(), "GetTemplateByID", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	workout := template.NewWorkout(currentUser.ID)
+	if req.PerformedAt != nil {
+		workout.PerformedAt = *req.PerformedAt
+	}
+
+	createdWorkout, err := h.workoutStore.CreateWorkout(r.Context(), workout)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "CreateWorkout from assignment", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to create workout"})
+		return
+	}
+
+	err = h.assignmentStore.StartAssignment(r.Context(), assignment.ID, int64(createdWorkout.ID))
+	if errors.Is(err, store.ErrAssignmentStarted) {
+		// a concurrent request started it first, drop the duplicate
+		if err := h.workoutStore.DeleteWorkoutByID(r.Context(), int64(createdWorkout.ID)); err != nil {
+			h.logger.ErrorContext(r.Context(), "DeleteWorkoutByID", "error", err)
+		}
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "StartAssignment", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	h.metrics.WorkoutCreated()
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"workout": createdWorkout})
+}
@@ -0,0 +1,229 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/shiponcs/femProject/internal/mailer"
+	"github.com/shiponcs/femProject/internal/metrics"
+	"github.com/shiponcs/femProject/internal/middleware"
+	"github.com/shiponcs/femProject/internal/policy"
+	"github.com/shiponcs/femProject/internal/store"
+	"github.com/shiponcs/femProject/utils"
+)
+
+// CoachHandler serves both sides of coach–athlete relationships: coaches
+// invite athletes and assign them templates, athletes accept or revoke
+// coaches and start what was assigned to them.
+type CoachHandler struct {
+	coachStore      store.CoachStore
+	assignmentStore store.AssignmentStore
+	userStore       store.UserStore
+	templateStore   store.TemplateStore
+	workoutStore    store.WorkoutStore
+	policy          *policy.Policy
+	metrics         *metrics.Metrics
+	mailer          mailer.Mailer
+	logger          *slog.Logger
+}
+
+func NewCoachHandler(coachStore store.CoachStore, assignmentStore store.AssignmentStore, userStore store.UserStore, templateStore store.TemplateStore, workoutStore store.WorkoutStore, policy *policy.Policy, metrics *metrics.Metrics, mailer mailer.Mailer, logger *slog.Logger) *CoachHandler {
+	return &CoachHandler{
+		coachStore:      coachStore,
+		assignmentStore: assignmentStore,
+		userStore:       userStore,
+		templateStore:   templateStore,
+		workoutStore:    workoutStore,
+		policy:          policy,
+		metrics:         metrics,
+		mailer:          mailer,
+		logger:          logger,
+	}
+}
+
+// authorizeAthlete reads the athlete id of the route and writes the error
+// response itself unless the current user coaches that athlete.
+func authorizeAthlete(w http.ResponseWriter, r *http.Request, p *policy.Policy, logger *slog.Logger) (int, bool) {
+	athleteID, err := utils.ReadParam(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid athlete id"})
+		return 0, false
+	}
+
+	err = p.AuthorizeAthlete(r.Context(), middleware.GetUser(r), int(athleteID))
+	if errors.Is(err, policy.ErrForbidden) {
+		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "you don't coach this athlete"})
+		return 0, false
+	}
+	if err != nil {
+		logger.ErrorContext(r.Context(), "AuthorizeAthlete", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return 0, false
+	}
+	return int(athleteID), true
+}
+
+func (h *CoachHandler) HandleListCoaches(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+
+	coaches, err := h.coachStore.ListCoaches(r.Context(), currentUser.ID)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "ListCoaches", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"coaches": coaches})
+}
+
+// HandleAcceptCoach accepts the invitation of the coach in the route.
+func (h *CoachHandler) HandleAcceptCoach(w http.ResponseWriter, r *http.Request) {
+	coachID, err := utils.ReadParam(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid coach id"})
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+	err = h.coachStore.AcceptInvitation(r.Context(), currentUser.ID, int(coachID))
+	if errors.Is(err, sql.ErrNoRows) {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "invitation not found"})
+		return
+	}
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "AcceptInvitation", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleRevokeCoach declines an invitation or takes back access the coach
+// had.
+func (h *CoachHandler) HandleRevokeCoach(w http.ResponseWriter, r *http.Request) {
+	coachID, err := utils.ReadParam(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid coach id"})
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+	err = h.coachStore.RevokeAccess(r.Context(), currentUser.ID, int(coachID))
+	if errors.Is(err, sql.ErrNoRows) {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "coach not found"})
+		return
+	}
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "RevokeAccess", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *CoachHandler) HandleListAthletes(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+
+	athletes, err := h.coachStore.ListAthletes(r.Context(), currentUser.ID)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "ListAthletes", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"athletes": athletes})
+}
+
+// HandleInviteAthlete invites a user by username and emails them how to
+// accept.
+func (h *CoachHandler) HandleInviteAthlete(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Username string `json:"username"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request payload"})
+		return
+	}
+
+	req.Username = strings.TrimSpace(req.Username)
+	if req.Username == "" {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "username is required"})
+		return
+	}
+
+	athlete, err := h.userStore.GetUserByusername(r.Context(), req.Username)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "GetUserByusername", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	if athlete == nil {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "user not found"})
+		return
+	}
+
+	coach := middleware.GetUser(r)
+	if athlete.ID == coach.ID {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "you can't coach yourself"})
+		return
+	}
+
+	invitation, err := h.coachStore.InviteAthlete(r.Context(), coach.ID, athlete.ID)
+	if errors.Is(err, store.ErrNotACoach) {
+		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "InviteAthlete", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	if invitation.AcceptedAt == nil {
+		ctx := context.WithoutCancel(r.Context())
+		background(h.logger, func() {
+			data := map[string]any{
+				"Username": athlete.Username,
+				"Coach":    invitation.CoachUsername,
+				"CoachID":  coach.ID,
+			}
+			err := h.mailer.Send(athlete.Email, "coach_invitation.tmpl", data)
+			if err != nil {
+				h.logger.ErrorContext(ctx, "sending coach invitation email", "error", err)
+			}
+		})
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"athlete": invitation})
+}
+
+// HandleRemoveAthlete ends coaching the athlete, or withdraws the invitation.
+func (h *CoachHandler) HandleRemoveAthlete(w http.ResponseWriter, r *http.Request) {
+	athleteID, err := utils.ReadParam(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid athlete id"})
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+	err = h.coachStore.RevokeAccess(r.Context(), int(athleteID), currentUser.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "athlete not found"})
+		return
+	}
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "RevokeAccess", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,189 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/shiponcs/femProject/internal/store"
+	"github.com/shiponcs/femProject/utils"
+)
+
+type exerciseRequest struct {
+	Name            string   `json:"name"`
+	Aliases         []string `json:"aliases"`
+	MuscleGroups    []string `json:"muscle_groups"`
+	Equipment       string   `json:"equipment"`
+	MeasurementType string   `json:"measurement_type"`
+}
+
+type ExerciseHandler struct {
+	exerciseStore store.ExerciseStore
+	logger        *slog.Logger
+}
+
+func NewExerciseHandler(exerciseStore store.ExerciseStore, logger *slog.Logger) *ExerciseHandler {
+	return &ExerciseHandler{
+		exerciseStore: exerciseStore,
+		logger:        logger,
+	}
+}
+
+func (h *ExerciseHandler) validateExerciseRequest(req *exerciseRequest) error {
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		return errors.New("name is required")
+	}
+
+	if len(req.Name) > 255 {
+		return errors.New("name can't be greater than 255 characters")
+	}
+
+	if req.MeasurementType == "" {
+		req.MeasurementType = store.MeasurementReps
+	}
+
+	switch req.MeasurementType {
+	case store.MeasurementReps, store.MeasurementDuration, store.MeasurementDistance:
+	default:
+		return errors.New("measurement_type must be one of reps, duration or distance")
+	}
+
+	// muscle groups are matched in lower case when filtering
+	for i, group := range req.MuscleGroups {
+		req.MuscleGroups[i] = strings.ToLower(strings.TrimSpace(group))
+	}
+
+	return nil
+}
+
+func (h *ExerciseHandler) writeStoreError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, store.ErrDuplicateExercise), errors.Is(err, store.ErrExerciseInUse):
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": err.Error()})
+	case errors.Is(err, sql.ErrNoRows):
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "exercise not found"})
+	default:
+		h.logger.ErrorContext(r.Context(), "exercise store", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+	}
+}
+
+func (h *ExerciseHandler) HandleListExercises(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	exercises, err := h.exerciseStore.ListExercises(query.Get("q"), query.Get("muscle_group"))
+	if err != nil {
+		h.writeStoreError(w, r, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"exercises": exercises})
+}
+
+func (h *ExerciseHandler) HandleGetExerciseByID(w http.ResponseWriter, r *http.Request) {
+	exerciseID, err := utils.ReadParam(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid exercise id"})
+		return
+	}
+
+	exercise, err := h.exerciseStore.GetExerciseByID(exerciseID)
+	if err != nil {
+		h.writeStoreError(w, r, err)
+		return
+	}
+	if exercise == nil {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "exercise not found"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"exercise": exercise})
+}
+
+func (h *ExerciseHandler) HandleCreateExercise(w http.ResponseWriter, r *http.Request) {
+	var req exerciseRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request payload"})
+		return
+	}
+
+	if err := h.validateExerciseRequest(&req); err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	exercise := &store.Exercise{
+		Name:            req.Name,
+		Aliases:         req.Aliases,
+		MuscleGroups:    req.MuscleGroups,
+		Equipment:       req.Equipment,
+		MeasurementType: req.MeasurementType,
+	}
+
+	if err := h.exerciseStore.CreateExercise(exercise); err != nil {
+		h.writeStoreError(w, r, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"exercise": exercise})
+}
+
+func (h *ExerciseHandler) HandleUpdateExercise(w http.ResponseWriter, r *http.Request) {
+	exerciseID, err := utils.ReadParam(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid exercise id"})
+		return
+	}
+
+	var req exerciseRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request payload"})
+		return
+	}
+
+	if err := h.validateExerciseRequest(&req); err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	exercise := &store.Exercise{
+		ID:              int(exerciseID),
+		Name:            req.Name,
+		Aliases:         req.Aliases,
+		MuscleGroups:    req.MuscleGroups,
+		Equipment:       req.Equipment,
+		MeasurementType: req.MeasurementType,
+	}
+
+	if err := h.exerciseStore.UpdateExercise(exercise); err != nil {
+		h.writeStoreError(w, r, err)
+		return
+	}
+
+	updated, err := h.exerciseStore.GetExerciseByID(exerciseID)
+	if err != nil {
+		h.writeStoreError(w, r, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"exercise": updated})
+}
+
+func (h *ExerciseHandler) HandleDeleteExercise(w http.ResponseWriter, r *http.Request) {
+	exerciseID, err := utils.ReadParam(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid exercise id"})
+		return
+	}
+
+	if err := h.exerciseStore.DeleteExercise(exerciseID); err != nil {
+		h.writeStoreError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
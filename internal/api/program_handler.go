@@ -0,0 +1,383 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/shiponcs/femProject/internal/middleware"
+	"github.com/shiponcs/femProject/internal/policy"
+	"github.com/shiponcs/femProject/internal/store"
+	"github.com/shiponcs/femProject/utils"
+)
+
+const maxProgramWeeks = 52
+
+type createProgramRequest struct {
+	Name        string             `json:"name"`
+	Description string             `json:"description"`
+	Weeks       int                `json:"weeks"`
+	Days        []store.ProgramDay `json:"days"`
+}
+
+type ProgramHandler struct {
+	programStore  store.ProgramStore
+	templateStore store.TemplateStore
+	workoutStore  store.WorkoutStore
+	policy        *policy.Policy
+	logger        *slog.Logger
+}
+
+func NewProgramHandler(programStore store.ProgramStore, templateStore store.TemplateStore, workoutStore store.WorkoutStore, policy *policy.Policy, logger *slog.Logger) *ProgramHandler {
+	return &ProgramHandler{
+		programStore:  programStore,
+		templateStore: templateStore,
+		workoutStore:  workoutStore,
+		policy:        policy,
+		logger:        logger,
+	}
+}
+
+func (h *ProgramHandler) validateCreateProgramRequest(req *createProgramRequest) error {
+	if req.Name == "" {
+		return errors.New("name is required")
+	}
+
+	if len(req.Name) > 255 {
+		return errors.New("name can't be greater than 255 characters")
+	}
+
+	if req.Weeks < 1 || req.Weeks > maxProgramWeeks {
+		return fmt.Errorf("weeks must be between 1 and %d", maxProgramWeeks)
+	}
+
+	if len(req.Days) == 0 {
+		return errors.New("a program needs at least one day")
+	}
+
+	seen := make(map[[2]int]bool, len(req.Days))
+	for i, day := range req.Days {
+		if day.Week < 1 || day.Week > req.Weeks {
+			return fmt.Errorf("days[%d]: week must be between 1 and %d", i, req.Weeks)
+		}
+		if day.Day < 1 || day.Day > 7 {
+			return fmt.Errorf("days[%d]: day must be between 1 and 7", i)
+		}
+		if seen[[2]int{day.Week, day.Day}] {
+			return fmt.Errorf("days[%d]: week %d day %d is scheduled twice", i, day.Week, day.Day)
+		}
+		seen[[2]int{day.Week, day.Day}] = true
+	}
+
+	return nil
+}
+
+// readLocation reads the optional tz query parameter, an IANA time zone
+// name. Calendar days like "today" are computed in it.
+func readLocation(r *http.Request) (*time.Location, error) {
+	name := r.URL.Query().Get("tz")
+	if name == "" {
+		return time.UTC, nil
+	}
+
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, errors.New("tz must be an IANA time zone name")
+	}
+	return loc, nil
+}
+
+func today(loc *time.Location) time.Time {
+	y, m, d := time.Now().In(loc).Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+func parseDate(value string) (time.Time, error) {
+	return time.Parse("2006-01-02", value)
+}
+
+// loadProgram writes the error response itself and returns nil when the
+// program doesn't exist or the current user may not perform action on it.
+func (h *ProgramHandler) loadProgram(w http.ResponseWriter, r *http.Request, action policy.Action) *store.Program {
+	programID, err := utils.ReadParam(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid program id"})
+		return nil
+	}
+
+	program, err := h.programStore.GetProgramByID(programID)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "GetProgramByID", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return nil
+	}
+	if program == nil {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "program not found"})
+		return nil
+	}
+
+	err = h.policy.AuthorizeProgram(r.Context(), middleware.GetUser(r), action, program.UserID)
+	if errors.Is(err, policy.ErrForbidden) {
+		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "you are not authorized to " + workoutActions[action] + " this program"})
+		return nil
+	}
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "AuthorizeProgram", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return nil
+	}
+	return program
+}
+
+func (h *ProgramHandler) HandleCreateProgram(w http.ResponseWriter, r *http.Request) {
+	var req createProgramRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request payload"})
+		return
+	}
+
+	if err := h.validateCreateProgramRequest(&req); err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+	checked := make(map[int]bool)
+	for _, day := range req.Days {
+		if checked[day.TemplateID] {
+			continue
+		}
+		owner, err := h.templateStore.GetTemplateOwner(r.Context(), int64(day.TemplateID))
+		if err == nil {
+			err = h.policy.AuthorizeTemplate(r.Context(), currentUser, policy.ReadWorkout, owner)
+		}
+		if errors.Is(err, sql.ErrNoRows) || errors.Is(err, policy.ErrForbidden) {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": fmt.Sprintf("template %d not found", day.TemplateID)})
+			return
+		}
+		if err != nil {
+			h.logger.ErrorContext(r.Context(), "GetTemplateOwner", "error", err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+			return
+		}
+		checked[day.TemplateID] = true
+	}
+
+	program := &store.Program{
+		UserID:      currentUser.ID,
+		Name:        req.Name,
+		Description: req.Description,
+		Weeks:       req.Weeks,
+		Days:        req.Days,
+	}
+
+	if err := h.programStore.CreateProgram(program); err != nil {
+		h.logger.ErrorContext(r.Context(), "CreateProgram", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"program": program})
+}
+
+func (h *ProgramHandler) HandleListPrograms(w http.ResponseWriter, r *http.Request) {
+	programs, err := h.programStore.ListPrograms(middleware.GetUser(r).ID)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "ListPrograms", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"programs": programs})
+}
+
+func (h *ProgramHandler) HandleGetProgramByID(w http.ResponseWriter, r *http.Request) {
+	program := h.loadProgram(w, r, policy.ReadWorkout)
+	if program == nil {
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"program": program})
+}
+
+func (h *ProgramHandler) HandleDeleteProgram(w http.ResponseWriter, r *http.Request) {
+	program := h.loadProgram(w, r, policy.DeleteWorkout)
+	if program == nil {
+		return
+	}
+
+	err := h.programStore.DeleteProgram(int64(program.ID))
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		h.logger.ErrorContext(r.Context(), "DeleteProgram", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *ProgramHandler) HandleEnroll(w http.ResponseWriter, r *http.Request) {
+	program := h.loadProgram(w, r, policy.ReadWorkout)
+	if program == nil {
+		return
+	}
+
+	loc, err := readLocation(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	var req struct {
+		StartDate string `json:"start_date"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request payload"})
+			return
+		}
+	}
+
+	startDate := today(loc)
+	if req.StartDate != "" {
+		startDate, err = parseDate(req.StartDate)
+		if err != nil {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "start_date must be formatted as YYYY-MM-DD"})
+			return
+		}
+	}
+
+	enrollment := &store.ProgramEnrollment{
+		ProgramID: program.ID,
+		UserID:    middleware.GetUser(r).ID,
+		StartDate: startDate,
+	}
+
+	if err := h.programStore.Enroll(enrollment); err != nil {
+		h.logger.ErrorContext(r.Context(), "Enroll", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"enrollment": enrollment})
+}
+
+func (h *ProgramHandler) HandleGetEnrollment(w http.ResponseWriter, r *http.Request) {
+	enrollmentID, err := utils.ReadParam(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid enrollment id"})
+		return
+	}
+
+	loc, err := readLocation(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	enrollment, err := h.programStore.GetEnrollment(enrollmentID, today(loc))
+	if err == nil && enrollment != nil {
+		err = h.policy.AuthorizeProgram(r.Context(), middleware.GetUser(r), policy.ReadWorkout, enrollment.UserID)
+	}
+	if enrollment == nil || errors.Is(err, policy.ErrForbidden) {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "enrollment not found"})
+		return
+	}
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "GetEnrollment", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"enrollment": enrollment})
+}
+
+// HandleGetSchedule lists the sessions of the day (range=day, the default)
+// or the Monday to Sunday week (range=week) containing date, which defaults
+// to today in tz.
+func (h *ProgramHandler) HandleGetSchedule(w http.ResponseWriter, r *http.Request) {
+	loc, err := readLocation(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	query := r.URL.Query()
+	from := today(loc)
+	if query.Get("date") != "" {
+		from, err = parseDate(query.Get("date"))
+		if err != nil {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "date must be formatted as YYYY-MM-DD"})
+			return
+		}
+	}
+
+	to := from
+	switch query.Get("range") {
+	case "", "day":
+	case "week":
+		offset := (int(from.Weekday()) + 6) % 7
+		from = from.AddDate(0, 0, -offset)
+		to = from.AddDate(0, 0, 6)
+	default:
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "range must be day or week"})
+		return
+	}
+
+	sessions, err := h.programStore.ListScheduledSessions(middleware.GetUser(r).ID, from, to)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "ListScheduledSessions", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"sessions": sessions})
+}
+
+func (h *ProgramHandler) HandleCompleteSession(w http.ResponseWriter, r *http.Request) {
+	sessionID, err := utils.ReadParam(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid session id"})
+		return
+	}
+
+	var req struct {
+		WorkoutID int64 `json:"workout_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request payload"})
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+	workoutOwner, err := h.workoutStore.GetWorkoutOwner(r.Context(), req.WorkoutID)
+	if err == nil {
+		err = h.policy.AuthorizeWorkout(r.Context(), currentUser, policy.UpdateWorkout, workoutOwner)
+	}
+	if errors.Is(err, sql.ErrNoRows) || errors.Is(err, policy.ErrForbidden) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "workout not found"})
+		return
+	}
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "authorizing workout", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	err = h.programStore.CompleteSession(sessionID, currentUser.ID, req.WorkoutID)
+	if errors.Is(err, sql.ErrNoRows) {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "session not found"})
+		return
+	}
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "CompleteSession", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"session_id": sessionID, "workout_id": req.WorkoutID})
+}
@@ -0,0 +1,39 @@
+package api
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/shiponcs/femProject/internal/middleware"
+	"github.com/shiponcs/femProject/internal/store"
+	"github.com/shiponcs/femProject/utils"
+)
+
+type RecordHandler struct {
+	recordStore store.PersonalRecordStore
+	logger      *slog.Logger
+}
+
+func NewRecordHandler(recordStore store.PersonalRecordStore, logger *slog.Logger) *RecordHandler {
+	return &RecordHandler{
+		recordStore: recordStore,
+		logger:      logger,
+	}
+}
+
+func (h *RecordHandler) HandleListMyRecords(w http.ResponseWriter, r *http.Request) {
+	exerciseID, err := utils.ReadQueryInt(r, "exercise_id")
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	records, err := h.recordStore.ListPersonalRecords(middleware.GetUser(r).ID, exerciseID)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "ListPersonalRecords", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"records": records})
+}
@@ -0,0 +1,253 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/shiponcs/femProject/internal/metrics"
+	"github.com/shiponcs/femProject/internal/middleware"
+	"github.com/shiponcs/femProject/internal/policy"
+	"github.com/shiponcs/femProject/internal/store"
+	"github.com/shiponcs/femProject/utils"
+)
+
+type templateRequest struct {
+	Title           string                       `json:"title"`
+	Description     string                       `json:"description"`
+	DurationMinutes int                          `json:"duration_minutes"`
+	Entries         []store.WorkoutTemplateEntry `json:"entries"`
+}
+
+type TemplateHandler struct {
+	templateStore store.TemplateStore
+	workoutStore  store.WorkoutStore
+	policy        *policy.Policy
+	metrics       *metrics.Metrics
+	logger        *slog.Logger
+}
+
+func NewTemplateHandler(templateStore store.TemplateStore, workoutStore store.WorkoutStore, policy *policy.Policy, metrics *metrics.Metrics, logger *slog.Logger) *TemplateHandler {
+	return &TemplateHandler{
+		templateStore: templateStore,
+		workoutStore:  workoutStore,
+		policy:        policy,
+		metrics:       metrics,
+		logger:        logger,
+	}
+}
+
+func (h *TemplateHandler) validateTemplateRequest(req *templateRequest) error {
+	if req.Title == "" {
+		return errors.New("title is required")
+	}
+
+	if len(req.Title) > 255 {
+		return errors.New("title can't be greater than 255 characters")
+	}
+
+	if req.DurationMinutes < 0 {
+		return errors.New("duration_minutes can't be negative")
+	}
+
+	for i, entry := range req.Entries {
+		if entry.ExerciseName == "" && entry.ExerciseID == 0 {
+			return fmt.Errorf("entries[%d]: exercise_name or exercise_id is required", i)
+		}
+		if entry.TargetSets < 1 {
+			return fmt.Errorf("entries[%d]: target_sets must be at least 1", i)
+		}
+		if (entry.TargetReps == nil) == (entry.TargetDurationSeconds == nil) {
+			return fmt.Errorf("entries[%d]: exactly one of target_reps or target_duration_seconds is required", i)
+		}
+	}
+
+	return nil
+}
+
+// loadTemplate writes the error response itself and returns nil when the
+// template doesn't exist or the current user may not perform action on it.
+func (h *TemplateHandler) loadTemplate(w http.ResponseWriter, r *http.Request, action policy.Action) *store.WorkoutTemplate {
+	templateID, err := utils.ReadParam(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid template id"})
+		return nil
+	}
+
+	template, err := h.templateStore.GetTemplateByID(r.Context(), templateID)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "GetTemplateByID", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return nil
+	}
+	if template == nil {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "template not found"})
+		return nil
+	}
+
+	err = h.policy.AuthorizeTemplate(r.Context(), middleware.GetUser(r), action, template.UserID)
+	if errors.Is(err, policy.ErrForbidden) {
+		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "you are not authorized to " + workoutActions[action] + " this template"})
+		return nil
+	}
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "AuthorizeTemplate", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return nil
+	}
+	return template
+}
+
+func (h *TemplateHandler) writeStoreError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, store.ErrUnknownExercise):
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+	case errors.Is(err, store.ErrTemplateInUse):
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": err.Error()})
+	case errors.Is(err, sql.ErrNoRows):
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "template not found"})
+	default:
+		h.logger.ErrorContext(r.Context(), "template store", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+	}
+}
+
+func (h *TemplateHandler) HandleListTemplates(w http.ResponseWriter, r *http.Request) {
+	templates, err := h.templateStore.ListTemplates(r.Context(), middleware.GetUser(r).ID)
+	if err != nil {
+		h.writeStoreError(w, r, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"templates": templates})
+}
+
+func (h *TemplateHandler) HandleGetTemplateByID(w http.ResponseWriter, r *http.Request) {
+	template := h.loadTemplate(w, r, policy.ReadWorkout)
+	if template == nil {
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"template": template})
+}
+
+func (h *TemplateHandler) HandleCreateTemplate(w http.ResponseWriter, r *http.Request) {
+	var req templateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request payload"})
+		return
+	}
+
+	if err := h.validateTemplateRequest(&req); err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	template := &store.WorkoutTemplate{
+		UserID:          middleware.GetUser(r).ID,
+		Title:           req.Title,
+		Description:     req.Description,
+		DurationMinutes: req.DurationMinutes,
+		Entries:         req.Entries,
+	}
+	if template.Entries == nil {
+		template.Entries = []store.WorkoutTemplateEntry{}
+	}
+
+	if err := h.templateStore.CreateTemplate(r.Context(), template); err != nil {
+		h.writeStoreError(w, r, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"template": template})
+}
+
+func (h *TemplateHandler) HandleUpdateTemplate(w http.ResponseWriter, r *http.Request) {
+	template := h.loadTemplate(w, r, policy.UpdateWorkout)
+	if template == nil {
+		return
+	}
+
+	var req templateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request payload"})
+		return
+	}
+
+	if err := h.validateTemplateRequest(&req); err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	template.Title = req.Title
+	template.Description = req.Description
+	template.DurationMinutes = req.DurationMinutes
+	template.Entries = req.Entries
+	if template.Entries == nil {
+		template.Entries = []store.WorkoutTemplateEntry{}
+	}
+
+	if err := h.templateStore.UpdateTemplate(r.Context(), template); err != nil {
+		h.writeStoreError(w, r, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"template": template})
+}
+
+func (h *TemplateHandler) HandleDeleteTemplate(w http.ResponseWriter, r *http.Request) {
+	template := h.loadTemplate(w, r, policy.DeleteWorkout)
+	if template == nil {
+		return
+	}
+
+	if err := h.templateStore.DeleteTemplate(r.Context(), int64(template.ID)); err != nil {
+		h.writeStoreError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleStartWorkout logs a new workout pre-filled from the template. The
+// user adjusts the actual numbers afterwards through the workout endpoints.
+func (h *TemplateHandler) HandleStartWorkout(w http.ResponseWriter, r *http.Request) {
+	template := h.loadTemplate(w, r, policy.ReadWorkout)
+	if template == nil {
+		return
+	}
+
+	var req struct {
+		Title       *string    `json:"title"`
+		PerformedAt *time.Time `json:"performed_at"`
+	}
+	// the body is optional
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request payload"})
+			return
+		}
+	}
+
+	workout := template.NewWorkout(middleware.GetUser(r).ID)
+	if req.Title != nil {
+		workout.Title = *req.Title
+	}
+	if req.PerformedAt != nil {
+		workout.PerformedAt = *req.PerformedAt
+	}
+
+	createdWorkout, err := h.workoutStore.CreateWorkout(r.Context(), workout)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "CreateWorkout from template", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to create workout"})
+		return
+	}
+
+	h.metrics.WorkoutCreated()
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"workout": createdWorkout})
+}
@@ -1,32 +1,108 @@
 package api
 
 import (
+	"context"
+	"database/sql"
 	"encoding/json"
-	"log"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net"
 	"net/http"
+	"strconv"
 	"time"
 
+	"github.com/shiponcs/femProject/internal/auth"
+	"github.com/shiponcs/femProject/internal/mailer"
+	"github.com/shiponcs/femProject/internal/metrics"
+	"github.com/shiponcs/femProject/internal/middleware"
 	"github.com/shiponcs/femProject/internal/store"
 	"github.com/shiponcs/femProject/internal/tokens"
 	"github.com/shiponcs/femProject/utils"
 )
 
 type TokenHandler struct {
-	tokenStore store.TokenStore
-	userStore  store.UserStore
-	logger     *log.Logger
+	tokenStore     store.TokenStore
+	accessTokens   auth.AccessTokens
+	userStore      store.UserStore
+	twoFactorStore store.TwoFactorStore
+	loginLimiter   *auth.LoginLimiter
+	metrics        *metrics.Metrics
+	mailer         mailer.Mailer
+	logger         *slog.Logger
+	ttls           TokenTTLs
+}
+
+// TokenTTLs are the lifetimes of the tokens handed out by TokenHandler.
+type TokenTTLs struct {
+	// Access tokens are short lived, clients keep a session going for
+	// Refresh by exchanging the refresh token at POST /tokens/refresh.
+	Refresh time.Duration
+	// PasswordReset is how long an emailed password reset token is valid.
+	PasswordReset time.Duration
+	// TwoFactorPending is how long a client has to send the second factor
+	// after the password was accepted.
+	TwoFactorPending time.Duration
+}
+
+// formatTTL spells out a token lifetime for emails, e.g. "45 minutes".
+func formatTTL(d time.Duration) string {
+	units := []struct {
+		name string
+		size time.Duration
+	}{
+		{"day", 24 * time.Hour},
+		{"hour", time.Hour},
+		{"minute", time.Minute},
+	}
+	for _, unit := range units {
+		if d >= unit.size && d%unit.size == 0 {
+			n := int(d / unit.size)
+			if n == 1 {
+				return "1 " + unit.name
+			}
+			return fmt.Sprintf("%d %ss", n, unit.name)
+		}
+	}
+	return d.String()
 }
 
 type createTokenRequest struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
+	// Label names the session, e.g. "work laptop", in GET /users/me/sessions.
+	Label string `json:"label"`
 }
 
-func NewTokenHandler(tokenStore store.TokenStore, userStore store.UserStore, logger *log.Logger) *TokenHandler {
+func clientIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return ip
+}
+
+// sessionInfo describes the client of r for the session list.
+func sessionInfo(r *http.Request, label string) store.SessionInfo {
+	return store.SessionInfo{
+		UserAgent: r.UserAgent(),
+		IP:        clientIP(r),
+		Label:     label,
+	}
+}
+
+func NewTokenHandler(tokenStore store.TokenStore, accessTokens auth.AccessTokens, userStore store.UserStore, twoFactorStore store.TwoFactorStore, loginLimiter *auth.LoginLimiter, ttls TokenTTLs, metrics *metrics.Metrics, mailer mailer.Mailer, logger *slog.Logger) *TokenHandler {
 	return &TokenHandler{
-		tokenStore: tokenStore,
-		userStore:  userStore,
-		logger:     logger,
+		tokenStore:     tokenStore,
+		accessTokens:   accessTokens,
+		userStore:      userStore,
+		twoFactorStore: twoFactorStore,
+		loginLimiter:   loginLimiter,
+		metrics:        metrics,
+		mailer:         mailer,
+		logger:         logger,
+		ttls:           ttls,
 	}
 }
 
@@ -35,34 +111,369 @@ func (h *TokenHandler) HandleCreateToken(w http.ResponseWriter, r *http.Request)
 
 	err := json.NewDecoder(r.Body).Decode(&req)
 	if err != nil {
-		h.logger.Printf("ERROR: createTokenRequest Decode: %v", err)
+		h.logger.ErrorContext(r.Context(), "createTokenRequest Decode", "error", err)
 		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request payload"})
 		return
 	}
 
-	user, err := h.userStore.GetUserByusername(req.Username)
-	if err != nil || user == nil {
-		h.logger.Printf("ERROR: GetUserByUsername: %v", err)
+	ip := clientIP(r)
+	wait, err := h.loginLimiter.Attempt(r.Context(), req.Username, ip)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "loginLimiter.Attempt", "error", err)
 		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
 		return
 	}
-	passwordMatch, err := user.PasswordHash.Matches(req.Password)
+	if wait > 0 {
+		h.metrics.Login(metrics.LoginThrottled)
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		utils.WriteJSON(w, http.StatusTooManyRequests, utils.Envelope{"error": "too many failed login attempts, try again later"})
+		return
+	}
+
+	user, err := h.userStore.GetUserByusername(r.Context(), req.Username)
 	if err != nil {
-		h.logger.Printf("ERROR: PasswordHashMatches: %v", err)
+		h.logger.ErrorContext(r.Context(), "GetUserByUsername", "error", err)
 		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
 		return
 	}
 
+	passwordMatch := false
+	if user == nil {
+		h.userStore.SimulatePasswordCheck(req.Password)
+	} else {
+		passwordMatch, err = user.PasswordHash.Matches(req.Password)
+		if err != nil {
+			h.logger.ErrorContext(r.Context(), "PasswordHashMatches", "error", err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+			return
+		}
+	}
+
+	// the attempt was counted as a failure by loginLimiter.Attempt already
 	if !passwordMatch {
+		h.metrics.Login(metrics.LoginFailed)
 		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "invalid credentials"})
 		return
 	}
 
-	token, err := h.tokenStore.CreateNewToken(user.ID, 24*time.Hour, tokens.ScopeAuth)
+	twoFactor, err := h.twoFactorStore.GetTwoFactor(user.ID)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "GetTwoFactor", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	if twoFactor != nil && twoFactor.Enabled {
+		// the attempt stays counted as a failure until the second factor
+		// passes, or guessing codes would never be throttled
+		pendingToken, err := h.tokenStore.CreateNewToken(r.Context(), user.ID, h.ttls.TwoFactorPending, tokens.Scope2FAPending)
+		if err != nil {
+			h.logger.ErrorContext(r.Context(), "creating token", "error", err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+			return
+		}
+		utils.WriteJSON(w, http.StatusOK, utils.Envelope{"two_factor_required": true, "pending_token": pendingToken})
+		return
+	}
+
+	h.metrics.Login(metrics.LoginSucceeded)
+	err = h.loginLimiter.Succeed(r.Context(), req.Username, ip)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "loginLimiter.Succeed", "error", err)
+	}
+	h.createSession(w, r, user, req.Label)
+}
+
+func (h *TokenHandler) createSession(w http.ResponseWriter, r *http.Request, user *store.User, label string) {
+	refreshToken, err := h.tokenStore.CreateSession(r.Context(), user.ID, h.ttls.Refresh, sessionInfo(r, label))
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "creating token", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	accessToken, err := h.accessTokens.Issue(r.Context(), user, refreshToken.FamilyID)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "issuing access token", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"auth_token": accessToken, "refresh_token": refreshToken})
+}
+
+// HandleVerifyTwoFactor is the second step of a login with two-factor
+// authentication: it exchanges the pending token and a TOTP or recovery
+// code for the usual token pair.
+func (h *TokenHandler) HandleVerifyTwoFactor(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		PendingToken string `json:"pending_token"`
+		Label        string `json:"label"`
+		twoFactorCodeRequest
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil || req.PendingToken == "" {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "pending_token is required"})
+		return
+	}
+	if req.Code == "" && req.RecoveryCode == "" {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "code or recovery_code is required"})
+		return
+	}
+
+	user, err := h.userStore.GetUserToken(r.Context(), tokens.Scope2FAPending, req.PendingToken)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "GetUserToken", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	if user == nil {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "invalid or expired pending token, log in again"})
+		return
+	}
+
+	twoFactor, err := h.twoFactorStore.GetTwoFactor(user.ID)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "GetTwoFactor", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	ok := true
+	if twoFactor != nil && twoFactor.Enabled {
+		ok, err = verifySecondFactor(h.twoFactorStore, twoFactor, req.twoFactorCodeRequest)
+		if err != nil {
+			h.logger.ErrorContext(r.Context(), "verifySecondFactor", "error", err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+			return
+		}
+	}
+
+	// a pending token is good for one attempt, guessing codes takes the
+	// password every time
+	err = h.tokenStore.DeleteAllTokensForUser(r.Context(), user.ID, tokens.Scope2FAPending)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "DeleteAllTokensForUser", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	// the login that handed out the pending token is still counted as a
+	// failure by loginLimiter, a wrong code leaves it at that
+	if !ok {
+		h.metrics.Login(metrics.LoginFailed)
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "invalid code, log in again"})
+		return
+	}
+
+	h.metrics.Login(metrics.LoginSucceeded)
+	err = h.loginLimiter.Succeed(r.Context(), user.Username, clientIP(r))
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "loginLimiter.Succeed", "error", err)
+	}
+	h.createSession(w, r, user, req.Label)
+}
+
+func (h *TokenHandler) HandleRefreshToken(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil || req.RefreshToken == "" {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "refresh_token is required"})
+		return
+	}
+
+	refreshToken, err := h.tokenStore.RotateRefreshToken(r.Context(), req.RefreshToken, h.ttls.Refresh, sessionInfo(r, ""))
+	var reused *store.TokenReusedError
+	switch {
+	case errors.As(err, &reused):
+		h.logger.WarnContext(r.Context(), "reuse of a rotated refresh token, the session was revoked", "session_id", reused.SessionID, "user_id", reused.UserID)
+		h.accessTokens.Revoke(reused.SessionID)
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "refresh token was already used, please log in again"})
+		return
+	case errors.Is(err, store.ErrInvalidToken):
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "invalid or expired refresh token"})
+		return
+	case err != nil:
+		h.logger.ErrorContext(r.Context(), "RotateRefreshToken", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	user, err := h.userStore.GetUserByID(r.Context(), refreshToken.UserID)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "GetUserByID", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	// the user was deleted after the token was rotated
+	if user == nil {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "invalid refresh token"})
+		return
+	}
+
+	accessToken, err := h.accessTokens.Issue(r.Context(), user, refreshToken.FamilyID)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "issuing access token", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"auth_token": accessToken, "refresh_token": refreshToken})
+}
+
+// HandleDeleteCurrentToken logs out the session the request was made with.
+func (h *TokenHandler) HandleDeleteCurrentToken(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+
+	err := h.tokenStore.DeleteSession(r.Context(), currentUser.ID, currentUser.SessionID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		h.logger.ErrorContext(r.Context(), "DeleteSession", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	h.accessTokens.Revoke(currentUser.SessionID)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *TokenHandler) HandleListSessions(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+
+	sessions, err := h.tokenStore.ListSessions(r.Context(), currentUser.ID, currentUser.SessionID)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "ListSessions", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"sessions": sessions})
+}
+
+func (h *TokenHandler) HandleDeleteSession(w http.ResponseWriter, r *http.Request) {
+	sessionID, err := utils.ReadParam(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid session id"})
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+
+	err = h.tokenStore.DeleteSession(r.Context(), currentUser.ID, sessionID)
+	if errors.Is(err, sql.ErrNoRows) {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "session not found"})
+		return
+	}
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "DeleteSession", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	h.accessTokens.Revoke(sessionID)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleDeleteAllSessions logs the user out everywhere, including the
+// session the request was made with.
+func (h *TokenHandler) HandleDeleteAllSessions(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+
+	err := logOutEverywhere(r.Context(), h.tokenStore, h.accessTokens, currentUser.ID)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "logOutEverywhere", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// logOutEverywhere ends every session of the user, along with the tokens
+// of the extra scopes.
+func logOutEverywhere(ctx context.Context, tokenStore store.TokenStore, accessTokens auth.AccessTokens, userID int, extraScopes ...string) error {
+	sessions, err := tokenStore.ListSessions(ctx, userID, 0)
+	if err != nil {
+		return err
+	}
+
+	scopes := append([]string{tokens.ScopeAuth, tokens.ScopeRefresh}, extraScopes...)
+	for _, scope := range scopes {
+		err := tokenStore.DeleteAllTokensForUser(ctx, userID, scope)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, session := range sessions {
+		accessTokens.Revoke(session.ID)
+	}
+	return nil
+}
+
+// HandleJWKS publishes the keys access tokens are signed with, empty unless
+// the JWT backend signs with EdDSA.
+func (h *TokenHandler) HandleJWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"keys": h.accessTokens.JWKS().Keys})
+}
+
+// HandleCreatePasswordResetToken emails a password reset token. It answers
+// the same way whether or not the email belongs to an account, so it can't
+// be used to find out who is registered.
+func (h *TokenHandler) HandleCreatePasswordResetToken(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Email string `json:"email"`
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil || req.Email == "" {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "email is required"})
+		return
+	}
+
+	accepted := utils.Envelope{"message": "if an account uses this email, a password reset token was sent to it"}
+
+	user, err := h.userStore.GetUserByEmail(r.Context(), req.Email)
 	if err != nil {
-		h.logger.Printf("ERROR: creating token %v", err)
+		h.logger.ErrorContext(r.Context(), "GetUserByEmail", "error", err)
 		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
 		return
 	}
-	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"auth_token": token})
+	if user == nil {
+		utils.WriteJSON(w, http.StatusAccepted, accepted)
+		return
+	}
+
+	// only the latest reset token is valid
+	err = h.tokenStore.DeleteAllTokensForUser(r.Context(), user.ID, tokens.ScopePasswordReset)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "DeleteAllTokensForUser", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	token, err := h.tokenStore.CreateNewToken(r.Context(), user.ID, h.ttls.PasswordReset, tokens.ScopePasswordReset)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "creating password reset token", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	// the request context is canceled once the response is written, the
+	// email goes out after that
+	ctx := context.WithoutCancel(r.Context())
+	background(h.logger, func() {
+		data := map[string]any{
+			"Username":  user.Username,
+			"Token":     token.Plaintext,
+			"ExpiresIn": formatTTL(h.ttls.PasswordReset),
+		}
+		err := h.mailer.Send(user.Email, "password_reset.tmpl", data)
+		if err != nil {
+			h.logger.ErrorContext(ctx, "sending password reset email", "error", err)
+		}
+	})
+
+	utils.WriteJSON(w, http.StatusAccepted, accepted)
 }
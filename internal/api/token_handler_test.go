@@ -0,0 +1,126 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shiponcs/femProject/internal/auth"
+	"github.com/shiponcs/femProject/internal/metrics"
+	"github.com/shiponcs/femProject/internal/store"
+	"github.com/shiponcs/femProject/internal/tokens"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestFormatTTL(t *testing.T) {
+	tests := []struct {
+		ttl  time.Duration
+		want string
+	}{
+		{45 * time.Minute, "45 minutes"},
+		{time.Minute, "1 minute"},
+		{90 * time.Minute, "90 minutes"},
+		{2 * time.Hour, "2 hours"},
+		{72 * time.Hour, "3 days"},
+		{90 * time.Second, "1m30s"},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, formatTTL(tt.ttl), tt.ttl.String())
+	}
+}
+
+// loginStores fake just enough of the stores for a login with two-factor
+// authentication, the pending tokens handed out are kept in memory.
+type loginStores struct {
+	store.UserStore
+	store.TokenStore
+	store.TwoFactorStore
+	user    *store.User
+	pending map[string]bool
+}
+
+func (s *loginStores) GetUserByusername(ctx context.Context, username string) (*store.User, error) {
+	if username != s.user.Username {
+		return nil, nil
+	}
+	return s.user, nil
+}
+
+func (s *loginStores) GetUserToken(ctx context.Context, scope, plainTextPassword string) (*store.User, error) {
+	if scope != tokens.Scope2FAPending || !s.pending[plainTextPassword] {
+		return nil, nil
+	}
+	return s.user, nil
+}
+
+func (s *loginStores) CreateNewToken(ctx context.Context, userID int, ttl time.Duration, scope string) (*tokens.Token, error) {
+	token, err := tokens.GenerateToken(userID, ttl, scope)
+	if err != nil {
+		return nil, err
+	}
+	s.pending[token.Plaintext] = true
+	return token, nil
+}
+
+func (s *loginStores) DeleteAllTokensForUser(ctx context.Context, userID int, scope string) error {
+	clear(s.pending)
+	return nil
+}
+
+func (s *loginStores) GetTwoFactor(userID int) (*store.TwoFactor, error) {
+	return &store.TwoFactor{UserID: userID, Secret: "JBSWY3DPEHPK3PXP", Enabled: true}, nil
+}
+
+func (s *loginStores) UseRecoveryCode(userID int, code string) (bool, error) {
+	return false, nil
+}
+
+func TestTwoFactorGuessesAreThrottled(t *testing.T) {
+	user := &store.User{ID: 1, Username: "jane"}
+	require.NoError(t, store.NewPostgresUserStore(nil, bcrypt.MinCost).SetPassword(user, "correct horse"))
+	stores := &loginStores{user: user, pending: map[string]bool{}}
+
+	limiter := auth.NewLoginLimiter(store.NewMemoryLoginAttemptStore(), auth.LoginLimits{
+		UserFreeAttempts: 3,
+		IPFreeAttempts:   10,
+		BaseDelay:        time.Minute,
+		MaxDelay:         time.Hour,
+		Window:           time.Hour,
+	})
+	h := NewTokenHandler(stores, nil, stores, stores, limiter, TokenTTLs{TwoFactorPending: time.Minute}, metrics.New(nil), nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	post := func(handler http.HandlerFunc, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		rr := httptest.NewRecorder()
+		handler(rr, req)
+		return rr
+	}
+
+	// the password is right every time, only the codes are guessed
+	for i := 0; i < 3; i++ {
+		rr := post(h.HandleCreateToken, `{"username": "jane", "password": "correct horse"}`)
+		require.Equal(t, http.StatusOK, rr.Code, "login %d", i+1)
+		var resp struct {
+			PendingToken struct {
+				Token string `json:"token"`
+			} `json:"pending_token"`
+		}
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+
+		rr = post(h.HandleVerifyTwoFactor, `{"pending_token": "`+resp.PendingToken.Token+`", "recovery_code": "wrong"}`)
+		require.Equal(t, http.StatusUnauthorized, rr.Code, "code %d", i+1)
+	}
+
+	rr := post(h.HandleCreateToken, `{"username": "jane", "password": "correct horse"}`)
+	assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+	assert.Equal(t, "60", rr.Header().Get("Retry-After"))
+}
@@ -0,0 +1,207 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/shiponcs/femProject/internal/middleware"
+	"github.com/shiponcs/femProject/internal/store"
+	"github.com/shiponcs/femProject/internal/totp"
+	"github.com/shiponcs/femProject/utils"
+)
+
+const (
+	totpIssuer        = "Workouts"
+	recoveryCodeCount = 10
+)
+
+type TwoFactorHandler struct {
+	twoFactorStore store.TwoFactorStore
+	logger         *slog.Logger
+}
+
+func NewTwoFactorHandler(twoFactorStore store.TwoFactorStore, logger *slog.Logger) *TwoFactorHandler {
+	return &TwoFactorHandler{
+		twoFactorStore: twoFactorStore,
+		logger:         logger,
+	}
+}
+
+type twoFactorCodeRequest struct {
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+// generateRecoveryCodes returns codes formatted like "k3v9q-m2xpa".
+func generateRecoveryCodes() ([]string, error) {
+	encoding := base32.StdEncoding.WithPadding(base32.NoPadding)
+	codes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		random := make([]byte, 7)
+		_, err := rand.Read(random)
+		if err != nil {
+			return nil, err
+		}
+		code := strings.ToLower(encoding.EncodeToString(random))[:10]
+		codes[i] = code[:5] + "-" + code[5:]
+	}
+	return codes, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	code = strings.ReplaceAll(code, "-", "")
+	return strings.ReplaceAll(code, " ", "")
+}
+
+// verifySecondFactor checks a TOTP code, or else a recovery code, of a
+// user with two-factor authentication enabled. Accepted codes are used up.
+func verifySecondFactor(twoFactorStore store.TwoFactorStore, twoFactor *store.TwoFactor, req twoFactorCodeRequest) (bool, error) {
+	if req.Code != "" {
+		step, ok := totp.Validate(twoFactor.Secret, req.Code, time.Now())
+		if !ok {
+			return false, nil
+		}
+		return twoFactorStore.AcceptStep(twoFactor.UserID, step)
+	}
+	if req.RecoveryCode != "" {
+		return twoFactorStore.UseRecoveryCode(twoFactor.UserID, normalizeRecoveryCode(req.RecoveryCode))
+	}
+	return false, nil
+}
+
+// HandleStartEnrollment creates a new TOTP secret for the current user. It
+// only protects logins after HandleConfirmEnrollment.
+func (h *TwoFactorHandler) HandleStartEnrollment(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "GenerateSecret", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	err = h.twoFactorStore.StartEnrollment(currentUser.ID, secret)
+	if errors.Is(err, store.ErrTwoFactorEnabled) {
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "StartEnrollment", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{
+		"secret":      secret,
+		"otpauth_uri": totp.URI(totpIssuer, currentUser.Username, secret),
+	})
+}
+
+// HandleConfirmEnrollment enables two-factor authentication once the user
+// sends a code from their authenticator, and returns the recovery codes.
+// They are shown only this once.
+func (h *TwoFactorHandler) HandleConfirmEnrollment(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+
+	var req twoFactorCodeRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil || req.Code == "" {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "code is required"})
+		return
+	}
+
+	twoFactor, err := h.twoFactorStore.GetTwoFactor(currentUser.ID)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "GetTwoFactor", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	if twoFactor == nil {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "start the enrollment first"})
+		return
+	}
+	if twoFactor.Enabled {
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": store.ErrTwoFactorEnabled.Error()})
+		return
+	}
+
+	step, ok := totp.Validate(twoFactor.Secret, req.Code, time.Now())
+	if !ok {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid code"})
+		return
+	}
+
+	codes, err := generateRecoveryCodes()
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "generateRecoveryCodes", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	normalized := make([]string, len(codes))
+	for i, code := range codes {
+		normalized[i] = normalizeRecoveryCode(code)
+	}
+
+	err = h.twoFactorStore.ConfirmEnrollment(currentUser.ID, step, normalized)
+	if errors.Is(err, store.ErrTwoFactorEnabled) {
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "ConfirmEnrollment", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"recovery_codes": codes})
+}
+
+// HandleDisable turns two-factor authentication off, which takes a current
+// code or a recovery code.
+func (h *TwoFactorHandler) HandleDisable(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+
+	var req twoFactorCodeRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request payload"})
+		return
+	}
+
+	twoFactor, err := h.twoFactorStore.GetTwoFactor(currentUser.ID)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "GetTwoFactor", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	if twoFactor != nil && twoFactor.Enabled {
+		ok, err := verifySecondFactor(h.twoFactorStore, twoFactor, req)
+		if err != nil {
+			h.logger.ErrorContext(r.Context(), "verifySecondFactor", "error", err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+			return
+		}
+		if !ok {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid code"})
+			return
+		}
+	}
+
+	err = h.twoFactorStore.DisableTwoFactor(currentUser.ID)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "DisableTwoFactor", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
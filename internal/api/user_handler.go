@@ -1,13 +1,18 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
-	"log"
+	"log/slog"
 	"net/http"
 	"regexp"
+	"time"
 
+	"github.com/shiponcs/femProject/internal/auth"
+	"github.com/shiponcs/femProject/internal/mailer"
 	"github.com/shiponcs/femProject/internal/store"
+	"github.com/shiponcs/femProject/internal/tokens"
 	"github.com/shiponcs/femProject/utils"
 )
 
@@ -19,14 +24,23 @@ type registerUserRequest struct {
 }
 
 type UserHandler struct {
-	userStore store.UserStore
-	logger    *log.Logger
+	userStore    store.UserStore
+	tokenStore   store.TokenStore
+	accessTokens auth.AccessTokens
+	mailer       mailer.Mailer
+	logger       *slog.Logger
+	// activationTTL is how long an emailed activation token is valid.
+	activationTTL time.Duration
 }
 
-func NewUserHandler(userStore store.UserStore, logger *log.Logger) *UserHandler {
+func NewUserHandler(userStore store.UserStore, tokenStore store.TokenStore, accessTokens auth.AccessTokens, activationTTL time.Duration, mailer mailer.Mailer, logger *slog.Logger) *UserHandler {
 	return &UserHandler{
-		userStore: userStore,
-		logger:    logger,
+		userStore:     userStore,
+		tokenStore:    tokenStore,
+		accessTokens:  accessTokens,
+		mailer:        mailer,
+		logger:        logger,
+		activationTTL: activationTTL,
 	}
 }
 
@@ -48,10 +62,20 @@ func (h *UserHandler) validateRegisterUserRequest(req *registerUserRequest) erro
 		return errors.New("invalid email address")
 	}
 
-	if req.Password == "" {
+	return validatePassword(req.Password)
+}
+
+// validatePassword checks a new password, at registration and reset alike.
+// bcrypt only accepts up to 72 bytes.
+func validatePassword(password string) error {
+	if password == "" {
 		return errors.New("password is empty")
 	}
 
+	if len(password) > 72 {
+		return errors.New("password can't be longer than 72 bytes")
+	}
+
 	return nil
 }
 
@@ -60,14 +84,15 @@ func (h *UserHandler) HandleRegisterUser(w http.ResponseWriter, r *http.Request)
 
 	err := json.NewDecoder(r.Body).Decode(&req)
 	if err != nil {
-		h.logger.Printf("ERROR: decoding request register request: %v", err)
+		h.logger.ErrorContext(r.Context(), "decoding request register request", "error", err)
 		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalidd request payload"})
 		return
 	}
 
 	err = h.validateRegisterUserRequest(&req)
 	if err != nil {
-		utils.WriteJSON(w, http.StatusBadGateway, utils.Envelope{"error": err.Error()})
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
 	}
 
 	user := &store.User{
@@ -79,19 +104,137 @@ func (h *UserHandler) HandleRegisterUser(w http.ResponseWriter, r *http.Request)
 		user.Bio = req.Bio
 	}
 
-	err = user.PasswordHash.Set(req.Password)
+	err = h.userStore.SetPassword(user, req.Password)
 	if err != nil {
-		h.logger.Printf("ERROR: hasing password %v", err)
+		h.logger.ErrorContext(r.Context(), "hashing password", "error", err)
 		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error:": "internal server error"})
 		return
 	}
 
-	err = h.userStore.CreateUser(user)
+	err = h.userStore.CreateUser(r.Context(), user)
 	if err != nil {
-		h.logger.Printf("ERROR: create user %v", err)
+		h.logger.ErrorContext(r.Context(), "create user", "error", err)
 		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error:": "internal server error"})
 		return
 	}
 
+	token, err := h.tokenStore.CreateNewToken(r.Context(), user.ID, h.activationTTL, tokens.ScopeActivation)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "creating activation token", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	ctx := context.WithoutCancel(r.Context())
+	background(h.logger, func() {
+		data := map[string]any{
+			"Username":  user.Username,
+			"Token":     token.Plaintext,
+			"ExpiresIn": formatTTL(h.activationTTL),
+		}
+		err := h.mailer.Send(user.Email, "user_welcome.tmpl", data)
+		if err != nil {
+			h.logger.ErrorContext(ctx, "sending activation email", "error", err)
+		}
+	})
+
 	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"user": user})
 }
+
+// HandleActivateUser activates the account of the emailed activation token.
+func (h *UserHandler) HandleActivateUser(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Token string `json:"token"`
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil || req.Token == "" {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "token is required"})
+		return
+	}
+
+	user, err := h.userStore.GetUserToken(r.Context(), tokens.ScopeActivation, req.Token)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "GetUserToken", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	if user == nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid or expired activation token"})
+		return
+	}
+
+	user.Activated = true
+	err = h.userStore.UpdateUser(r.Context(), user)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "UpdateUser", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	err = h.tokenStore.DeleteAllTokensForUser(r.Context(), user.ID, tokens.ScopeActivation)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "DeleteAllTokensForUser", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"user": user})
+}
+
+// HandleUpdatePassword sets a new password with a token from
+// POST /tokens/password-reset and logs the user out everywhere.
+func (h *UserHandler) HandleUpdatePassword(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Password string `json:"password"`
+		Token    string `json:"token"`
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request payload"})
+		return
+	}
+	if req.Token == "" {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "token is required"})
+		return
+	}
+	if err := validatePassword(req.Password); err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	user, err := h.userStore.GetUserToken(r.Context(), tokens.ScopePasswordReset, req.Token)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "GetUserToken", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	if user == nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid or expired password reset token"})
+		return
+	}
+
+	err = h.userStore.SetPassword(user, req.Password)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "hashing password", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	err = h.userStore.UpdatePassword(r.Context(), user)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "UpdatePassword", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	err = logOutEverywhere(r.Context(), h.tokenStore, h.accessTokens, user.ID, tokens.ScopePasswordReset)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "logOutEverywhere", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"message": "your password was reset, please log in again"})
+}
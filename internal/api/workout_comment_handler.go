@@ -0,0 +1,78 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/shiponcs/femProject/internal/middleware"
+	"github.com/shiponcs/femProject/internal/policy"
+	"github.com/shiponcs/femProject/internal/store"
+	"github.com/shiponcs/femProject/utils"
+)
+
+const maxCommentLength = 2000
+
+type workoutCommentRequest struct {
+	Body string `json:"body"`
+}
+
+func (wh *WorkoutHandler) HandleListWorkoutComments(w http.ResponseWriter, r *http.Request) {
+	workoutID, err := utils.ReadParam(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid workout id"})
+		return
+	}
+
+	if !wh.authorizeWorkout(w, r, workoutID, policy.ReadWorkout) {
+		return
+	}
+
+	comments, err := wh.commentStore.ListComments(workoutID)
+	if err != nil {
+		wh.logger.ErrorContext(r.Context(), "ListComments", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"comments": comments})
+}
+
+func (wh *WorkoutHandler) HandleCreateWorkoutComment(w http.ResponseWriter, r *http.Request) {
+	workoutID, err := utils.ReadParam(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid workout id"})
+		return
+	}
+
+	var req workoutCommentRequest
+	err = json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request payload"})
+		return
+	}
+
+	req.Body = strings.TrimSpace(req.Body)
+	if req.Body == "" || len(req.Body) > maxCommentLength {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "body must be between 1 and 2000 characters"})
+		return
+	}
+
+	if !wh.authorizeWorkout(w, r, workoutID, policy.CommentWorkout) {
+		return
+	}
+
+	comment := &store.WorkoutComment{
+		WorkoutID: workoutID,
+		UserID:    middleware.GetUser(r).ID,
+		Body:      req.Body,
+	}
+	err = wh.commentStore.CreateComment(comment)
+	if err != nil {
+		wh.logger.ErrorContext(r.Context(), "CreateComment", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"comment": comment})
+}
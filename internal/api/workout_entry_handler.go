@@ -0,0 +1,318 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/shiponcs/femProject/internal/middleware"
+	"github.com/shiponcs/femProject/internal/policy"
+	"github.com/shiponcs/femProject/internal/store"
+	"github.com/shiponcs/femProject/utils"
+)
+
+type workoutEntryRequest struct {
+	ExerciseID      *int               `json:"exercise_id"`
+	ExerciseName    *string            `json:"exercise_name"`
+	Sets            *int               `json:"sets"`
+	Reps            *int               `json:"reps"`
+	DurationSeconds *int               `json:"duration_seconds"`
+	Weight          *float64           `json:"weight"`
+	Notes           *string            `json:"notes"`
+	OrderIndex      *int               `json:"order_index"`
+	Group           *store.EntryGroup  `json:"group"`
+	SetsDetail      []store.WorkoutSet `json:"sets_detail"`
+	Version         int                `json:"version"`
+}
+
+// apply copies the fields present in the request onto entry. Setting reps
+// clears duration_seconds and the other way around, so an entry can switch
+// between being rep based and time based. A new exercise_name drops the
+// previous exercise_id so the store resolves the name again. An empty group
+// object takes the entry out of its group.
+func (req *workoutEntryRequest) apply(entry *store.WorkoutEntry) {
+	if req.ExerciseName != nil {
+		entry.ExerciseName = *req.ExerciseName
+		entry.ExerciseID = 0
+	}
+	if req.ExerciseID != nil {
+		entry.ExerciseID = *req.ExerciseID
+	}
+	if req.Sets != nil {
+		entry.Sets = *req.Sets
+	}
+	if req.Reps != nil {
+		entry.Reps = req.Reps
+		entry.DurationSeconds = nil
+	}
+	if req.DurationSeconds != nil {
+		entry.DurationSeconds = req.DurationSeconds
+		entry.Reps = nil
+	}
+	if req.Weight != nil {
+		entry.Weight = req.Weight
+	}
+	if req.Notes != nil {
+		entry.Notes = *req.Notes
+	}
+	if req.OrderIndex != nil {
+		entry.OrderIndex = *req.OrderIndex
+	}
+	if req.Group != nil {
+		entry.Group = req.Group
+	}
+	if req.SetsDetail != nil {
+		entry.SetsDetail = req.SetsDetail
+		entry.DeriveAggregates()
+	}
+}
+
+// validateWorkoutSets only checks the per-set details, the aggregate fields
+// of whole workouts are validated by the database as before.
+func validateWorkoutSets(entries []store.WorkoutEntry) error {
+	for i := range entries {
+		if err := entries[i].ValidateSets(); err != nil {
+			return fmt.Errorf("entries[%d].%w", i, err)
+		}
+	}
+	return nil
+}
+
+func validateWorkoutEntry(entry *store.WorkoutEntry) error {
+	if entry.ExerciseName == "" && entry.ExerciseID == 0 {
+		return errors.New("exercise_name or exercise_id is required")
+	}
+	if err := entry.ValidateSets(); err != nil {
+		return err
+	}
+	if entry.Sets < 1 {
+		return errors.New("sets must be at least 1")
+	}
+	if (entry.Reps == nil) == (entry.DurationSeconds == nil) {
+		return errors.New("exactly one of reps or duration_seconds is required")
+	}
+	return nil
+}
+
+// authorizeWorkout writes the error response itself and reports whether
+// the current user may perform action on the workout.
+func (wh *WorkoutHandler) authorizeWorkout(w http.ResponseWriter, r *http.Request, workoutID int64, action policy.Action) bool {
+	currentUser := middleware.GetUser(r)
+
+	workoutOwner, err := wh.workoutstore.GetWorkoutOwner(r.Context(), workoutID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "workout doesn't exist"})
+			return false
+		}
+		wh.logger.ErrorContext(r.Context(), "GetWorkoutOwner", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return false
+	}
+
+	err = wh.policy.AuthorizeWorkout(r.Context(), currentUser, action, workoutOwner)
+	if errors.Is(err, policy.ErrForbidden) {
+		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "you are not authorized to " + workoutActions[action] + " this workout"})
+		return false
+	}
+	if err != nil {
+		wh.logger.ErrorContext(r.Context(), "AuthorizeWorkout", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return false
+	}
+	return true
+}
+
+var workoutActions = map[policy.Action]string{
+	policy.ReadWorkout:    "read",
+	policy.UpdateWorkout:  "modify",
+	policy.DeleteWorkout:  "delete",
+	policy.CommentWorkout: "comment on",
+}
+
+func (wh *WorkoutHandler) writeEntryStoreError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, store.ErrEditConflict):
+		wh.metrics.EditConflict()
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "the workout was modified by another request, reload and retry"})
+	case errors.Is(err, store.ErrInvalidEntryOrder), errors.Is(err, store.ErrUnknownExercise), errors.Is(err, store.ErrInvalidEntryGroups):
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+	case errors.Is(err, sql.ErrNoRows):
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "workout entry not found"})
+	default:
+		wh.logger.ErrorContext(r.Context(), "workout entry", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+	}
+}
+
+func (wh *WorkoutHandler) HandleCreateWorkoutEntry(w http.ResponseWriter, r *http.Request) {
+	workoutID, err := utils.ReadParam(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid workout id"})
+		return
+	}
+
+	var req workoutEntryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request payload"})
+		return
+	}
+
+	entry := &store.WorkoutEntry{}
+	req.apply(entry)
+	if err := validateWorkoutEntry(entry); err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	if !wh.authorizeWorkout(w, r, workoutID, policy.UpdateWorkout) {
+		return
+	}
+
+	version, err := wh.workoutstore.CreateWorkoutEntry(r.Context(), workoutID, req.Version, entry)
+	if err != nil {
+		wh.writeEntryStoreError(w, r, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"entry": entry, "version": version})
+}
+
+func (wh *WorkoutHandler) HandleUpdateWorkoutEntry(w http.ResponseWriter, r *http.Request) {
+	workoutID, err := utils.ReadParam(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid workout id"})
+		return
+	}
+	entryID, err := utils.ReadNamedParam(r, "entryID")
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid entry id"})
+		return
+	}
+
+	var req workoutEntryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request payload"})
+		return
+	}
+
+	if !wh.authorizeWorkout(w, r, workoutID, policy.UpdateWorkout) {
+		return
+	}
+
+	workout, err := wh.workoutstore.GetWorkoutByID(r.Context(), workoutID)
+	if err != nil {
+		wh.logger.ErrorContext(r.Context(), "GetWorkoutByID", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	if workout == nil {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "workout doesn't exist"})
+		return
+	}
+
+	var entry *store.WorkoutEntry
+	for i := range workout.Entries {
+		if int64(workout.Entries[i].ID) == entryID {
+			entry = &workout.Entries[i]
+			break
+		}
+	}
+	if entry == nil {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "workout entry not found"})
+		return
+	}
+
+	// the stored sets are only replaced when the request sends sets_detail,
+	// so they keep their IDs
+	storedSets := entry.SetsDetail
+	entry.SetsDetail = nil
+	req.apply(entry)
+	if err := validateWorkoutEntry(entry); err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	version, err := wh.workoutstore.UpdateWorkoutEntry(r.Context(), workoutID, req.Version, entry)
+	if err != nil {
+		wh.writeEntryStoreError(w, r, err)
+		return
+	}
+	if entry.SetsDetail == nil {
+		// answer with what a read returns, the sets win over the aggregates
+		entry.SetsDetail = storedSets
+		entry.DeriveAggregates()
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"entry": entry, "version": version})
+}
+
+func (wh *WorkoutHandler) HandleDeleteWorkoutEntry(w http.ResponseWriter, r *http.Request) {
+	workoutID, err := utils.ReadParam(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid workout id"})
+		return
+	}
+	entryID, err := utils.ReadNamedParam(r, "entryID")
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid entry id"})
+		return
+	}
+
+	version, err := strconv.Atoi(r.URL.Query().Get("version"))
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "the version query parameter is required"})
+		return
+	}
+
+	if !wh.authorizeWorkout(w, r, workoutID, policy.UpdateWorkout) {
+		return
+	}
+
+	newVersion, err := wh.workoutstore.DeleteWorkoutEntry(r.Context(), workoutID, entryID, version)
+	if err != nil {
+		wh.writeEntryStoreError(w, r, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"version": newVersion})
+}
+
+func (wh *WorkoutHandler) HandleReorderWorkoutEntries(w http.ResponseWriter, r *http.Request) {
+	workoutID, err := utils.ReadParam(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid workout id"})
+		return
+	}
+
+	var req struct {
+		EntryIDs []int64 `json:"entry_ids"`
+		Version  int     `json:"version"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request payload"})
+		return
+	}
+
+	if !wh.authorizeWorkout(w, r, workoutID, policy.UpdateWorkout) {
+		return
+	}
+
+	_, err = wh.workoutstore.ReorderWorkoutEntries(r.Context(), workoutID, req.Version, req.EntryIDs)
+	if err != nil {
+		wh.writeEntryStoreError(w, r, err)
+		return
+	}
+
+	workout, err := wh.workoutstore.GetWorkoutByID(r.Context(), workoutID)
+	if err != nil {
+		wh.logger.ErrorContext(r.Context(), "GetWorkoutByID", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"workout": workout})
+}
@@ -4,22 +4,33 @@ import (
 	"database/sql"
 	"encoding/json"
 	"errors"
-	"log"
+	"fmt"
+	"log/slog"
+	"math"
 	"net/http"
+	"time"
 
+	"github.com/shiponcs/femProject/internal/metrics"
 	"github.com/shiponcs/femProject/internal/middleware"
+	"github.com/shiponcs/femProject/internal/policy"
 	"github.com/shiponcs/femProject/internal/store"
 	"github.com/shiponcs/femProject/utils"
 )
 
 type WorkoutHandler struct {
 	workoutstore store.WorkoutStore
-	logger       *log.Logger
+	commentStore store.WorkoutCommentStore
+	policy       *policy.Policy
+	metrics      *metrics.Metrics
+	logger       *slog.Logger
 }
 
-func NewWorkoutHandler(workoutStore store.WorkoutStore, logger *log.Logger) *WorkoutHandler {
+func NewWorkoutHandler(workoutStore store.WorkoutStore, commentStore store.WorkoutCommentStore, policy *policy.Policy, metrics *metrics.Metrics, logger *slog.Logger) *WorkoutHandler {
 	return &WorkoutHandler{
 		workoutstore: workoutStore,
+		commentStore: commentStore,
+		policy:       policy,
+		metrics:      metrics,
 		logger:       logger,
 	}
 }
@@ -27,14 +38,18 @@ func NewWorkoutHandler(workoutStore store.WorkoutStore, logger *log.Logger) *Wor
 func (wh *WorkoutHandler) HandleGetWorkoutByID(w http.ResponseWriter, r *http.Request) {
 	workoutID, err := utils.ReadParam(r)
 	if err != nil {
-		wh.logger.Printf("ERROR: readIDParam: %v", err)
+		wh.logger.ErrorContext(r.Context(), "readIDParam", "error", err)
 		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid workout id"})
 		return
 	}
 
-	workout, err := wh.workoutstore.GetWorkoutByID(workoutID)
+	if !wh.authorizeWorkout(w, r, workoutID, policy.ReadWorkout) {
+		return
+	}
+
+	workout, err := wh.workoutstore.GetWorkoutByID(r.Context(), workoutID)
 	if err != nil {
-		wh.logger.Printf("ERROR: GetWorkoutByID: %v", err)
+		wh.logger.ErrorContext(r.Context(), "GetWorkoutByID", "error", err)
 		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
 		return
 	}
@@ -42,10 +57,135 @@ func (wh *WorkoutHandler) HandleGetWorkoutByID(w http.ResponseWriter, r *http.Re
 	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"workout": workout})
 }
 
+func (wh *WorkoutHandler) readWorkoutFilter(r *http.Request) (store.WorkoutFilter, error) {
+	query := r.URL.Query()
+	filter := store.WorkoutFilter{
+		Title:  query.Get("title"),
+		Sort:   query.Get("sort"),
+		Cursor: query.Get("cursor"),
+	}
+
+	var err error
+	if filter.MinDuration, err = utils.ReadQueryInt(r, "min_duration"); err != nil {
+		return filter, err
+	}
+	if filter.MaxDuration, err = utils.ReadQueryInt(r, "max_duration"); err != nil {
+		return filter, err
+	}
+	if filter.MinCalories, err = utils.ReadQueryInt(r, "min_calories"); err != nil {
+		return filter, err
+	}
+	if filter.MaxCalories, err = utils.ReadQueryInt(r, "max_calories"); err != nil {
+		return filter, err
+	}
+	if filter.CreatedAfter, err = utils.ReadQueryTime(r, "created_after"); err != nil {
+		return filter, err
+	}
+	if filter.CreatedBefore, err = utils.ReadQueryTime(r, "created_before"); err != nil {
+		return filter, err
+	}
+	if filter.PerformedAfter, err = utils.ReadQueryTime(r, "performed_after"); err != nil {
+		return filter, err
+	}
+	if filter.PerformedBefore, err = utils.ReadQueryTime(r, "performed_before"); err != nil {
+		return filter, err
+	}
+
+	limit, err := utils.ReadQueryInt(r, "limit")
+	if err != nil {
+		return filter, err
+	}
+	if limit != nil {
+		if *limit < 1 || *limit > store.MaxWorkoutListLimit {
+			return filter, fmt.Errorf("limit must be between 1 and %d", store.MaxWorkoutListLimit)
+		}
+		filter.Limit = *limit
+	}
+
+	return filter, nil
+}
+
+// validateWorkoutInterval derives duration_minutes from performed_at and
+// ended_at when it is missing, otherwise both must agree to the minute.
+func validateWorkoutInterval(workout *store.Workout) error {
+	if workout.EndedAt == nil {
+		return nil
+	}
+	if workout.PerformedAt.IsZero() {
+		return errors.New("performed_at is required when ended_at is given")
+	}
+	if workout.EndedAt.Before(workout.PerformedAt) {
+		return errors.New("ended_at can't be before performed_at")
+	}
+
+	minutes := workout.EndedAt.Sub(workout.PerformedAt).Minutes()
+	if workout.DurationMinutes == 0 {
+		workout.DurationMinutes = int(math.Round(minutes))
+		return nil
+	}
+	if math.Abs(float64(workout.DurationMinutes)-minutes) > 1 {
+		return fmt.Errorf("duration_minutes (%d) doesn't match the interval between performed_at and ended_at (%.0f)", workout.DurationMinutes, minutes)
+	}
+	return nil
+}
+
+func (wh *WorkoutHandler) HandleListWorkouts(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+
+	filter, err := wh.readWorkoutFilter(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+	filter.UserID = currentUser.ID
+
+	page, err := wh.workoutstore.ListWorkouts(r.Context(), filter)
+	if err != nil {
+		if errors.Is(err, store.ErrInvalidCursor) || errors.Is(err, store.ErrInvalidSort) {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+			return
+		}
+		wh.logger.ErrorContext(r.Context(), "ListWorkouts", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"workouts": page.Workouts, "next_cursor": page.NextCursor})
+}
+
+// HandleListAthleteWorkouts lists the workouts of an athlete the current
+// user coaches, with the same filters as HandleListWorkouts.
+func (wh *WorkoutHandler) HandleListAthleteWorkouts(w http.ResponseWriter, r *http.Request) {
+	athleteID, ok := authorizeAthlete(w, r, wh.policy, wh.logger)
+	if !ok {
+		return
+	}
+
+	filter, err := wh.readWorkoutFilter(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+	filter.UserID = athleteID
+
+	page, err := wh.workoutstore.ListWorkouts(r.Context(), filter)
+	if err != nil {
+		if errors.Is(err, store.ErrInvalidCursor) || errors.Is(err, store.ErrInvalidSort) {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+			return
+		}
+		wh.logger.ErrorContext(r.Context(), "ListWorkouts", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"workouts": page.Workouts, "next_cursor": page.NextCursor})
+}
+
 func (wh *WorkoutHandler) HandleCreateWorkout(w http.ResponseWriter, r *http.Request) {
 	var workout store.Workout
 	if err := json.NewDecoder(r.Body).Decode(&workout); err != nil {
-		wh.logger.Printf("ERROR: HandleCreateWorkout: %v", err)
+		wh.logger.ErrorContext(r.Context(), "HandleCreateWorkout", "error", err)
 		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request"})
 		return
 	}
@@ -58,48 +198,70 @@ func (wh *WorkoutHandler) HandleCreateWorkout(w http.ResponseWriter, r *http.Req
 
 	workout.UserID = currentUser.ID
 
-	createdWorkout, err := wh.workoutstore.CreateWorkout(&workout)
+	if err := validateWorkoutInterval(&workout); err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+	if err := validateWorkoutSets(workout.Entries); err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+	if err := store.ValidateEntryGroups(workout.Entries); err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	createdWorkout, err := wh.workoutstore.CreateWorkout(r.Context(), &workout)
+	if errors.Is(err, store.ErrUnknownExercise) || errors.Is(err, store.ErrInvalidEntryGroups) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
 	if err != nil {
-		wh.logger.Printf("ERROR: HandleCreateWorkout: %v", err)
+		wh.logger.ErrorContext(r.Context(), "HandleCreateWorkout", "error", err)
 		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to create workout"})
 		return
 	}
 
+	wh.metrics.WorkoutCreated()
 	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"workout": createdWorkout})
 }
 
 func (wh *WorkoutHandler) HandleUpdateWorkoutByID(w http.ResponseWriter, r *http.Request) {
 	workoutID, err := utils.ReadParam(r)
 	if err != nil {
-		wh.logger.Printf("ERROR: HandleUpdateWorkoutByID: %v", err)
+		wh.logger.ErrorContext(r.Context(), "HandleUpdateWorkoutByID", "error", err)
 		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid workout id"})
 		return
 	}
 
-	existingWorkout, err := wh.workoutstore.GetWorkoutByID(workoutID)
+	existingWorkout, err := wh.workoutstore.GetWorkoutByID(r.Context(), workoutID)
 	if err != nil {
-		wh.logger.Printf("ERROR: HandleUpdateWorkoutByID: %v", err)
+		wh.logger.ErrorContext(r.Context(), "HandleUpdateWorkoutByID", "error", err)
 		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to fetch workout"})
 		return
 	}
 	if existingWorkout == nil {
-		wh.logger.Printf("ERROR: HandleUpdateWorkoutByID: %v", err)
+		wh.logger.ErrorContext(r.Context(), "HandleUpdateWorkoutByID", "error", err)
 		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "no workout found"})
 		return
 	}
 
+	// ended_at stays raw so an explicit null, which clears it, can be told
+	// apart from leaving it out
 	var updateWorkoutRequest struct {
 		Title           *string              `json:"title"`
 		Description     *string              `json:"description"`
 		DurationMinutes *int                 `json:"duration_minutes"`
 		CaloriesBurned  *int                 `json:"calories_burned"`
+		PerformedAt     *time.Time           `json:"performed_at"`
+		EndedAt         json.RawMessage      `json:"ended_at"`
 		Entries         []store.WorkoutEntry `json:"entries"`
 		Version         int                  `json:"version"`
 	}
 
 	err = json.NewDecoder(r.Body).Decode(&updateWorkoutRequest)
 	if err != nil {
-		wh.logger.Printf("ERROR: HandleUpdateWorkoutByID: %v", err)
+		wh.logger.ErrorContext(r.Context(), "HandleUpdateWorkoutByID", "error", err)
 		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "can't decode the request"})
 		return
 	}
@@ -118,8 +280,40 @@ func (wh *WorkoutHandler) HandleUpdateWorkoutByID(w http.ResponseWriter, r *http
 	if updateWorkoutRequest.CaloriesBurned != nil {
 		existingWorkout.CaloriesBurned = *updateWorkoutRequest.CaloriesBurned
 	}
+	if updateWorkoutRequest.PerformedAt != nil {
+		existingWorkout.PerformedAt = *updateWorkoutRequest.PerformedAt
+	}
+	if updateWorkoutRequest.EndedAt != nil {
+		var endedAt *time.Time
+		if err := json.Unmarshal(updateWorkoutRequest.EndedAt, &endedAt); err != nil {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "ended_at must be an RFC 3339 time or null"})
+			return
+		}
+		existingWorkout.EndedAt = endedAt
+	}
+	// entries that aren't sent are kept as they are, their sets included
+	var storedSets [][]store.WorkoutSet
 	if updateWorkoutRequest.Entries != nil {
 		existingWorkout.Entries = updateWorkoutRequest.Entries
+	} else {
+		storedSets = make([][]store.WorkoutSet, len(existingWorkout.Entries))
+		for i := range existingWorkout.Entries {
+			storedSets[i] = existingWorkout.Entries[i].SetsDetail
+			existingWorkout.Entries[i].SetsDetail = nil
+		}
+	}
+
+	if err := validateWorkoutInterval(existingWorkout); err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+	if err := validateWorkoutSets(existingWorkout.Entries); err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+	if err := store.ValidateEntryGroups(existingWorkout.Entries); err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
 	}
 
 	currentUser := middleware.GetUser(r)
@@ -128,35 +322,38 @@ func (wh *WorkoutHandler) HandleUpdateWorkoutByID(w http.ResponseWriter, r *http
 		return
 	}
 
-	workoutOwner, err := wh.workoutstore.GetWorkoutOwner(workoutID)
-	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "workout doesn't exist"})
-			return
-		}
-		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+	if !wh.authorizeWorkout(w, r, workoutID, policy.UpdateWorkout) {
 		return
 	}
 
-	if workoutOwner != currentUser.ID {
-		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "you are not authorized to update"})
+	err = wh.workoutstore.UpdateWorkout(r.Context(), existingWorkout)
+	if errors.Is(err, store.ErrUnknownExercise) || errors.Is(err, store.ErrInvalidEntryGroups) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, store.ErrEditConflict) {
+		wh.metrics.EditConflict()
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "the workout was modified by another request, reload and retry"})
 		return
 	}
-
-	err = wh.workoutstore.UpdateWorkout(existingWorkout)
 	if err != nil {
-		wh.logger.Printf("ERROR: HandleUpdateWorkoutByID: %v", err)
+		wh.logger.ErrorContext(r.Context(), "HandleUpdateWorkoutByID", "error", err)
 		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "can't update workout"})
 		return
 	}
 
+	for i := range storedSets {
+		existingWorkout.Entries[i].SetsDetail = storedSets[i]
+	}
+
+	wh.metrics.WorkoutUpdated()
 	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"workout": existingWorkout})
 }
 
 func (wh *WorkoutHandler) HandleDeleteWorkoutByID(w http.ResponseWriter, r *http.Request) {
 	workoutID, err := utils.ReadParam(r)
 	if err != nil {
-		wh.logger.Printf("ERROR: HandleDeleteWorkoutByID: %v", err)
+		wh.logger.ErrorContext(r.Context(), "HandleDeleteWorkoutByID", "error", err)
 		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid workout id"})
 		return
 	}
@@ -167,33 +364,23 @@ func (wh *WorkoutHandler) HandleDeleteWorkoutByID(w http.ResponseWriter, r *http
 		return
 	}
 
-	workoutOwner, err := wh.workoutstore.GetWorkoutOwner(workoutID)
-	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "workout doesn't exist"})
-			return
-		}
-		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
-		return
-	}
-
-	if workoutOwner != currentUser.ID {
-		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "you are not authorized to delete this workout"})
+	if !wh.authorizeWorkout(w, r, workoutID, policy.DeleteWorkout) {
 		return
 	}
 
-	err = wh.workoutstore.DeleteWorkoutByID(workoutID)
+	err = wh.workoutstore.DeleteWorkoutByID(r.Context(), workoutID)
 	if err == sql.ErrNoRows {
-		wh.logger.Printf("ERROR: HandleDeleteWorkoutByID: %v", err)
+		wh.logger.ErrorContext(r.Context(), "HandleDeleteWorkoutByID", "error", err)
 		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "workout not found"})
 		return
 	}
 	if err != nil {
-		wh.logger.Printf("ERROR: HandleDeleteWorkoutByID: %v", err)
+		wh.logger.ErrorContext(r.Context(), "HandleDeleteWorkoutByID", "error", err)
 		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Delete workout error"})
 		return
 	}
 
+	wh.metrics.WorkoutDeleted()
 	// w.WriteHeader(http.StatusNoContent)
 	utils.WriteJSON(w, http.StatusNoContent, utils.Envelope{})
 }
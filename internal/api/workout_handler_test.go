@@ -0,0 +1,68 @@
+package api
+
+import (
+	"testing"
+	"time"
+
+	"github.com/shiponcs/femProject/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateWorkoutInterval(t *testing.T) {
+	start := time.Date(2025, 6, 1, 7, 0, 0, 0, time.UTC)
+	at := func(minutes int) *time.Time {
+		t := start.Add(time.Duration(minutes) * time.Minute)
+		return &t
+	}
+
+	tests := []struct {
+		name         string
+		workout      store.Workout
+		wantErr      string
+		wantDuration int
+	}{
+		{
+			name:         "no end time",
+			workout:      store.Workout{PerformedAt: start, DurationMinutes: 45},
+			wantDuration: 45,
+		},
+		{
+			name:         "duration derived from the interval",
+			workout:      store.Workout{PerformedAt: start, EndedAt: at(30)},
+			wantDuration: 30,
+		},
+		{
+			name:         "duration within a minute of the interval",
+			workout:      store.Workout{PerformedAt: start, EndedAt: at(30), DurationMinutes: 31},
+			wantDuration: 31,
+		},
+		{
+			name:    "duration disagreeing with the interval",
+			workout: store.Workout{PerformedAt: start, EndedAt: at(30), DurationMinutes: 45},
+			wantErr: "duration_minutes (45) doesn't match the interval between performed_at and ended_at (30)",
+		},
+		{
+			name:    "end before start",
+			workout: store.Workout{PerformedAt: start, EndedAt: at(-5)},
+			wantErr: "ended_at can't be before performed_at",
+		},
+		{
+			name:    "end without start",
+			workout: store.Workout{EndedAt: at(30)},
+			wantErr: "performed_at is required when ended_at is given",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateWorkoutInterval(&tt.workout)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantDuration, tt.workout.DurationMinutes)
+		})
+	}
+}
@@ -1,59 +1,219 @@
 package app
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
+	"sync/atomic"
 
 	"github.com/shiponcs/femProject/internal/api"
+	"github.com/shiponcs/femProject/internal/auth"
+	"github.com/shiponcs/femProject/internal/config"
+	"github.com/shiponcs/femProject/internal/logging"
+	"github.com/shiponcs/femProject/internal/mailer"
+	"github.com/shiponcs/femProject/internal/metrics"
 	"github.com/shiponcs/femProject/internal/middleware"
+	"github.com/shiponcs/femProject/internal/policy"
 	"github.com/shiponcs/femProject/internal/store"
+	"github.com/shiponcs/femProject/internal/tracing"
 	"github.com/shiponcs/femProject/migrations"
+	"github.com/shiponcs/femProject/seeds"
 )
 
 type Application struct {
-	Logger         *log.Logger
-	WorkoutHandler *api.WorkoutHandler
-	UserHandler    *api.UserHandler
-	TokenHandler   *api.TokenHandler
-	MiddleWare     *middleware.UserMiddleware
-	DB             *sql.DB
+	Logger           *slog.Logger
+	WorkoutHandler   *api.WorkoutHandler
+	UserHandler      *api.UserHandler
+	TokenHandler     *api.TokenHandler
+	ExerciseHandler  *api.ExerciseHandler
+	TemplateHandler  *api.TemplateHandler
+	ProgramHandler   *api.ProgramHandler
+	RecordHandler    *api.RecordHandler
+	AnalyticsHandler *api.AnalyticsHandler
+	TwoFactorHandler *api.TwoFactorHandler
+	APIKeyHandler    *api.APIKeyHandler
+	AdminHandler     *api.AdminHandler
+	CoachHandler     *api.CoachHandler
+	MiddleWare       *middleware.UserMiddleware
+	Metrics          *metrics.Metrics
+	DB               *sql.DB
+	Config           *config.Config
+
+	shutdownTracing func(context.Context) error
+
+	// ready is false until the application is set up and again once it
+	// starts shutting down, see ReadinessCheck.
+	ready atomic.Bool
 }
 
-func NewApplication() (*Application, error) {
-	logger := log.New(os.Stdout, "", log.Ldate|log.Ltime)
-	pgDB, err := store.Open()
+func NewApplication(cfg *config.Config) (*Application, error) {
+	logger, err := logging.New(os.Stdout, cfg.LogLevel, cfg.LogFormat)
+	if err != nil {
+		return nil, err
+	}
+	// the stores have no logger of their own and log through the default
+	slog.SetDefault(logger)
+
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing, os.Stdout)
+	if err != nil {
+		return nil, err
+	}
+
+	pgDB, err := store.Open(cfg.DB.DSN, store.Pool{
+		MaxOpenConns:    cfg.DB.MaxOpenConns,
+		MaxIdleConns:    cfg.DB.MaxIdleConns,
+		ConnMaxLifetime: cfg.DB.ConnMaxLifetime,
+		ConnMaxIdleTime: cfg.DB.ConnMaxIdleTime,
+	})
 	if err != nil {
 		return nil, err
 	}
 	workoutStore := store.NewPostgresWorkoutStore(pgDB)
-	userStore := store.NewPostgresUserStore(pgDB)
+	userStore := store.NewPostgresUserStore(pgDB, cfg.Auth.BcryptCost)
 	tokenStore := store.NewPostgresTokenStore(pgDB)
+	exerciseStore := store.NewPostgresExerciseStore(pgDB)
+	templateStore := store.NewPostgresTemplateStore(pgDB)
+	programStore := store.NewPostgresProgramStore(pgDB)
+	recordStore := store.NewPostgresPersonalRecordStore(pgDB)
+	analyticsStore := store.NewPostgresAnalyticsStore(pgDB)
+	twoFactorStore := store.NewPostgresTwoFactorStore(pgDB)
+	apiKeyStore := store.NewPostgresAPIKeyStore(pgDB)
+	coachStore := store.NewPostgresCoachStore(pgDB)
+	commentStore := store.NewPostgresWorkoutCommentStore(pgDB)
+	assignmentStore := store.NewPostgresAssignmentStore(pgDB)
+	accessPolicy := policy.New(coachStore)
+	appMetrics := metrics.New(pgDB)
+
+	// emails are written to stdout until a mail server is configured
+	var mail mailer.Mailer = mailer.NewLogMailer(os.Stdout)
+	if cfg.SMTP.Host != "" {
+		mail = mailer.NewSMTPMailer(cfg.SMTP.Host, cfg.SMTP.Port, cfg.SMTP.Username, cfg.SMTP.Password, cfg.SMTP.Sender)
+	}
+
+	// access tokens are opaque rows in the tokens table unless the token
+	// backend is jwt, which needs JWT keys
+	accessTokens, err := auth.New(
+		cfg.Auth.TokenBackend,
+		tokenStore,
+		userStore,
+		cfg.Auth.AccessTokenTTL,
+		cfg.Auth.JWTAlgorithm,
+		cfg.Auth.JWTKeys,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	// failed logins are counted in Postgres so every instance sees them,
+	// the memory store keeps them in the process instead
+	var loginAttemptStore store.LoginAttemptStore = store.NewPostgresLoginAttemptStore(pgDB)
+	if cfg.Auth.LoginAttemptStore == "memory" {
+		loginAttemptStore = store.NewMemoryLoginAttemptStore()
+	}
+	loginLimiter := auth.NewLoginLimiter(loginAttemptStore, auth.LoginLimits{
+		UserFreeAttempts: cfg.Auth.LoginUserFreeAttempts,
+		IPFreeAttempts:   cfg.Auth.LoginIPFreeAttempts,
+		BaseDelay:        cfg.Auth.LoginBaseDelay,
+		MaxDelay:         cfg.Auth.LoginMaxDelay,
+		Window:           cfg.Auth.LoginWindow,
+	})
 
-	workoutHandler := api.NewWorkoutHandler(workoutStore, logger)
-	userHandler := api.NewUserHandler(userStore, logger)
-	tokenHandler := api.NewTokenHandler(tokenStore, userStore, logger)
-	middleWareHandler := middleware.UserMiddleware{UserStore: userStore}
+	workoutHandler := api.NewWorkoutHandler(workoutStore, commentStore, accessPolicy, appMetrics, logger)
+	userHandler := api.NewUserHandler(userStore, tokenStore, accessTokens, cfg.Auth.ActivationTokenTTL, mail, logger)
+	tokenHandler := api.NewTokenHandler(tokenStore, accessTokens, userStore, twoFactorStore, loginLimiter, api.TokenTTLs{
+		Refresh:          cfg.Auth.RefreshTokenTTL,
+		PasswordReset:    cfg.Auth.PasswordResetTokenTTL,
+		TwoFactorPending: cfg.Auth.TwoFactorPendingTTL,
+	}, appMetrics, mail, logger)
+	exerciseHandler := api.NewExerciseHandler(exerciseStore, logger)
+	templateHandler := api.NewTemplateHandler(templateStore, workoutStore, accessPolicy, appMetrics, logger)
+	programHandler := api.NewProgramHandler(programStore, templateStore, workoutStore, accessPolicy, logger)
+	recordHandler := api.NewRecordHandler(recordStore, logger)
+	analyticsHandler := api.NewAnalyticsHandler(analyticsStore, logger)
+	twoFactorHandler := api.NewTwoFactorHandler(twoFactorStore, logger)
+	apiKeyHandler := api.NewAPIKeyHandler(apiKeyStore, logger)
+	adminHandler := api.NewAdminHandler(userStore, tokenStore, accessTokens, loginLimiter, logger)
+	coachHandler := api.NewCoachHandler(coachStore, assignmentStore, userStore, templateStore, workoutStore, accessPolicy, appMetrics, mail, logger)
+	middleWareHandler := middleware.UserMiddleware{AccessTokens: accessTokens, APIKeyStore: apiKeyStore, Logger: logger}
 
 	err = store.MigrateFS(pgDB, migrations.FS, ".")
 	if err != nil {
 		panic(err)
 	}
 
+	err = exerciseStore.SeedExercises(seeds.FS, "exercises.json")
+	if err != nil {
+		return nil, err
+	}
+
 	app := &Application{
-		Logger:         logger,
-		WorkoutHandler: workoutHandler,
-		UserHandler:    userHandler,
-		TokenHandler:   tokenHandler,
-		MiddleWare:     &middleWareHandler,
-		DB:             pgDB,
+		Logger:           logger,
+		WorkoutHandler:   workoutHandler,
+		UserHandler:      userHandler,
+		TokenHandler:     tokenHandler,
+		ExerciseHandler:  exerciseHandler,
+		TemplateHandler:  templateHandler,
+		ProgramHandler:   programHandler,
+		RecordHandler:    recordHandler,
+		AnalyticsHandler: analyticsHandler,
+		TwoFactorHandler: twoFactorHandler,
+		APIKeyHandler:    apiKeyHandler,
+		AdminHandler:     adminHandler,
+		CoachHandler:     coachHandler,
+		MiddleWare:       &middleWareHandler,
+		Metrics:          appMetrics,
+		DB:               pgDB,
+		Config:           cfg,
+		shutdownTracing:  shutdownTracing,
 	}
 
+	app.ready.Store(true)
 	return app, nil
 }
 
 func (a *Application) HealthCheck(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprintf(w, "Healthy")
 }
+
+// ReadinessCheck tells load balancers whether to route requests here. Unlike
+// /health it fails while the server is shutting down or the database is
+// unreachable.
+func (a *Application) ReadinessCheck(w http.ResponseWriter, r *http.Request) {
+	if !a.ready.Load() {
+		http.Error(w, "Shutting down", http.StatusServiceUnavailable)
+		return
+	}
+
+	err := a.DB.PingContext(r.Context())
+	if err != nil {
+		a.Logger.ErrorContext(r.Context(), "readiness ping", "error", err)
+		http.Error(w, "Database unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	fmt.Fprintf(w, "Ready")
+}
+
+// Drain marks the application as not ready, the first step of a shutdown.
+func (a *Application) Drain() {
+	a.ready.Store(false)
+}
+
+// Close waits for the background tasks, like emails being sent, closes the
+// database and flushes the pending spans. Call it with the context of the
+// server's shutdown once the server stopped taking requests. When that
+// context is already done the drain timed out, and the database is closed
+// regardless of the requests and tasks that may still use it.
+func (a *Application) Close(ctx context.Context) error {
+	err := api.WaitForBackground(ctx)
+	if err != nil {
+		a.Logger.ErrorContext(ctx, "waiting for background tasks", "error", err)
+	}
+	if ctx.Err() != nil {
+		a.Logger.WarnContext(ctx, "drain timed out, forcing the database closed", "error", ctx.Err())
+	}
+	return errors.Join(a.DB.Close(), a.shutdownTracing(ctx))
+}
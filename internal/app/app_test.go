@@ -0,0 +1,87 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// pingConnector opens connections that only answer pings, with err.
+type pingConnector struct{ err error }
+
+func (c pingConnector) Connect(context.Context) (driver.Conn, error) { return pingConn(c), nil }
+func (c pingConnector) Driver() driver.Driver                        { return nil }
+
+type pingConn struct{ err error }
+
+func (c pingConn) Ping(context.Context) error          { return c.err }
+func (c pingConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (c pingConn) Close() error                        { return nil }
+func (c pingConn) Begin() (driver.Tx, error)           { return nil, errors.New("not supported") }
+
+func newTestApplication(pingErr error, logs *bytes.Buffer) *Application {
+	return &Application{
+		Logger:          slog.New(slog.NewTextHandler(logs, nil)),
+		DB:              sql.OpenDB(pingConnector{err: pingErr}),
+		shutdownTracing: func(context.Context) error { return nil },
+	}
+}
+
+func TestReadinessCheck(t *testing.T) {
+	ready := func(app *Application) (int, string) {
+		rr := httptest.NewRecorder()
+		app.ReadinessCheck(rr, httptest.NewRequest(http.MethodGet, "/ready", nil))
+		return rr.Code, rr.Body.String()
+	}
+
+	var logs bytes.Buffer
+	app := newTestApplication(nil, &logs)
+	defer app.DB.Close()
+
+	code, _ := ready(app)
+	assert.Equal(t, http.StatusServiceUnavailable, code, "not ready before setup finished")
+
+	app.ready.Store(true)
+	code, body := ready(app)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "Ready", body)
+
+	app.Drain()
+	code, body = ready(app)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Contains(t, body, "Shutting down")
+
+	down := newTestApplication(errors.New("connection refused"), &logs)
+	defer down.DB.Close()
+	down.ready.Store(true)
+	code, body = ready(down)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Contains(t, body, "Database unavailable")
+}
+
+func TestClose(t *testing.T) {
+	var logs bytes.Buffer
+	app := newTestApplication(nil, &logs)
+	require.NoError(t, app.Close(context.Background()))
+	assert.NotContains(t, logs.String(), "forcing")
+	assert.Error(t, app.DB.Ping(), "the database is closed")
+
+	// the shutdown timeout passed while requests were still running
+	logs.Reset()
+	app = newTestApplication(nil, &logs)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Nanosecond)
+	defer cancel()
+	<-ctx.Done()
+	require.NoError(t, app.Close(ctx))
+	assert.Contains(t, logs.String(), "drain timed out, forcing the database closed")
+}
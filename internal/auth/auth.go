@@ -0,0 +1,89 @@
+// Package auth issues and verifies the access tokens that authenticate API
+// requests. Refresh tokens and sessions always live in Postgres, access
+// tokens come either from the tokens table (stateful) or are signed JWTs
+// that are verified without a database round trip.
+package auth
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/shiponcs/femProject/internal/store"
+	"github.com/shiponcs/femProject/internal/tokens"
+)
+
+const (
+	BackendStateful = "stateful"
+	BackendJWT      = "jwt"
+)
+
+type AccessTokens interface {
+	// Issue returns a new access token for a session of user.
+	Issue(ctx context.Context, user *store.User, sessionID int64) (*tokens.Token, error)
+	// Authenticate returns nil for tokens that are invalid, expired or
+	// revoked.
+	Authenticate(ctx context.Context, plaintext string) (*store.User, error)
+	// Revoke invalidates the access tokens of sessions whose refresh tokens
+	// were just deleted.
+	Revoke(sessionIDs ...int64)
+	// JWKS lists the public keys tokens can be verified with.
+	JWKS() JWKS
+}
+
+// StatefulAccessTokens stores opaque access tokens in the tokens table, so
+// every request is checked against Postgres and revoking is just deleting
+// the rows.
+type StatefulAccessTokens struct {
+	tokenStore store.TokenStore
+	userStore  store.UserStore
+	ttl        time.Duration
+}
+
+func NewStatefulAccessTokens(tokenStore store.TokenStore, userStore store.UserStore, ttl time.Duration) *StatefulAccessTokens {
+	return &StatefulAccessTokens{
+		tokenStore: tokenStore,
+		userStore:  userStore,
+		ttl:        ttl,
+	}
+}
+
+func (s *StatefulAccessTokens) Issue(ctx context.Context, user *store.User, sessionID int64) (*tokens.Token, error) {
+	token, err := tokens.GenerateToken(user.ID, s.ttl, tokens.ScopeAuth)
+	if err != nil {
+		return nil, err
+	}
+	token.FamilyID = sessionID
+
+	err = s.tokenStore.Insert(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+func (s *StatefulAccessTokens) Authenticate(ctx context.Context, plaintext string) (*store.User, error) {
+	return s.userStore.GetUserToken(ctx, tokens.ScopeAuth, plaintext)
+}
+
+func (s *StatefulAccessTokens) Revoke(sessionIDs ...int64) {}
+
+func (s *StatefulAccessTokens) JWKS() JWKS {
+	return JWKS{Keys: []JWK{}}
+}
+
+// New returns the access token backend named by backend. keys configures
+// the JWT backend, see ParseKeySet.
+func New(backend string, tokenStore store.TokenStore, userStore store.UserStore, ttl time.Duration, algorithm, keys string) (AccessTokens, error) {
+	switch backend {
+	case BackendStateful, "":
+		return NewStatefulAccessTokens(tokenStore, userStore, ttl), nil
+	case BackendJWT:
+		keySet, err := ParseKeySet(algorithm, keys)
+		if err != nil {
+			return nil, err
+		}
+		return NewJWTAccessTokens(keySet, NewDenylist(), ttl), nil
+	}
+	return nil, fmt.Errorf("auth: unknown token backend %q", backend)
+}
@@ -0,0 +1,41 @@
+package auth
+
+import (
+	"sync"
+	"time"
+)
+
+// Denylist remembers revoked sessions until the last access token issued
+// for them expires. It is kept in memory: with several instances behind a
+// load balancer a revocation only reaches the instance that handled it, so
+// keep the access token TTL short.
+type Denylist struct {
+	mu       sync.Mutex
+	sessions map[int64]time.Time
+}
+
+func NewDenylist() *Denylist {
+	return &Denylist{sessions: make(map[int64]time.Time)}
+}
+
+// Add denies sessionID until until.
+func (d *Denylist) Add(sessionID int64, until time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := time.Now()
+	for id, expiry := range d.sessions {
+		if !expiry.After(now) {
+			delete(d.sessions, id)
+		}
+	}
+	d.sessions[sessionID] = until
+}
+
+func (d *Denylist) Contains(sessionID int64) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	until, ok := d.sessions[sessionID]
+	return ok && until.After(time.Now())
+}
@@ -0,0 +1,235 @@
+package auth
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/shiponcs/femProject/internal/store"
+	"github.com/shiponcs/femProject/internal/tokens"
+)
+
+const jwtIssuer = "workouts"
+
+type signingKey struct {
+	id     string
+	sign   interface{}
+	verify interface{}
+	public ed25519.PublicKey
+}
+
+// KeySet holds the keys of the JWT backend. The first key signs new tokens,
+// the others only verify, which lets keys be rotated without logging every
+// session out: add the new key first, drop the old one once the tokens it
+// signed expired.
+type KeySet struct {
+	method  jwt.SigningMethod
+	signing *signingKey
+	keys    map[string]*signingKey
+}
+
+// ParseKeySet reads keys written as "kid:base64,kid:base64". EdDSA keys
+// are 32 byte Ed25519 seeds, HS256 keys are secrets of at least 32 bytes.
+func ParseKeySet(algorithm, spec string) (*KeySet, error) {
+	set := &KeySet{keys: make(map[string]*signingKey)}
+
+	switch algorithm {
+	case "EdDSA", "":
+		set.method = jwt.SigningMethodEdDSA
+	case "HS256":
+		set.method = jwt.SigningMethodHS256
+	default:
+		return nil, fmt.Errorf("auth: unsupported jwt algorithm %q", algorithm)
+	}
+
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		id, encoded, ok := strings.Cut(part, ":")
+		if !ok || id == "" {
+			return nil, errors.New("auth: jwt keys must be written as kid:base64")
+		}
+		if _, exists := set.keys[id]; exists {
+			return nil, fmt.Errorf("auth: duplicate jwt key id %q", id)
+		}
+
+		material, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("auth: jwt key %q: %w", id, err)
+		}
+
+		key := &signingKey{id: id}
+		if set.method == jwt.SigningMethodEdDSA {
+			if len(material) != ed25519.SeedSize {
+				return nil, fmt.Errorf("auth: jwt key %q must be a %d byte Ed25519 seed", id, ed25519.SeedSize)
+			}
+			private := ed25519.NewKeyFromSeed(material)
+			key.sign = private
+			key.public = private.Public().(ed25519.PublicKey)
+			key.verify = key.public
+		} else {
+			if len(material) < 32 {
+				return nil, fmt.Errorf("auth: jwt key %q must be at least 32 bytes", id)
+			}
+			key.sign = material
+			key.verify = material
+		}
+
+		set.keys[id] = key
+		if set.signing == nil {
+			set.signing = key
+		}
+	}
+
+	if set.signing == nil {
+		return nil, errors.New("auth: the jwt backend needs at least one key")
+	}
+	return set, nil
+}
+
+type JWK struct {
+	KeyType   string `json:"kty"`
+	Curve     string `json:"crv"`
+	X         string `json:"x"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS lists the public keys of the set. HS256 keys are secret, so the
+// list is empty for them.
+func (s *KeySet) JWKS() JWKS {
+	jwks := JWKS{Keys: []JWK{}}
+	for _, key := range s.keys {
+		if key.public == nil {
+			continue
+		}
+		jwks.Keys = append(jwks.Keys, JWK{
+			KeyType:   "OKP",
+			Curve:     "Ed25519",
+			X:         base64.RawURLEncoding.EncodeToString(key.public),
+			KeyID:     key.id,
+			Use:       "sig",
+			Algorithm: s.method.Alg(),
+		})
+	}
+	return jwks
+}
+
+type accessClaims struct {
+	Username  string `json:"username"`
+	Activated bool   `json:"activated"`
+	Role      string `json:"role"`
+	SessionID int64  `json:"sid"`
+	jwt.RegisteredClaims
+}
+
+// JWTAccessTokens signs access tokens that carry what authorization needs
+// about the user. Authenticate doesn't touch the database, so the user it
+// returns only has ID, Username, Activated, Role and SessionID set, and
+// activation changes show up with the next refresh.
+type JWTAccessTokens struct {
+	keys     *KeySet
+	denylist *Denylist
+	ttl      time.Duration
+}
+
+func NewJWTAccessTokens(keys *KeySet, denylist *Denylist, ttl time.Duration) *JWTAccessTokens {
+	return &JWTAccessTokens{
+		keys:     keys,
+		denylist: denylist,
+		ttl:      ttl,
+	}
+}
+
+func (j *JWTAccessTokens) Issue(ctx context.Context, user *store.User, sessionID int64) (*tokens.Token, error) {
+	now := time.Now()
+	expiry := now.Add(j.ttl)
+
+	claims := accessClaims{
+		Username:  user.Username,
+		Activated: user.Activated,
+		Role:      user.Role,
+		SessionID: sessionID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    jwtIssuer,
+			Subject:   strconv.Itoa(user.ID),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiry),
+		},
+	}
+
+	token := jwt.NewWithClaims(j.keys.method, claims)
+	token.Header["kid"] = j.keys.signing.id
+
+	signed, err := token.SignedString(j.keys.signing.sign)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tokens.Token{
+		Plaintext: signed,
+		UserID:    user.ID,
+		Expiry:    expiry,
+		Scope:     tokens.ScopeAuth,
+		FamilyID:  sessionID,
+	}, nil
+}
+
+func (j *JWTAccessTokens) Authenticate(ctx context.Context, plaintext string) (*store.User, error) {
+	var claims accessClaims
+
+	_, err := jwt.ParseWithClaims(plaintext, &claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, ok := j.keys.keys[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown key id %q", kid)
+		}
+		return key.verify, nil
+	}, jwt.WithValidMethods([]string{j.keys.method.Alg()}))
+	if err != nil {
+		return nil, nil
+	}
+
+	if !claims.VerifyIssuer(jwtIssuer, true) || j.denylist.Contains(claims.SessionID) {
+		return nil, nil
+	}
+
+	userID, err := strconv.Atoi(claims.Subject)
+	if err != nil {
+		return nil, nil
+	}
+
+	return &store.User{
+		ID:        userID,
+		Username:  claims.Username,
+		Activated: claims.Activated,
+		Role:      claims.Role,
+		SessionID: claims.SessionID,
+	}, nil
+}
+
+func (j *JWTAccessTokens) Revoke(sessionIDs ...int64) {
+	until := time.Now().Add(j.ttl)
+	for _, id := range sessionIDs {
+		j.denylist.Add(id, until)
+	}
+}
+
+func (j *JWTAccessTokens) JWKS() JWKS {
+	return j.keys.JWKS()
+}
@@ -0,0 +1,157 @@
+package auth
+
+import (
+	"context"
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/shiponcs/femProject/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testKey(b byte) string {
+	return base64.StdEncoding.EncodeToString([]byte(strings.Repeat(string(b), 32)))
+}
+
+func TestParseKeySet(t *testing.T) {
+	tests := []struct {
+		name      string
+		algorithm string
+		spec      string
+		wantErr   bool
+	}{
+		{name: "eddsa", algorithm: "EdDSA", spec: "a:" + testKey('a')},
+		{name: "default algorithm", spec: "a:" + testKey('a') + ", b:" + testKey('b')},
+		{name: "hs256", algorithm: "HS256", spec: "a:" + testKey('a')},
+		{name: "no keys", algorithm: "EdDSA", spec: "", wantErr: true},
+		{name: "missing kid", algorithm: "EdDSA", spec: testKey('a'), wantErr: true},
+		{name: "duplicate kid", algorithm: "EdDSA", spec: "a:" + testKey('a') + ",a:" + testKey('b'), wantErr: true},
+		{name: "short seed", algorithm: "EdDSA", spec: "a:" + base64.StdEncoding.EncodeToString([]byte("short")), wantErr: true},
+		{name: "unsupported algorithm", algorithm: "RS256", spec: "a:" + testKey('a'), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseKeySet(tt.algorithm, tt.spec)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestJWTAccessTokens(t *testing.T) {
+	keys, err := ParseKeySet("EdDSA", "old:"+testKey('o'))
+	require.NoError(t, err)
+	accessTokens := NewJWTAccessTokens(keys, NewDenylist(), time.Minute)
+
+	user := &store.User{ID: 7, Username: "jane", Activated: true, Role: store.RoleCoach}
+	token, err := accessTokens.Issue(context.Background(), user, 42)
+	require.NoError(t, err)
+
+	got, err := accessTokens.Authenticate(context.Background(), token.Plaintext)
+	require.NoError(t, err)
+	require.NotNil(t, got)
+	assert.Equal(t, 7, got.ID)
+	assert.Equal(t, "jane", got.Username)
+	assert.True(t, got.Activated)
+	assert.Equal(t, store.RoleCoach, got.Role)
+	assert.Equal(t, int64(42), got.SessionID)
+
+	t.Run("tampered", func(t *testing.T) {
+		parts := strings.Split(token.Plaintext, ".")
+		claims, err := base64.RawURLEncoding.DecodeString(parts[1])
+		require.NoError(t, err)
+		claims = []byte(strings.Replace(string(claims), `"sub":"7"`, `"sub":"8"`, 1))
+		parts[1] = base64.RawURLEncoding.EncodeToString(claims)
+
+		got, err := accessTokens.Authenticate(context.Background(), strings.Join(parts, "."))
+		require.NoError(t, err)
+		assert.Nil(t, got)
+	})
+
+	t.Run("wrong algorithm", func(t *testing.T) {
+		forged := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+			Issuer:    jwtIssuer,
+			Subject:   "7",
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+		})
+		forged.Header["kid"] = "old"
+		signed, err := forged.SignedString([]byte(strings.Repeat("o", 32)))
+		require.NoError(t, err)
+
+		got, err := accessTokens.Authenticate(context.Background(), signed)
+		require.NoError(t, err)
+		assert.Nil(t, got)
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		expired := NewJWTAccessTokens(keys, NewDenylist(), -time.Minute)
+		token, err := expired.Issue(context.Background(), user, 42)
+		require.NoError(t, err)
+
+		got, err := accessTokens.Authenticate(context.Background(), token.Plaintext)
+		require.NoError(t, err)
+		assert.Nil(t, got)
+	})
+
+	t.Run("key rotation", func(t *testing.T) {
+		rotated, err := ParseKeySet("EdDSA", "new:"+testKey('n')+",old:"+testKey('o'))
+		require.NoError(t, err)
+		next := NewJWTAccessTokens(rotated, NewDenylist(), time.Minute)
+
+		// tokens signed with the old key stay valid until they expire
+		got, err := next.Authenticate(context.Background(), token.Plaintext)
+		require.NoError(t, err)
+		assert.NotNil(t, got)
+
+		newToken, err := next.Issue(context.Background(), user, 42)
+		require.NoError(t, err)
+		parsed, _, err := jwt.NewParser().ParseUnverified(newToken.Plaintext, &accessClaims{})
+		require.NoError(t, err)
+		assert.Equal(t, "new", parsed.Header["kid"])
+
+		// instances that don't know the new key yet reject its tokens
+		got, err = accessTokens.Authenticate(context.Background(), newToken.Plaintext)
+		require.NoError(t, err)
+		assert.Nil(t, got)
+
+		assert.Len(t, next.JWKS().Keys, 2)
+	})
+
+	t.Run("revoked", func(t *testing.T) {
+		accessTokens.Revoke(42)
+
+		got, err := accessTokens.Authenticate(context.Background(), token.Plaintext)
+		require.NoError(t, err)
+		assert.Nil(t, got)
+
+		other, err := accessTokens.Issue(context.Background(), user, 43)
+		require.NoError(t, err)
+		got, err = accessTokens.Authenticate(context.Background(), other.Plaintext)
+		require.NoError(t, err)
+		assert.NotNil(t, got)
+	})
+}
+
+func TestJWKS(t *testing.T) {
+	keys, err := ParseKeySet("EdDSA", "a:"+testKey('a'))
+	require.NoError(t, err)
+
+	jwks := keys.JWKS()
+	require.Len(t, jwks.Keys, 1)
+	assert.Equal(t, "OKP", jwks.Keys[0].KeyType)
+	assert.Equal(t, "Ed25519", jwks.Keys[0].Curve)
+	assert.Equal(t, "a", jwks.Keys[0].KeyID)
+	assert.Equal(t, "EdDSA", jwks.Keys[0].Algorithm)
+
+	secret, err := ParseKeySet("HS256", "a:"+testKey('a'))
+	require.NoError(t, err)
+	assert.Empty(t, secret.JWKS().Keys)
+}
@@ -0,0 +1,132 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"github.com/shiponcs/femProject/internal/store"
+)
+
+// LoginLimits configures a LoginLimiter. After the free attempts every
+// further failure doubles the wait before the next login is accepted, from
+// BaseDelay up to MaxDelay, which is in effect a temporary lockout.
+type LoginLimits struct {
+	UserFreeAttempts int
+	IPFreeAttempts   int
+	BaseDelay        time.Duration
+	MaxDelay         time.Duration
+	// Window is how long failures are remembered after the last one.
+	Window time.Duration
+}
+
+// LoginLimiter slows down password guessing, per username so one account
+// can't be brute forced from many addresses, and per client IP so one
+// address can't spray passwords over many accounts.
+type LoginLimiter struct {
+	store  store.LoginAttemptStore
+	limits LoginLimits
+	now    func() time.Time
+}
+
+func NewLoginLimiter(store store.LoginAttemptStore, limits LoginLimits) *LoginLimiter {
+	return &LoginLimiter{
+		store:  store,
+		limits: limits,
+		now:    time.Now,
+	}
+}
+
+// userKey and ipKey hash what the client sent, the keys have the same
+// length however long a username it made up.
+func userKey(username string) string {
+	return hashKey("user:", strings.ToLower(username))
+}
+
+func ipKey(ip string) string {
+	return hashKey("ip:", ip)
+}
+
+func hashKey(prefix, value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return prefix + hex.EncodeToString(sum[:])
+}
+
+// delay is how long to wait after the last of count failures.
+func (l *LoginLimiter) delay(count, freeAttempts int) time.Duration {
+	if count < freeAttempts {
+		return 0
+	}
+
+	delay := l.limits.BaseDelay
+	for i := freeAttempts; i < count && delay < l.limits.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > l.limits.MaxDelay {
+		delay = l.limits.MaxDelay
+	}
+	return delay
+}
+
+// retryAfter returns how long to wait after failures, zero if the client
+// may try now.
+func (l *LoginLimiter) retryAfter(failures store.LoginFailures, freeAttempts int, now time.Time) time.Duration {
+	if failures.Count == 0 || failures.LastFailureAt.Before(now.Add(-l.limits.Window)) {
+		return 0
+	}
+
+	wait := failures.LastFailureAt.Add(l.delay(failures.Count, freeAttempts)).Sub(now)
+	if wait < 0 {
+		return 0
+	}
+	return wait
+}
+
+func (l *LoginLimiter) reserve(ctx context.Context, key string, freeAttempts int, now time.Time) (time.Duration, error) {
+	return l.store.ReserveLoginAttempt(ctx, key, now, l.limits.Window, func(failures store.LoginFailures) time.Duration {
+		return l.retryAfter(failures, freeAttempts, now)
+	})
+}
+
+// Attempt returns how long the client has to wait before it may try to log
+// in as username, zero if it may try now. An attempt it lets through is
+// counted as a failure right away, for unknown usernames too, so concurrent
+// guesses can't all get in before the first one fails. Call Succeed once the
+// password matched and, with two-factor authentication, the second factor
+// passed too.
+func (l *LoginLimiter) Attempt(ctx context.Context, username, ip string) (time.Duration, error) {
+	now := l.now()
+
+	wait, err := l.reserve(ctx, userKey(username), l.limits.UserFreeAttempts, now)
+	if err != nil || wait > 0 {
+		return wait, err
+	}
+
+	wait, err = l.reserve(ctx, ipKey(ip), l.limits.IPFreeAttempts, now)
+	if err != nil || wait > 0 {
+		// the attempt isn't made, don't hold it against the username
+		if releaseErr := l.store.ReleaseLoginAttempt(ctx, userKey(username)); releaseErr != nil {
+			return 0, releaseErr
+		}
+		return wait, err
+	}
+	return 0, nil
+}
+
+// Succeed forgets the failures of username and takes back the attempt of
+// ip. The IP keeps its earlier failures, or one valid account would let an
+// address keep guessing at others.
+func (l *LoginLimiter) Succeed(ctx context.Context, username, ip string) error {
+	err := l.store.ResetLoginFailures(ctx, userKey(username))
+	if err != nil {
+		return err
+	}
+	return l.store.ReleaseLoginAttempt(ctx, ipKey(ip))
+}
+
+// Unlock lets an admin lift the lockout of username.
+func (l *LoginLimiter) Unlock(ctx context.Context, username string) error {
+	return l.store.ResetLoginFailures(ctx, userKey(username))
+}
@@ -0,0 +1,163 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/shiponcs/femProject/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestLimiter() (*LoginLimiter, *time.Time) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	limiter := NewLoginLimiter(store.NewMemoryLoginAttemptStore(), LoginLimits{
+		UserFreeAttempts: 3,
+		IPFreeAttempts:   5,
+		BaseDelay:        time.Second,
+		MaxDelay:         10 * time.Second,
+		Window:           time.Hour,
+	})
+	limiter.now = func() time.Time { return now }
+	return limiter, &now
+}
+
+func TestLoginLimiterBackoff(t *testing.T) {
+	limiter, now := newTestLimiter()
+
+	expected := []time.Duration{0, 0, 0, time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second, 10 * time.Second}
+	for i, want := range expected {
+		// usernames are case insensitive, other addresses are still
+		// limited by the username
+		ip := fmt.Sprintf("10.0.0.%d", i)
+		wait, err := limiter.Attempt(context.Background(), "Jane", ip)
+		require.NoError(t, err)
+		assert.Equal(t, want, wait, "attempt %d", i+1)
+
+		if wait > 0 {
+			*now = now.Add(wait)
+			wait, err = limiter.Attempt(context.Background(), "jane", ip)
+			require.NoError(t, err)
+			assert.Zero(t, wait, "attempt %d once the wait elapsed", i+1)
+		}
+	}
+}
+
+func TestLoginLimiterWaitElapses(t *testing.T) {
+	limiter, now := newTestLimiter()
+
+	for i := 0; i < 3; i++ {
+		wait, err := limiter.Attempt(context.Background(), "jane", "10.0.0.1")
+		require.NoError(t, err)
+		require.Zero(t, wait)
+	}
+
+	// a throttled attempt isn't counted, waiting it out is enough
+	for i := 0; i < 3; i++ {
+		wait, err := limiter.Attempt(context.Background(), "jane", "10.0.0.1")
+		require.NoError(t, err)
+		assert.Equal(t, time.Second, wait)
+	}
+
+	*now = now.Add(500 * time.Millisecond)
+	wait, err := limiter.Attempt(context.Background(), "jane", "10.0.0.1")
+	require.NoError(t, err)
+	assert.Equal(t, 500*time.Millisecond, wait)
+
+	*now = now.Add(500 * time.Millisecond)
+	wait, err = limiter.Attempt(context.Background(), "jane", "10.0.0.1")
+	require.NoError(t, err)
+	assert.Zero(t, wait)
+
+	// failures are forgotten after the window
+	*now = now.Add(2 * time.Hour)
+	for i := 0; i < 3; i++ {
+		wait, err = limiter.Attempt(context.Background(), "jane", "10.0.0.1")
+		require.NoError(t, err)
+		assert.Zero(t, wait)
+	}
+}
+
+func TestLoginLimiterPerIP(t *testing.T) {
+	limiter, _ := newTestLimiter()
+
+	// spraying one password over many accounts from one address
+	for _, username := range []string{"a", "b", "c", "d", "e"} {
+		wait, err := limiter.Attempt(context.Background(), username, "10.0.0.1")
+		require.NoError(t, err)
+		require.Zero(t, wait)
+	}
+
+	wait, err := limiter.Attempt(context.Background(), "f", "10.0.0.1")
+	require.NoError(t, err)
+	assert.Equal(t, time.Second, wait)
+
+	// the username isn't held responsible for the address
+	for i := 0; i < 3; i++ {
+		wait, err = limiter.Attempt(context.Background(), "f", "10.0.0.2")
+		require.NoError(t, err)
+		assert.Zero(t, wait)
+	}
+}
+
+func TestLoginLimiterReset(t *testing.T) {
+	limiter, _ := newTestLimiter()
+
+	for i := 0; i < 3; i++ {
+		_, err := limiter.Attempt(context.Background(), "jane", "10.0.0.1")
+		require.NoError(t, err)
+	}
+	require.NoError(t, limiter.Unlock(context.Background(), "JANE"))
+
+	wait, err := limiter.Attempt(context.Background(), "jane", "10.0.0.2")
+	require.NoError(t, err)
+	assert.Zero(t, wait)
+	require.NoError(t, limiter.Unlock(context.Background(), "jane"))
+
+	// successful logins count against neither the username nor the address
+	for i := 0; i < 10; i++ {
+		wait, err = limiter.Attempt(context.Background(), "jane", "10.0.0.1")
+		require.NoError(t, err)
+		require.Zero(t, wait, "login %d", i+1)
+		require.NoError(t, limiter.Succeed(context.Background(), "jane", "10.0.0.1"))
+	}
+}
+
+func TestLoginLimiterConcurrentAttempts(t *testing.T) {
+	limiter, _ := newTestLimiter()
+
+	const attempts = 50
+	var wg sync.WaitGroup
+	var allowed atomic.Int32
+	for i := 0; i < attempts; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			wait, err := limiter.Attempt(context.Background(), "jane", "10.0.0.1")
+			assert.NoError(t, err)
+			if wait == 0 {
+				allowed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// parallel guesses get the free attempts and no more
+	assert.Equal(t, int32(3), allowed.Load())
+}
+
+func TestLoginLimiterKeys(t *testing.T) {
+	assert.Equal(t, userKey("Jane"), userKey("jane"))
+	assert.NotEqual(t, userKey("jane"), userKey("john"))
+	assert.NotEqual(t, userKey("10.0.0.1"), ipKey("10.0.0.1"))
+
+	// the keys fit the login_failures table however long the username
+	long := strings.Repeat("a", 10000)
+	assert.Len(t, userKey(long), len(userKey("jane")))
+	assert.LessOrEqual(t, len(userKey(long)), 300)
+}
@@ -0,0 +1,322 @@
+// Package config loads the settings of the server. Every setting has a
+// default, which an optional YAML file overrides, which environment
+// variables override, which command line flags override.
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"gopkg.in/yaml.v3"
+)
+
+type Config struct {
+	Port      int     `yaml:"port"`
+	LogLevel  string  `yaml:"log_level"`
+	LogFormat string  `yaml:"log_format"`
+	DB        DB      `yaml:"db"`
+	HTTP      HTTP    `yaml:"http"`
+	Auth      Auth    `yaml:"auth"`
+	SMTP      SMTP    `yaml:"smtp"`
+	Tracing   Tracing `yaml:"tracing"`
+}
+
+type DB struct {
+	DSN             string        `yaml:"dsn"`
+	MaxOpenConns    int           `yaml:"max_open_conns"`
+	MaxIdleConns    int           `yaml:"max_idle_conns"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime"`
+	ConnMaxIdleTime time.Duration `yaml:"conn_max_idle_time"`
+}
+
+type HTTP struct {
+	ReadTimeout  time.Duration `yaml:"read_timeout"`
+	WriteTimeout time.Duration `yaml:"write_timeout"`
+	IdleTimeout  time.Duration `yaml:"idle_timeout"`
+	// ShutdownDelay is how long GET /ready reports the server as unavailable
+	// before it stops taking connections, so load balancers can route around
+	// it first. In-flight requests then get ShutdownTimeout to finish.
+	ShutdownDelay   time.Duration `yaml:"shutdown_delay"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+}
+
+type Auth struct {
+	AccessTokenTTL        time.Duration `yaml:"access_token_ttl"`
+	RefreshTokenTTL       time.Duration `yaml:"refresh_token_ttl"`
+	PasswordResetTokenTTL time.Duration `yaml:"password_reset_token_ttl"`
+	ActivationTokenTTL    time.Duration `yaml:"activation_token_ttl"`
+	TwoFactorPendingTTL   time.Duration `yaml:"two_factor_pending_ttl"`
+	BcryptCost            int           `yaml:"bcrypt_cost"`
+	// TokenBackend, JWTAlgorithm and JWTKeys are passed to auth.New.
+	TokenBackend      string `yaml:"token_backend"`
+	JWTAlgorithm      string `yaml:"jwt_algorithm"`
+	JWTKeys           string `yaml:"jwt_keys"`
+	LoginAttemptStore string `yaml:"login_attempt_store"`
+	// The login settings are passed to auth.NewLoginLimiter as
+	// auth.LoginLimits.
+	LoginUserFreeAttempts int           `yaml:"login_user_free_attempts"`
+	LoginIPFreeAttempts   int           `yaml:"login_ip_free_attempts"`
+	LoginBaseDelay        time.Duration `yaml:"login_base_delay"`
+	LoginMaxDelay         time.Duration `yaml:"login_max_delay"`
+	LoginWindow           time.Duration `yaml:"login_window"`
+}
+
+// SMTP configures the mail server, emails are written to stdout when Host
+// is empty.
+type SMTP struct {
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	Sender   string `yaml:"sender"`
+}
+
+// Tracing configures OpenTelemetry. Exporter is none, stdout or otlp, the
+// OTLP exporter sends spans over HTTP to OTLPEndpoint.
+type Tracing struct {
+	Exporter     string  `yaml:"exporter"`
+	OTLPEndpoint string  `yaml:"otlp_endpoint"`
+	SampleRatio  float64 `yaml:"sample_ratio"`
+	ServiceName  string  `yaml:"service_name"`
+}
+
+// Default returns the settings of a local development setup, see
+// docker-compose.yml.
+func Default() *Config {
+	return &Config{
+		Port:      8080,
+		LogLevel:  "info",
+		LogFormat: "json",
+		DB: DB{
+			DSN:             "host=localhost user=postgres password=postgres dbname=postgres port=5432 sslmode=disable",
+			MaxOpenConns:    25,
+			MaxIdleConns:    25,
+			ConnMaxLifetime: time.Hour,
+			ConnMaxIdleTime: 15 * time.Minute,
+		},
+		HTTP: HTTP{
+			ReadTimeout:     10 * time.Second,
+			WriteTimeout:    30 * time.Second,
+			IdleTimeout:     time.Minute,
+			ShutdownDelay:   5 * time.Second,
+			ShutdownTimeout: 30 * time.Second,
+		},
+		Auth: Auth{
+			AccessTokenTTL:        15 * time.Minute,
+			RefreshTokenTTL:       30 * 24 * time.Hour,
+			PasswordResetTokenTTL: 45 * time.Minute,
+			ActivationTokenTTL:    3 * 24 * time.Hour,
+			TwoFactorPendingTTL:   5 * time.Minute,
+			BcryptCost:            12,
+			TokenBackend:          "stateful",
+			JWTAlgorithm:          "EdDSA",
+			LoginAttemptStore:     "postgres",
+			LoginUserFreeAttempts: 5,
+			LoginIPFreeAttempts:   20,
+			LoginBaseDelay:        time.Second,
+			LoginMaxDelay:         15 * time.Minute,
+			LoginWindow:           24 * time.Hour,
+		},
+		SMTP: SMTP{
+			Port: 25,
+		},
+		Tracing: Tracing{
+			Exporter:     "none",
+			OTLPEndpoint: "http://localhost:4318",
+			SampleRatio:  1,
+			ServiceName:  "workouts",
+		},
+	}
+}
+
+type setting struct {
+	flag  string
+	env   string
+	usage string
+	value flag.Value
+}
+
+func (c *Config) settings() []setting {
+	return []setting{
+		{"port", "PORT", "The backend server port", (*intValue)(&c.Port)},
+		{"log-level", "LOG_LEVEL", "debug, info, warn or error", (*stringValue)(&c.LogLevel)},
+		{"log-format", "LOG_FORMAT", "json or text", (*stringValue)(&c.LogFormat)},
+		{"db-dsn", "DB_DSN", "Postgres connection string", (*stringValue)(&c.DB.DSN)},
+		{"db-max-open-conns", "DB_MAX_OPEN_CONNS", "maximum open database connections, 0 for no limit", (*intValue)(&c.DB.MaxOpenConns)},
+		{"db-max-idle-conns", "DB_MAX_IDLE_CONNS", "maximum idle database connections", (*intValue)(&c.DB.MaxIdleConns)},
+		{"db-conn-max-lifetime", "DB_CONN_MAX_LIFETIME", "maximum lifetime of a database connection, 0 for no limit", (*durationValue)(&c.DB.ConnMaxLifetime)},
+		{"db-conn-max-idle-time", "DB_CONN_MAX_IDLE_TIME", "maximum idle time of a database connection, 0 for no limit", (*durationValue)(&c.DB.ConnMaxIdleTime)},
+		{"http-read-timeout", "HTTP_READ_TIMEOUT", "maximum duration for reading a request", (*durationValue)(&c.HTTP.ReadTimeout)},
+		{"http-write-timeout", "HTTP_WRITE_TIMEOUT", "maximum duration for writing a response", (*durationValue)(&c.HTTP.WriteTimeout)},
+		{"http-idle-timeout", "HTTP_IDLE_TIMEOUT", "maximum idle time of a keep-alive connection", (*durationValue)(&c.HTTP.IdleTimeout)},
+		{"shutdown-delay", "SHUTDOWN_DELAY", "how long to report not ready before shutting down", (*durationValue)(&c.HTTP.ShutdownDelay)},
+		{"shutdown-timeout", "SHUTDOWN_TIMEOUT", "maximum duration for draining in-flight requests and background tasks", (*durationValue)(&c.HTTP.ShutdownTimeout)},
+		{"access-token-ttl", "ACCESS_TOKEN_TTL", "lifetime of access tokens", (*durationValue)(&c.Auth.AccessTokenTTL)},
+		{"refresh-token-ttl", "REFRESH_TOKEN_TTL", "lifetime of refresh tokens", (*durationValue)(&c.Auth.RefreshTokenTTL)},
+		{"password-reset-token-ttl", "PASSWORD_RESET_TOKEN_TTL", "lifetime of emailed password reset tokens", (*durationValue)(&c.Auth.PasswordResetTokenTTL)},
+		{"activation-token-ttl", "ACTIVATION_TOKEN_TTL", "lifetime of emailed account activation tokens", (*durationValue)(&c.Auth.ActivationTokenTTL)},
+		{"two-factor-pending-ttl", "TWO_FACTOR_PENDING_TTL", "time to send the second factor after the password", (*durationValue)(&c.Auth.TwoFactorPendingTTL)},
+		{"bcrypt-cost", "BCRYPT_COST", "bcrypt cost of new password hashes", (*intValue)(&c.Auth.BcryptCost)},
+		{"auth-token-backend", "AUTH_TOKEN_BACKEND", "stateful or jwt access tokens", (*stringValue)(&c.Auth.TokenBackend)},
+		{"jwt-algorithm", "JWT_ALGORITHM", "EdDSA or HS256", (*stringValue)(&c.Auth.JWTAlgorithm)},
+		{"jwt-keys", "JWT_KEYS", "JWT keys as kid:base64, comma separated, the first one signs", (*stringValue)(&c.Auth.JWTKeys)},
+		{"login-attempt-store", "LOGIN_ATTEMPT_STORE", "postgres or memory", (*stringValue)(&c.Auth.LoginAttemptStore)},
+		{"login-user-free-attempts", "LOGIN_USER_FREE_ATTEMPTS", "failed logins per username before they are slowed down", (*intValue)(&c.Auth.LoginUserFreeAttempts)},
+		{"login-ip-free-attempts", "LOGIN_IP_FREE_ATTEMPTS", "failed logins per client IP before they are slowed down", (*intValue)(&c.Auth.LoginIPFreeAttempts)},
+		{"login-base-delay", "LOGIN_BASE_DELAY", "wait after the first failed login past the free attempts", (*durationValue)(&c.Auth.LoginBaseDelay)},
+		{"login-max-delay", "LOGIN_MAX_DELAY", "longest wait between failed logins", (*durationValue)(&c.Auth.LoginMaxDelay)},
+		{"login-window", "LOGIN_WINDOW", "how long failed logins are remembered", (*durationValue)(&c.Auth.LoginWindow)},
+		{"smtp-host", "SMTP_HOST", "SMTP server, emails are printed to stdout without one", (*stringValue)(&c.SMTP.Host)},
+		{"smtp-port", "SMTP_PORT", "SMTP server port", (*intValue)(&c.SMTP.Port)},
+		{"smtp-username", "SMTP_USERNAME", "SMTP username", (*stringValue)(&c.SMTP.Username)},
+		{"smtp-password", "SMTP_PASSWORD", "SMTP password", (*stringValue)(&c.SMTP.Password)},
+		{"smtp-sender", "SMTP_SENDER", "From address of emails", (*stringValue)(&c.SMTP.Sender)},
+		{"tracing-exporter", "TRACING_EXPORTER", "none, stdout or otlp", (*stringValue)(&c.Tracing.Exporter)},
+		{"otlp-endpoint", "OTLP_ENDPOINT", "URL of the OTLP/HTTP trace collector", (*stringValue)(&c.Tracing.OTLPEndpoint)},
+		{"tracing-sample-ratio", "TRACING_SAMPLE_RATIO", "share of new traces that are recorded, from 0 to 1", (*floatValue)(&c.Tracing.SampleRatio)},
+		{"service-name", "SERVICE_NAME", "service name of the spans", (*stringValue)(&c.Tracing.ServiceName)},
+	}
+}
+
+// Load reads the settings from args (without the program name), getenv
+// and the YAML file named by the -config flag or the CONFIG_FILE variable.
+func Load(args []string, getenv func(string) string) (*Config, error) {
+	cfg := Default()
+	settings := cfg.settings()
+
+	fs := flag.NewFlagSet("workouts", flag.ContinueOnError)
+	configFile := fs.String("config", getenv("CONFIG_FILE"), "path of an optional YAML config file")
+	for _, s := range settings {
+		fs.Var(s.value, s.flag, s.usage+" (env "+s.env+")")
+	}
+	err := fs.Parse(args)
+	if err != nil {
+		return nil, err
+	}
+
+	// flags are bound to cfg, remember the explicit ones so they can be
+	// applied again over the file and the environment
+	explicit := map[string]string{}
+	fs.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = f.Value.String()
+	})
+
+	if *configFile != "" {
+		err = cfg.loadFile(*configFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, s := range settings {
+		value := getenv(s.env)
+		if value == "" {
+			continue
+		}
+		err = s.value.Set(value)
+		if err != nil {
+			return nil, fmt.Errorf("config: %s: %w", s.env, err)
+		}
+	}
+
+	for name, value := range explicit {
+		if name == "config" {
+			continue
+		}
+		err = fs.Set(name, value)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return cfg, cfg.Validate()
+}
+
+func (c *Config) loadFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+	defer f.Close()
+
+	decoder := yaml.NewDecoder(f)
+	decoder.KnownFields(true)
+	err = decoder.Decode(c)
+	if err != nil {
+		return fmt.Errorf("config: %s: %w", path, err)
+	}
+	return nil
+}
+
+var logLevels = []string{"debug", "info", "warn", "error"}
+
+// Validate reports every invalid setting at once.
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(c.Port > 0 && c.Port < 65536, "port must be between 1 and 65535")
+	check(oneOf(c.LogLevel, logLevels...), "log level must be one of %s", strings.Join(logLevels, ", "))
+	check(oneOf(c.LogFormat, "json", "text"), "log format must be json or text")
+
+	check(c.DB.DSN != "", "db dsn is required")
+	check(c.DB.MaxOpenConns >= 0, "db max open conns can't be negative")
+	check(c.DB.MaxIdleConns >= 0, "db max idle conns can't be negative")
+	check(c.DB.MaxOpenConns == 0 || c.DB.MaxIdleConns <= c.DB.MaxOpenConns, "db max idle conns can't be greater than max open conns")
+	check(c.DB.ConnMaxLifetime >= 0, "db conn max lifetime can't be negative")
+	check(c.DB.ConnMaxIdleTime >= 0, "db conn max idle time can't be negative")
+
+	check(c.HTTP.ReadTimeout > 0, "http read timeout must be positive")
+	check(c.HTTP.WriteTimeout > 0, "http write timeout must be positive")
+	check(c.HTTP.IdleTimeout > 0, "http idle timeout must be positive")
+	check(c.HTTP.ShutdownDelay >= 0, "shutdown delay can't be negative")
+	check(c.HTTP.ShutdownTimeout > 0, "shutdown timeout must be positive")
+
+	check(c.Auth.AccessTokenTTL > 0, "access token ttl must be positive")
+	check(c.Auth.RefreshTokenTTL > c.Auth.AccessTokenTTL, "refresh token ttl must be longer than the access token ttl")
+	check(c.Auth.PasswordResetTokenTTL > 0, "password reset token ttl must be positive")
+	check(c.Auth.ActivationTokenTTL > 0, "activation token ttl must be positive")
+	check(c.Auth.TwoFactorPendingTTL > 0, "two factor pending ttl must be positive")
+	check(c.Auth.BcryptCost >= bcrypt.MinCost && c.Auth.BcryptCost <= bcrypt.MaxCost, "bcrypt cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+	check(oneOf(c.Auth.TokenBackend, "stateful", "jwt"), "auth token backend must be stateful or jwt")
+	check(c.Auth.TokenBackend != "jwt" || c.Auth.JWTKeys != "", "jwt keys are required by the jwt token backend")
+	check(oneOf(c.Auth.LoginAttemptStore, "postgres", "memory"), "login attempt store must be postgres or memory")
+	check(c.Auth.LoginUserFreeAttempts > 0, "login user free attempts must be positive")
+	check(c.Auth.LoginIPFreeAttempts > 0, "login ip free attempts must be positive")
+	check(c.Auth.LoginBaseDelay > 0, "login base delay must be positive")
+	check(c.Auth.LoginMaxDelay >= c.Auth.LoginBaseDelay, "login max delay can't be shorter than the base delay")
+	check(c.Auth.LoginWindow > 0, "login window must be positive")
+
+	if c.SMTP.Host != "" {
+		check(c.SMTP.Port > 0 && c.SMTP.Port < 65536, "smtp port must be between 1 and 65535")
+		check(c.SMTP.Sender != "", "smtp sender is required with an smtp host")
+	}
+
+	check(oneOf(c.Tracing.Exporter, "none", "stdout", "otlp"), "tracing exporter must be none, stdout or otlp")
+	check(c.Tracing.Exporter != "otlp" || c.Tracing.OTLPEndpoint != "", "otlp endpoint is required by the otlp exporter")
+	check(c.Tracing.SampleRatio >= 0 && c.Tracing.SampleRatio <= 1, "tracing sample ratio must be between 0 and 1")
+	check(c.Tracing.ServiceName != "", "service name is required")
+
+	if len(errs) > 0 {
+		return fmt.Errorf("config: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+func oneOf(value string, allowed ...string) bool {
+	for _, a := range allowed {
+		if value == a {
+			return true
+		}
+	}
+	return false
+}
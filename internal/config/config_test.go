@@ -0,0 +1,165 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func env(vars map[string]string) func(string) string {
+	return func(key string) string {
+		return vars[key]
+	}
+}
+
+func writeFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestLoadDefaults(t *testing.T) {
+	cfg, err := Load(nil, env(nil))
+	require.NoError(t, err)
+	assert.Equal(t, Default(), cfg)
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	path := writeFile(t, `
+port: 9000
+log_level: debug
+db:
+  dsn: host=file
+  max_open_conns: 10
+  max_idle_conns: 5
+http:
+  read_timeout: 5s
+auth:
+  bcrypt_cost: 10
+  password_reset_token_ttl: 1h
+  activation_token_ttl: 24h
+  login_user_free_attempts: 3
+`)
+
+	cfg, err := Load(
+		[]string{"-config", path, "-port", "9100", "-http-read-timeout", "7s"},
+		env(map[string]string{
+			"PORT":                 "9050",
+			"DB_DSN":               "host=env",
+			"DB_MAX_IDLE_CONNS":    "8",
+			"HTTP_READ_TIMEOUT":    "6s",
+			"LOGIN_WINDOW":         "12h",
+			"ACTIVATION_TOKEN_TTL": "48h",
+		}),
+	)
+	require.NoError(t, err)
+
+	// flags beat the environment, which beats the file, which beats the
+	// defaults
+	assert.Equal(t, 9100, cfg.Port)
+	assert.Equal(t, 7*time.Second, cfg.HTTP.ReadTimeout)
+	assert.Equal(t, "host=env", cfg.DB.DSN)
+	assert.Equal(t, 8, cfg.DB.MaxIdleConns)
+	assert.Equal(t, 10, cfg.DB.MaxOpenConns)
+	assert.Equal(t, "debug", cfg.LogLevel)
+	assert.Equal(t, 10, cfg.Auth.BcryptCost)
+	assert.Equal(t, 30*time.Second, cfg.HTTP.WriteTimeout)
+	assert.Equal(t, time.Hour, cfg.Auth.PasswordResetTokenTTL)
+	assert.Equal(t, 48*time.Hour, cfg.Auth.ActivationTokenTTL)
+	assert.Equal(t, 5*time.Minute, cfg.Auth.TwoFactorPendingTTL)
+	assert.Equal(t, 3, cfg.Auth.LoginUserFreeAttempts)
+	assert.Equal(t, 12*time.Hour, cfg.Auth.LoginWindow)
+}
+
+func TestLoadConfigFileFromEnv(t *testing.T) {
+	path := writeFile(t, "port: 9000\n")
+
+	cfg, err := Load(nil, env(map[string]string{"CONFIG_FILE": path}))
+	require.NoError(t, err)
+	assert.Equal(t, 9000, cfg.Port)
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		env  map[string]string
+		file string
+	}{
+		{name: "unknown flag", args: []string{"-nope"}},
+		{name: "bad flag value", args: []string{"-port", "http"}},
+		{name: "bad env value", env: map[string]string{"HTTP_READ_TIMEOUT": "10"}},
+		{name: "unknown file key", file: "prot: 9000\n"},
+		{name: "missing file", args: []string{"-config", "/does/not/exist.yaml"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := tt.args
+			if tt.file != "" {
+				args = append(args, "-config", writeFile(t, tt.file))
+			}
+			_, err := Load(args, env(tt.env))
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestLoadHelp(t *testing.T) {
+	_, err := Load([]string{"-h"}, env(nil))
+	assert.True(t, errors.Is(err, flag.ErrHelp))
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(*Config)
+	}{
+		{name: "port", modify: func(c *Config) { c.Port = 70000 }},
+		{name: "log level", modify: func(c *Config) { c.LogLevel = "verbose" }},
+		{name: "log format", modify: func(c *Config) { c.LogFormat = "xml" }},
+		{name: "dsn", modify: func(c *Config) { c.DB.DSN = "" }},
+		{name: "idle conns", modify: func(c *Config) { c.DB.MaxIdleConns = 50 }},
+		{name: "conn lifetime", modify: func(c *Config) { c.DB.ConnMaxLifetime = -time.Second }},
+		{name: "write timeout", modify: func(c *Config) { c.HTTP.WriteTimeout = 0 }},
+		{name: "shutdown timeout", modify: func(c *Config) { c.HTTP.ShutdownTimeout = 0 }},
+		{name: "refresh ttl", modify: func(c *Config) { c.Auth.RefreshTokenTTL = time.Minute }},
+		{name: "password reset ttl", modify: func(c *Config) { c.Auth.PasswordResetTokenTTL = 0 }},
+		{name: "activation ttl", modify: func(c *Config) { c.Auth.ActivationTokenTTL = 0 }},
+		{name: "two factor pending ttl", modify: func(c *Config) { c.Auth.TwoFactorPendingTTL = -time.Minute }},
+		{name: "bcrypt cost", modify: func(c *Config) { c.Auth.BcryptCost = 2 }},
+		{name: "token backend", modify: func(c *Config) { c.Auth.TokenBackend = "paseto" }},
+		{name: "jwt keys", modify: func(c *Config) { c.Auth.TokenBackend = "jwt" }},
+		{name: "login attempt store", modify: func(c *Config) { c.Auth.LoginAttemptStore = "redis" }},
+		{name: "login free attempts", modify: func(c *Config) { c.Auth.LoginIPFreeAttempts = 0 }},
+		{name: "login max delay", modify: func(c *Config) { c.Auth.LoginMaxDelay = time.Millisecond }},
+		{name: "login window", modify: func(c *Config) { c.Auth.LoginWindow = 0 }},
+		{name: "smtp sender", modify: func(c *Config) { c.SMTP.Host = "smtp.example.com" }},
+		{name: "tracing exporter", modify: func(c *Config) { c.Tracing.Exporter = "jaeger" }},
+		{name: "sample ratio", modify: func(c *Config) { c.Tracing.SampleRatio = 1.5 }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Default()
+			tt.modify(cfg)
+			assert.Error(t, cfg.Validate())
+		})
+	}
+
+	// every problem is reported at once
+	cfg := Default()
+	cfg.Port = 0
+	cfg.DB.DSN = ""
+	err := cfg.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "port")
+	assert.Contains(t, err.Error(), "dsn")
+}
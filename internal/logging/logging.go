@@ -0,0 +1,114 @@
+// Package logging sets up the structured logger of the server. Records
+// logged with the context of a request carry the request ID, the user ID,
+// the trace ID and the route pattern of that request, see WithRequest.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"sync/atomic"
+
+	"github.com/go-chi/chi/v5"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// New returns a logger writing records of level (debug, info, warn or
+// error) and above to w, in format json or text.
+func New(w io.Writer, level, format string) (*slog.Logger, error) {
+	var lvl slog.Level
+	err := lvl.UnmarshalText([]byte(level))
+	if err != nil {
+		return nil, fmt.Errorf("logging: %w", err)
+	}
+
+	opts := &slog.HandlerOptions{Level: lvl}
+	var handler slog.Handler
+	switch strings.ToLower(format) {
+	case "json", "":
+		handler = slog.NewJSONHandler(w, opts)
+	case "text":
+		handler = slog.NewTextHandler(w, opts)
+	default:
+		return nil, fmt.Errorf("logging: unknown format %q", format)
+	}
+
+	return slog.New(&contextHandler{Handler: handler}), nil
+}
+
+// Request is what the logger knows about the request being served. The user
+// is only known once the request is authenticated, so it is set later on.
+type Request struct {
+	ID     string
+	userID atomic.Int64
+}
+
+type contextKey struct{}
+
+// WithRequest returns a copy of ctx whose log records are tagged with req.
+func WithRequest(ctx context.Context, req *Request) context.Context {
+	return context.WithValue(ctx, contextKey{}, req)
+}
+
+func requestFrom(ctx context.Context) *Request {
+	req, _ := ctx.Value(contextKey{}).(*Request)
+	return req
+}
+
+// SetUserID tags the records of the request of ctx with the authenticated
+// user.
+func SetUserID(ctx context.Context, userID int) {
+	req := requestFrom(ctx)
+	if req != nil {
+		req.userID.Store(int64(userID))
+	}
+}
+
+// Attrs returns the attributes of the request of ctx.
+func Attrs(ctx context.Context) []slog.Attr {
+	if ctx == nil {
+		return nil
+	}
+
+	var attrs []slog.Attr
+	req := requestFrom(ctx)
+	if req != nil {
+		attrs = append(attrs, slog.String("request_id", req.ID))
+		if userID := req.userID.Load(); userID != 0 {
+			attrs = append(attrs, slog.Int64("user_id", userID))
+		}
+	}
+
+	if span := trace.SpanContextFromContext(ctx); span.IsValid() {
+		attrs = append(attrs, slog.String("trace_id", span.TraceID().String()))
+	}
+
+	rctx := chi.RouteContext(ctx)
+	if rctx != nil {
+		if pattern := rctx.RoutePattern(); pattern != "" {
+			attrs = append(attrs, slog.String("route", pattern))
+		}
+	}
+	return attrs
+}
+
+// contextHandler adds the attributes of the request to every record logged
+// with its context.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h *contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	record.AddAttrs(Attrs(ctx)...)
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h *contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+func (h *contextHandler) WithGroup(name string) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithGroup(name)}
+}
@@ -0,0 +1,58 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestAttrs(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := New(&buf, "info", "json")
+	require.NoError(t, err)
+
+	r := chi.NewRouter()
+	r.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(WithRequest(r.Context(), &Request{ID: "abc123"})))
+		})
+	})
+	r.Get("/workouts/{id}", func(w http.ResponseWriter, r *http.Request) {
+		SetUserID(r.Context(), 7)
+		logger.ErrorContext(r.Context(), "GetWorkoutByID", "error", "boom")
+	})
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/workouts/1", nil))
+
+	var record map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &record))
+	assert.Equal(t, "ERROR", record["level"])
+	assert.Equal(t, "GetWorkoutByID", record["msg"])
+	assert.Equal(t, "boom", record["error"])
+	assert.Equal(t, "abc123", record["request_id"])
+	assert.Equal(t, float64(7), record["user_id"])
+	assert.Equal(t, "/workouts/{id}", record["route"])
+}
+
+func TestLevelAndFormat(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := New(&buf, "warn", "text")
+	require.NoError(t, err)
+
+	// records without a request context have no request attributes
+	logger.InfoContext(context.Background(), "dropped")
+	logger.Warn("kept", "port", 8080)
+	assert.NotContains(t, buf.String(), "dropped")
+	assert.Contains(t, buf.String(), "level=WARN msg=kept port=8080\n")
+
+	_, err = New(&buf, "verbose", "json")
+	assert.Error(t, err)
+	_, err = New(&buf, "info", "xml")
+	assert.Error(t, err)
+}
@@ -0,0 +1,31 @@
+package mailer
+
+import (
+	"fmt"
+	"io"
+	"sync"
+)
+
+// LogMailer writes emails to w instead of delivering them, for local
+// development and tests.
+type LogMailer struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewLogMailer(w io.Writer) *LogMailer {
+	return &LogMailer{w: w}
+}
+
+func (m *LogMailer) Send(recipient, templateFile string, data any) error {
+	msg, err := render(recipient, templateFile, data)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, err = fmt.Fprintf(m.w, "To: %s\nSubject: %s\n\n%s\n----\n", msg.To, msg.Subject, msg.Body)
+	return err
+}
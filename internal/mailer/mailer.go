@@ -0,0 +1,50 @@
+package mailer
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"text/template"
+)
+
+//go:embed templates/*.tmpl
+var templateFS embed.FS
+
+// Mailer delivers the emails the service sends. templateFile names one of
+// the files in templates/, which define a "subject" and a "plainBody"
+// template rendered with data.
+type Mailer interface {
+	Send(recipient, templateFile string, data any) error
+}
+
+// Message is a rendered email.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+func render(recipient, templateFile string, data any) (*Message, error) {
+	tmpl, err := template.New("email").ParseFS(templateFS, "templates/"+templateFile)
+	if err != nil {
+		return nil, fmt.Errorf("mailer: parse %s: %w", templateFile, err)
+	}
+
+	subject := new(bytes.Buffer)
+	err = tmpl.ExecuteTemplate(subject, "subject", data)
+	if err != nil {
+		return nil, fmt.Errorf("mailer: render subject: %w", err)
+	}
+
+	body := new(bytes.Buffer)
+	err = tmpl.ExecuteTemplate(body, "plainBody", data)
+	if err != nil {
+		return nil, fmt.Errorf("mailer: render body: %w", err)
+	}
+
+	return &Message{
+		To:      recipient,
+		Subject: subject.String(),
+		Body:    body.String(),
+	}, nil
+}
@@ -0,0 +1,31 @@
+package mailer
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogMailer(t *testing.T) {
+	var buf bytes.Buffer
+	m := NewLogMailer(&buf)
+
+	err := m.Send("john@example.com", "password_reset.tmpl", map[string]any{
+		"Username":  "john",
+		"Token":     "ABCDEF",
+		"ExpiresIn": "45 minutes",
+	})
+	require.NoError(t, err)
+
+	out := buf.String()
+	assert.Contains(t, out, "To: john@example.com")
+	assert.Contains(t, out, "Subject: Reset your password")
+	assert.Contains(t, out, `"token": "ABCDEF"`)
+}
+
+func TestUnknownTemplate(t *testing.T) {
+	m := NewLogMailer(&bytes.Buffer{})
+	assert.Error(t, m.Send("john@example.com", "missing.tmpl", nil))
+}
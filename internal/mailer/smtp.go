@@ -0,0 +1,52 @@
+package mailer
+
+import (
+	"fmt"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type SMTPMailer struct {
+	addr   string
+	auth   smtp.Auth
+	sender string
+}
+
+// NewSMTPMailer sends through the SMTP server at host:port, authenticating
+// with PLAIN auth when a username is given.
+func NewSMTPMailer(host string, port int, username, password, sender string) *SMTPMailer {
+	m := &SMTPMailer{
+		addr:   net.JoinHostPort(host, strconv.Itoa(port)),
+		sender: sender,
+	}
+	if username != "" {
+		m.auth = smtp.PlainAuth("", username, password, host)
+	}
+	return m
+}
+
+func (m *SMTPMailer) Send(recipient, templateFile string, data any) error {
+	msg, err := render(recipient, templateFile, data)
+	if err != nil {
+		return err
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "From: %s\r\n", m.sender)
+	fmt.Fprintf(&b, "Subject: %s\r\n", msg.Subject)
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+
+	err = smtp.SendMail(m.addr, m.auth, m.sender, []string{recipient}, []byte(b.String()))
+	if err != nil {
+		return fmt.Errorf("mailer: send to %s: %w", recipient, err)
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+// Package metrics collects the Prometheus metrics of the server, served at
+// GET /metrics.
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	chimiddleware "github.com/go-chi/chi/v5/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "workouts"
+
+// Login results, the result label of workouts_logins_total.
+const (
+	LoginSucceeded = "success"
+	LoginFailed    = "failure"
+	LoginThrottled = "throttled"
+)
+
+type Metrics struct {
+	registry *prometheus.Registry
+
+	requests        *prometheus.CounterVec
+	requestDuration *prometheus.HistogramVec
+
+	workouts      *prometheus.CounterVec
+	editConflicts prometheus.Counter
+	logins        *prometheus.CounterVec
+}
+
+// New registers the metrics of the server, including the connection pool
+// stats of db and the Go runtime.
+func New(db *sql.DB) *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "HTTP requests served, by route pattern and status.",
+		}, []string{"method", "route", "status"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Time taken to serve HTTP requests, by route pattern and status.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "route", "status"}),
+		workouts: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "workouts_total",
+			Help:      "Workouts created, updated and deleted.",
+		}, []string{"operation"}),
+		editConflicts: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "workout_edit_conflicts_total",
+			Help:      "Workout changes rejected because the workout was modified by another request.",
+		}),
+		logins: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "logins_total",
+			Help:      "Password logins, by result.",
+		}, []string{"result"}),
+	}
+
+	m.registry.MustRegister(
+		m.requests,
+		m.requestDuration,
+		m.workouts,
+		m.editConflicts,
+		m.logins,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	if db != nil {
+		m.registry.MustRegister(collectors.NewDBStatsCollector(db, "postgres"))
+	}
+
+	// the series are there from the start, so rates work right away
+	for _, op := range []string{"created", "updated", "deleted"} {
+		m.workouts.WithLabelValues(op)
+	}
+	for _, result := range []string{LoginSucceeded, LoginFailed, LoginThrottled} {
+		m.logins.WithLabelValues(result)
+	}
+	return m
+}
+
+// Handler serves the metrics in the Prometheus exposition format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// Middleware counts and times the requests. They are labelled by the chi
+// route pattern rather than the path, so /workouts/1 and /workouts/2 are the
+// same series.
+func (m *Metrics) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ww := chimiddleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+
+		route := "unmatched"
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			route = rctx.RoutePattern()
+		}
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		labels := prometheus.Labels{"method": r.Method, "route": route, "status": strconv.Itoa(status)}
+		m.requests.With(labels).Inc()
+		m.requestDuration.With(labels).Observe(time.Since(start).Seconds())
+	})
+}
+
+// WorkoutCreated counts every logged workout, whether posted directly or
+// started from a template or an assignment.
+func (m *Metrics) WorkoutCreated() {
+	m.workouts.WithLabelValues("created").Inc()
+}
+
+func (m *Metrics) WorkoutUpdated() {
+	m.workouts.WithLabelValues("updated").Inc()
+}
+
+func (m *Metrics) WorkoutDeleted() {
+	m.workouts.WithLabelValues("deleted").Inc()
+}
+
+// EditConflict counts a change rejected by the optimistic concurrency
+// check of a workout, see store.ErrEditConflict.
+func (m *Metrics) EditConflict() {
+	m.editConflicts.Inc()
+}
+
+// Login counts a password login with result LoginSucceeded, LoginFailed or
+// LoginThrottled. With two-factor authentication a matching password is
+// counted once the code was checked.
+func (m *Metrics) Login(result string) {
+	m.logins.WithLabelValues(result).Inc()
+}
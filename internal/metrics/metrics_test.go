@@ -0,0 +1,60 @@
+package metrics
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func scrape(t *testing.T, m *Metrics) string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	body, err := io.ReadAll(rec.Body)
+	require.NoError(t, err)
+	return string(body)
+}
+
+func TestMiddlewareLabelsByRoutePattern(t *testing.T) {
+	m := New(nil)
+
+	r := chi.NewRouter()
+	r.Use(m.Middleware)
+	r.Get("/workouts/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+
+	for _, path := range []string{"/workouts/1", "/workouts/2", "/nope"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	body := scrape(t, m)
+	assert.Contains(t, body, `workouts_http_requests_total{method="GET",route="/workouts/{id}",status="404"} 2`)
+	assert.Contains(t, body, `workouts_http_requests_total{method="GET",route="unmatched",status="404"} 1`)
+	assert.Contains(t, body, `workouts_http_request_duration_seconds_count{method="GET",route="/workouts/{id}",status="404"} 2`)
+}
+
+func TestBusinessCounters(t *testing.T) {
+	m := New(nil)
+
+	m.WorkoutCreated()
+	m.WorkoutCreated()
+	m.WorkoutDeleted()
+	m.EditConflict()
+	m.Login(LoginFailed)
+
+	body := scrape(t, m)
+	assert.Contains(t, body, `workouts_workouts_total{operation="created"} 2`)
+	assert.Contains(t, body, `workouts_workouts_total{operation="updated"} 0`)
+	assert.Contains(t, body, `workouts_workouts_total{operation="deleted"} 1`)
+	assert.Contains(t, body, `workouts_workout_edit_conflicts_total 1`)
+	assert.Contains(t, body, `workouts_logins_total{result="failure"} 1`)
+	assert.Contains(t, body, `workouts_logins_total{result="success"} 0`)
+}
@@ -2,24 +2,36 @@ package middleware
 
 import (
 	"context"
-	"fmt"
+	"log/slog"
 	"net/http"
 	"strings"
 
+	"github.com/shiponcs/femProject/internal/auth"
+	"github.com/shiponcs/femProject/internal/logging"
+	"github.com/shiponcs/femProject/internal/policy"
 	"github.com/shiponcs/femProject/internal/store"
 	"github.com/shiponcs/femProject/internal/tokens"
 	"github.com/shiponcs/femProject/utils"
 )
 
 type UserMiddleware struct {
-	UserStore store.UserStore
+	AccessTokens auth.AccessTokens
+	APIKeyStore  store.APIKeyStore
+	Logger       *slog.Logger
 }
 
 type contextKey string
 
-const UserContextKey = contextKey("user")
+const (
+	UserContextKey   = contextKey("user")
+	APIKeyContextKey = contextKey("api_key")
+	scopeCheckedKey  = contextKey("scope_checked")
+)
 
 func SetUser(r *http.Request, user *store.User) *http.Request {
+	if !user.IsAnonymous() {
+		logging.SetUserID(r.Context(), user.ID)
+	}
 	ctx := context.WithValue(r.Context(), UserContextKey, user)
 	return r.WithContext(ctx)
 }
@@ -32,6 +44,13 @@ func GetUser(r *http.Request) *store.User {
 	return user
 }
 
+// GetAPIKey returns the API key the request was made with, nil for
+// requests made with a session token.
+func GetAPIKey(r *http.Request) *store.APIKey {
+	key, _ := r.Context().Value(APIKeyContextKey).(*store.APIKey)
+	return key
+}
+
 func (um *UserMiddleware) Authenticate(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Add("Vary", "Authorization")
@@ -50,9 +69,14 @@ func (um *UserMiddleware) Authenticate(next http.Handler) http.Handler {
 		}
 
 		token := headerParts[1]
-		user, err := um.UserStore.GetUserToken(tokens.ScopeAuth, token)
+		if tokens.IsAPIKey(token) {
+			um.authenticateAPIKey(w, r, next, token)
+			return
+		}
+
+		user, err := um.AccessTokens.Authenticate(r.Context(), token)
 		if err != nil {
-			fmt.Println("ERROR GetUserToken: ", err)
+			um.Logger.ErrorContext(r.Context(), "Authenticate", "error", err)
 			utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "invalid token"})
 			return
 		}
@@ -67,6 +91,42 @@ func (um *UserMiddleware) Authenticate(next http.Handler) http.Handler {
 	})
 }
 
+func (um *UserMiddleware) authenticateAPIKey(w http.ResponseWriter, r *http.Request, next http.Handler, plaintext string) {
+	user, key, err := um.APIKeyStore.GetUserByAPIKey(plaintext)
+	if err != nil {
+		um.Logger.ErrorContext(r.Context(), "GetUserByAPIKey", "error", err)
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "invalid api key"})
+		return
+	}
+
+	if user == nil {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "api key expired or revoked"})
+		return
+	}
+
+	r = SetUser(r, user)
+	r = r.WithContext(context.WithValue(r.Context(), APIKeyContextKey, key))
+	next.ServeHTTP(w, r)
+}
+
+// RequireScope opens a route to API keys granted scope. Routes without it
+// can only be used with a session token.
+func (um *UserMiddleware) RequireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := GetAPIKey(r)
+			if key != nil {
+				if !key.HasScope(scope) {
+					utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "api key is missing the " + scope + " scope"})
+					return
+				}
+				r = r.WithContext(context.WithValue(r.Context(), scopeCheckedKey, true))
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
 func (um *UserMiddleware) RequireUser(next http.HandlerFunc) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		user := GetUser(r)
@@ -75,6 +135,39 @@ func (um *UserMiddleware) RequireUser(next http.HandlerFunc) http.HandlerFunc {
 			utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "you must be logged in"})
 			return
 		}
+
+		if checked, _ := r.Context().Value(scopeCheckedKey).(bool); GetAPIKey(r) != nil && !checked {
+			utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "api keys can't access this resource"})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequireActivatedUser is RequireUser for routes that also need a verified
+// email address.
+func (um *UserMiddleware) RequireActivatedUser(next http.HandlerFunc) http.HandlerFunc {
+	return um.RequireUser(func(w http.ResponseWriter, r *http.Request) {
+		user := GetUser(r)
+
+		if !user.Activated {
+			utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "your account must be activated to access this resource"})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequirePermission is RequireUser for routes reserved to roles granted
+// perm.
+func (um *UserMiddleware) RequirePermission(perm policy.Permission, next http.HandlerFunc) http.HandlerFunc {
+	return um.RequireUser(func(w http.ResponseWriter, r *http.Request) {
+		user := GetUser(r)
+
+		if !policy.Can(user, perm) {
+			utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "you are not allowed to access this resource"})
+			return
+		}
 		next.ServeHTTP(w, r)
 	})
 }
@@ -0,0 +1,69 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"time"
+
+	chimiddleware "github.com/go-chi/chi/v5/middleware"
+	"github.com/shiponcs/femProject/internal/logging"
+)
+
+const requestIDHeader = "X-Request-ID"
+
+// requestID keeps the ID a proxy in front of us gave the request, so the
+// logs of both can be matched, or makes up a new one.
+func requestID(r *http.Request) string {
+	id := r.Header.Get(requestIDHeader)
+	if id != "" && len(id) <= 64 && isPrintable(id) {
+		return id
+	}
+
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func isPrintable(s string) bool {
+	for _, c := range s {
+		if c < 0x21 || c > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// RequestLogger tags the context of every request for logger, see
+// logging.WithRequest, and logs the request once it is served.
+func RequestLogger(logger *slog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			req := &logging.Request{ID: requestID(r)}
+			w.Header().Set(requestIDHeader, req.ID)
+
+			ww := chimiddleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			r = r.WithContext(logging.WithRequest(r.Context(), req))
+			next.ServeHTTP(ww, r)
+
+			status := ww.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+			level := slog.LevelInfo
+			if status >= http.StatusInternalServerError {
+				level = slog.LevelError
+			}
+
+			logger.LogAttrs(r.Context(), level, "request",
+				slog.String("method", r.Method),
+				slog.String("path", r.URL.Path),
+				slog.Int("status", status),
+				slog.Int("bytes", ww.BytesWritten()),
+				slog.Duration("latency", time.Since(start)),
+			)
+		})
+	}
+}
@@ -0,0 +1,119 @@
+// Package policy decides what a user may do. Roles grant permissions,
+// resources owned by a user are open to their owner, and coaches reach the
+// workouts of athletes who granted them access.
+package policy
+
+import (
+	"context"
+	"errors"
+
+	"github.com/shiponcs/femProject/internal/store"
+)
+
+var ErrForbidden = errors.New("forbidden")
+
+type Permission string
+
+const (
+	ManageUsers      Permission = "users:manage"
+	ReadAnyWorkout   Permission = "workouts:read-any"
+	DeleteAnyWorkout Permission = "workouts:delete-any"
+	CoachAthletes    Permission = "athletes:coach"
+	ManageExercises  Permission = "exercises:manage"
+)
+
+var rolePermissions = map[string][]Permission{
+	store.RoleUser:  {},
+	store.RoleCoach: {CoachAthletes},
+	store.RoleAdmin: {ManageUsers, ManageExercises, ReadAnyWorkout, DeleteAnyWorkout},
+}
+
+// Can reports whether the role of user grants perm.
+func Can(user *store.User, perm Permission) bool {
+	for _, p := range rolePermissions[user.Role] {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+type Action int
+
+const (
+	ReadWorkout Action = iota
+	UpdateWorkout
+	DeleteWorkout
+	CommentWorkout
+)
+
+type Policy struct {
+	coachStore store.CoachStore
+}
+
+func New(coachStore store.CoachStore) *Policy {
+	return &Policy{coachStore: coachStore}
+}
+
+// AuthorizeWorkout returns ErrForbidden unless user may perform action on a
+// workout of ownerID. Owners can do everything, admins can read and delete
+// any workout, and coaches can read and comment on the workouts of their
+// athletes.
+func (p *Policy) AuthorizeWorkout(ctx context.Context, user *store.User, action Action, ownerID int) error {
+	if user.ID == ownerID {
+		return nil
+	}
+
+	switch action {
+	case ReadWorkout:
+		if Can(user, ReadAnyWorkout) {
+			return nil
+		}
+	case DeleteWorkout:
+		if Can(user, DeleteAnyWorkout) {
+			return nil
+		}
+	}
+
+	if (action == ReadWorkout || action == CommentWorkout) && Can(user, CoachAthletes) {
+		ok, err := p.coachStore.IsCoachOf(ctx, user.ID, ownerID)
+		if err != nil {
+			return err
+		}
+		if ok {
+			return nil
+		}
+	}
+
+	return ErrForbidden
+}
+
+// AuthorizeTemplate returns ErrForbidden unless user may perform action on a
+// template of ownerID. Templates are planned workouts so the rules of
+// AuthorizeWorkout apply, starting a workout from a template reads it.
+func (p *Policy) AuthorizeTemplate(ctx context.Context, user *store.User, action Action, ownerID int) error {
+	return p.AuthorizeWorkout(ctx, user, action, ownerID)
+}
+
+// AuthorizeProgram is AuthorizeTemplate for programs and the enrollments of
+// ownerID. Enrolling in a program reads it.
+func (p *Policy) AuthorizeProgram(ctx context.Context, user *store.User, action Action, ownerID int) error {
+	return p.AuthorizeWorkout(ctx, user, action, ownerID)
+}
+
+// AuthorizeAthlete returns ErrForbidden unless user coaches athleteID, which
+// takes the coach role and an invitation the athlete accepted.
+func (p *Policy) AuthorizeAthlete(ctx context.Context, user *store.User, athleteID int) error {
+	if !Can(user, CoachAthletes) {
+		return ErrForbidden
+	}
+
+	ok, err := p.coachStore.IsCoachOf(ctx, user.ID, athleteID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrForbidden
+	}
+	return nil
+}
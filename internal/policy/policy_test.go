@@ -0,0 +1,98 @@
+package policy
+
+import (
+	"context"
+	"testing"
+
+	"github.com/shiponcs/femProject/internal/store"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeCoachStore struct {
+	store.CoachStore
+	athletes map[int][]int
+}
+
+func (f *fakeCoachStore) IsCoachOf(ctx context.Context, coachID, athleteID int) (bool, error) {
+	for _, id := range f.athletes[coachID] {
+		if id == athleteID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func TestAuthorizeWorkout(t *testing.T) {
+	owner := &store.User{ID: 1, Role: store.RoleUser}
+	stranger := &store.User{ID: 2, Role: store.RoleUser}
+	coach := &store.User{ID: 3, Role: store.RoleCoach}
+	otherCoach := &store.User{ID: 4, Role: store.RoleCoach}
+	admin := &store.User{ID: 5, Role: store.RoleAdmin}
+
+	p := New(&fakeCoachStore{athletes: map[int][]int{3: {1}}})
+
+	tests := []struct {
+		name    string
+		user    *store.User
+		action  Action
+		allowed bool
+	}{
+		{name: "owner reads", user: owner, action: ReadWorkout, allowed: true},
+		{name: "owner updates", user: owner, action: UpdateWorkout, allowed: true},
+		{name: "owner deletes", user: owner, action: DeleteWorkout, allowed: true},
+		{name: "stranger reads", user: stranger, action: ReadWorkout},
+		{name: "stranger comments", user: stranger, action: CommentWorkout},
+		{name: "coach reads", user: coach, action: ReadWorkout, allowed: true},
+		{name: "coach comments", user: coach, action: CommentWorkout, allowed: true},
+		{name: "coach updates", user: coach, action: UpdateWorkout},
+		{name: "coach deletes", user: coach, action: DeleteWorkout},
+		{name: "coach without access reads", user: otherCoach, action: ReadWorkout},
+		{name: "admin reads", user: admin, action: ReadWorkout, allowed: true},
+		{name: "admin deletes", user: admin, action: DeleteWorkout, allowed: true},
+		{name: "admin updates", user: admin, action: UpdateWorkout},
+		{name: "admin comments", user: admin, action: CommentWorkout},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := p.AuthorizeWorkout(context.Background(), tt.user, tt.action, owner.ID)
+			if tt.allowed {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorIs(t, err, ErrForbidden)
+		})
+	}
+}
+
+func TestAuthorizeTemplateAndProgram(t *testing.T) {
+	p := New(&fakeCoachStore{athletes: map[int][]int{3: {1}}})
+	coach := &store.User{ID: 3, Role: store.RoleCoach}
+	admin := &store.User{ID: 5, Role: store.RoleAdmin}
+
+	assert.NoError(t, p.AuthorizeTemplate(context.Background(), &store.User{ID: 1}, UpdateWorkout, 1))
+	assert.NoError(t, p.AuthorizeTemplate(context.Background(), coach, ReadWorkout, 1))
+	assert.ErrorIs(t, p.AuthorizeTemplate(context.Background(), coach, UpdateWorkout, 1), ErrForbidden)
+	assert.ErrorIs(t, p.AuthorizeTemplate(context.Background(), coach, ReadWorkout, 2), ErrForbidden)
+	assert.NoError(t, p.AuthorizeProgram(context.Background(), admin, DeleteWorkout, 1))
+	assert.ErrorIs(t, p.AuthorizeProgram(context.Background(), admin, UpdateWorkout, 1), ErrForbidden)
+	assert.ErrorIs(t, p.AuthorizeProgram(context.Background(), &store.User{ID: 2, Role: store.RoleUser}, ReadWorkout, 1), ErrForbidden)
+}
+
+func TestCan(t *testing.T) {
+	assert.True(t, Can(&store.User{Role: store.RoleAdmin}, ManageUsers))
+	assert.False(t, Can(&store.User{Role: store.RoleCoach}, ManageUsers))
+	assert.True(t, Can(&store.User{Role: store.RoleAdmin}, ManageExercises))
+	assert.False(t, Can(&store.User{Role: store.RoleUser}, ManageExercises))
+	assert.False(t, Can(&store.User{Role: store.RoleUser}, CoachAthletes))
+	assert.False(t, Can(&store.User{}, CoachAthletes))
+}
+
+func TestAuthorizeAthlete(t *testing.T) {
+	p := New(&fakeCoachStore{athletes: map[int][]int{3: {1}, 5: {1}}})
+
+	assert.NoError(t, p.AuthorizeAthlete(context.Background(), &store.User{ID: 3, Role: store.RoleCoach}, 1))
+	assert.ErrorIs(t, p.AuthorizeAthlete(context.Background(), &store.User{ID: 3, Role: store.RoleCoach}, 2), ErrForbidden)
+	// an accepted invitation doesn't outlive the coach role
+	assert.ErrorIs(t, p.AuthorizeAthlete(context.Background(), &store.User{ID: 5, Role: store.RoleUser}, 1), ErrForbidden)
+}
@@ -1,26 +1,115 @@
 package routes
 
 import (
+	"net/http"
+
 	"github.com/go-chi/chi/v5"
 	"github.com/shiponcs/femProject/internal/app"
+	"github.com/shiponcs/femProject/internal/middleware"
+	"github.com/shiponcs/femProject/internal/policy"
+	"github.com/shiponcs/femProject/internal/store"
+	"github.com/shiponcs/femProject/internal/tracing"
 )
 
 func SetupRoutes(app *app.Application) *chi.Mux {
 	r := chi.NewRouter()
+	r.Use(tracing.Middleware)
+	r.Use(middleware.RequestLogger(app.Logger))
+	r.Use(app.Metrics.Middleware)
+
+	// API keys can only use the routes opened to one of their scopes
+	readWorkouts := app.MiddleWare.RequireScope(store.APIScopeWorkoutsRead)
+	writeWorkouts := app.MiddleWare.RequireScope(store.APIScopeWorkoutsWrite)
+	readAnalytics := app.MiddleWare.RequireScope(store.APIScopeAnalyticsRead)
 
 	r.Group(func(r chi.Router) {
 		r.Use(app.MiddleWare.Authenticate)
 
-		r.Get("/workouts/{id}", app.MiddleWare.RequireUser(app.WorkoutHandler.HandleGetWorkoutByID))
-		r.Post("/workouts", app.MiddleWare.RequireUser(app.WorkoutHandler.HandleCreateWorkout))
-		r.Put("/workouts/{id}", app.MiddleWare.RequireUser(app.WorkoutHandler.HandleUpdateWorkoutByID))
-		r.Delete("/workouts/{id}", app.MiddleWare.RequireUser(app.WorkoutHandler.HandleDeleteWorkoutByID))
+		r.With(readWorkouts).Get("/workouts", app.MiddleWare.RequireUser(app.WorkoutHandler.HandleListWorkouts))
+		r.With(readWorkouts).Get("/workouts/{id}", app.MiddleWare.RequireUser(app.WorkoutHandler.HandleGetWorkoutByID))
+		r.With(writeWorkouts).Post("/workouts", app.MiddleWare.RequireActivatedUser(app.WorkoutHandler.HandleCreateWorkout))
+		r.With(writeWorkouts).Put("/workouts/{id}", app.MiddleWare.RequireActivatedUser(app.WorkoutHandler.HandleUpdateWorkoutByID))
+		r.With(writeWorkouts).Delete("/workouts/{id}", app.MiddleWare.RequireActivatedUser(app.WorkoutHandler.HandleDeleteWorkoutByID))
+
+		r.With(writeWorkouts).Post("/workouts/{id}/entries", app.MiddleWare.RequireActivatedUser(app.WorkoutHandler.HandleCreateWorkoutEntry))
+		r.With(writeWorkouts).Put("/workouts/{id}/entries/order", app.MiddleWare.RequireActivatedUser(app.WorkoutHandler.HandleReorderWorkoutEntries))
+		r.With(writeWorkouts).Patch("/workouts/{id}/entries/{entryID}", app.MiddleWare.RequireActivatedUser(app.WorkoutHandler.HandleUpdateWorkoutEntry))
+		r.With(writeWorkouts).Delete("/workouts/{id}/entries/{entryID}", app.MiddleWare.RequireActivatedUser(app.WorkoutHandler.HandleDeleteWorkoutEntry))
+
+		r.With(readWorkouts).Get("/workouts/{id}/comments", app.MiddleWare.RequireUser(app.WorkoutHandler.HandleListWorkoutComments))
+		r.Post("/workouts/{id}/comments", app.MiddleWare.RequireActivatedUser(app.WorkoutHandler.HandleCreateWorkoutComment))
+
+		r.With(readWorkouts).Get("/exercises", app.MiddleWare.RequireUser(app.ExerciseHandler.HandleListExercises))
+		r.With(readWorkouts).Get("/exercises/{id}", app.MiddleWare.RequireUser(app.ExerciseHandler.HandleGetExerciseByID))
+		r.Post("/exercises", app.MiddleWare.RequirePermission(policy.ManageExercises, app.ExerciseHandler.HandleCreateExercise))
+		r.Put("/exercises/{id}", app.MiddleWare.RequirePermission(policy.ManageExercises, app.ExerciseHandler.HandleUpdateExercise))
+		r.Delete("/exercises/{id}", app.MiddleWare.RequirePermission(policy.ManageExercises, app.ExerciseHandler.HandleDeleteExercise))
+
+		r.Get("/templates", app.MiddleWare.RequireUser(app.TemplateHandler.HandleListTemplates))
+		r.Get("/templates/{id}", app.MiddleWare.RequireUser(app.TemplateHandler.HandleGetTemplateByID))
+		r.Post("/templates", app.MiddleWare.RequireUser(app.TemplateHandler.HandleCreateTemplate))
+		r.Put("/templates/{id}", app.MiddleWare.RequireUser(app.TemplateHandler.HandleUpdateTemplate))
+		r.Delete("/templates/{id}", app.MiddleWare.RequireUser(app.TemplateHandler.HandleDeleteTemplate))
+		r.Post("/templates/{id}/workouts", app.MiddleWare.RequireActivatedUser(app.TemplateHandler.HandleStartWorkout))
+
+		r.Get("/programs", app.MiddleWare.RequireUser(app.ProgramHandler.HandleListPrograms))
+		r.Get("/programs/{id}", app.MiddleWare.RequireUser(app.ProgramHandler.HandleGetProgramByID))
+		r.Post("/programs", app.MiddleWare.RequireUser(app.ProgramHandler.HandleCreateProgram))
+		r.Delete("/programs/{id}", app.MiddleWare.RequireUser(app.ProgramHandler.HandleDeleteProgram))
+		r.Post("/programs/{id}/enrollments", app.MiddleWare.RequireUser(app.ProgramHandler.HandleEnroll))
+		r.Get("/enrollments/{id}", app.MiddleWare.RequireUser(app.ProgramHandler.HandleGetEnrollment))
+		r.Get("/schedule", app.MiddleWare.RequireUser(app.ProgramHandler.HandleGetSchedule))
+		r.Put("/schedule/{id}/workout", app.MiddleWare.RequireUser(app.ProgramHandler.HandleCompleteSession))
+
+		r.With(readAnalytics).Get("/users/me/records", app.MiddleWare.RequireUser(app.RecordHandler.HandleListMyRecords))
+		r.Get("/users/me/sessions", app.MiddleWare.RequireUser(app.TokenHandler.HandleListSessions))
+		r.Delete("/users/me/sessions", app.MiddleWare.RequireUser(app.TokenHandler.HandleDeleteAllSessions))
+		r.Delete("/users/me/sessions/{id}", app.MiddleWare.RequireUser(app.TokenHandler.HandleDeleteSession))
+		r.Delete("/tokens/current", app.MiddleWare.RequireUser(app.TokenHandler.HandleDeleteCurrentToken))
+
+		r.Post("/users/me/2fa", app.MiddleWare.RequireUser(app.TwoFactorHandler.HandleStartEnrollment))
+		r.Post("/users/me/2fa/confirm", app.MiddleWare.RequireUser(app.TwoFactorHandler.HandleConfirmEnrollment))
+		r.Delete("/users/me/2fa", app.MiddleWare.RequireUser(app.TwoFactorHandler.HandleDisable))
+
+		r.Get("/users/me/api-keys", app.MiddleWare.RequireUser(app.APIKeyHandler.HandleListAPIKeys))
+		r.Post("/users/me/api-keys", app.MiddleWare.RequireUser(app.APIKeyHandler.HandleCreateAPIKey))
+		r.Delete("/users/me/api-keys/{id}", app.MiddleWare.RequireUser(app.APIKeyHandler.HandleDeleteAPIKey))
+
+		r.Get("/users/me/coaches", app.MiddleWare.RequireUser(app.CoachHandler.HandleListCoaches))
+		r.Put("/users/me/coaches/{id}", app.MiddleWare.RequireUser(app.CoachHandler.HandleAcceptCoach))
+		r.Delete("/users/me/coaches/{id}", app.MiddleWare.RequireUser(app.CoachHandler.HandleRevokeCoach))
+		r.Get("/users/me/assignments", app.MiddleWare.RequireUser(app.CoachHandler.HandleListMyAssignments))
+		r.Post("/users/me/assignments/{id}/workout", app.MiddleWare.RequireActivatedUser(app.CoachHandler.HandleStartAssignment))
+
+		r.Get("/coach/athletes", app.MiddleWare.RequirePermission(policy.CoachAthletes, app.CoachHandler.HandleListAthletes))
+		r.Post("/coach/athletes", app.MiddleWare.RequirePermission(policy.CoachAthletes, app.CoachHandler.HandleInviteAthlete))
+		r.Delete("/coach/athletes/{id}", app.MiddleWare.RequirePermission(policy.CoachAthletes, app.CoachHandler.HandleRemoveAthlete))
+		r.Get("/coach/athletes/{id}/workouts", app.MiddleWare.RequirePermission(policy.CoachAthletes, app.WorkoutHandler.HandleListAthleteWorkouts))
+		r.Get("/coach/athletes/{id}/assignments", app.MiddleWare.RequirePermission(policy.CoachAthletes, app.CoachHandler.HandleListAthleteAssignments))
+		r.Post("/coach/athletes/{id}/assignments", app.MiddleWare.RequirePermission(policy.CoachAthletes, app.CoachHandler.HandleCreateAssignment))
+
+		r.Get("/admin/users", app.MiddleWare.RequirePermission(policy.ManageUsers, app.AdminHandler.HandleListUsers))
+		r.Put("/admin/users/{id}/role", app.MiddleWare.RequirePermission(policy.ManageUsers, app.AdminHandler.HandleUpdateRole))
+		r.Delete("/admin/users/{id}", app.MiddleWare.RequirePermission(policy.ManageUsers, app.AdminHandler.HandleDeleteUser))
+		r.Delete("/admin/users/{id}/lockout", app.MiddleWare.RequirePermission(policy.ManageUsers, app.AdminHandler.HandleUnlockUser))
+
+		r.With(readAnalytics).Get("/analytics/totals", app.MiddleWare.RequireUser(app.AnalyticsHandler.HandleGetTotals))
+		r.With(readAnalytics).Get("/analytics/exercises/{id}", app.MiddleWare.RequireUser(app.AnalyticsHandler.HandleGetExerciseProgression))
+		r.With(readAnalytics).Get("/analytics/muscle-groups", app.MiddleWare.RequireUser(app.AnalyticsHandler.HandleGetMuscleGroupVolume))
 
 	})
 
 	r.Get("/health", app.HealthCheck)
+	r.Get("/ready", app.ReadinessCheck)
+	r.Method(http.MethodGet, "/metrics", app.Metrics.Handler())
 	r.Post("/users", app.UserHandler.HandleRegisterUser)
 	r.Post("/tokens/authentication", app.TokenHandler.HandleCreateToken)
+	r.Post("/tokens/refresh", app.TokenHandler.HandleRefreshToken)
+	r.Post("/tokens/2fa", app.TokenHandler.HandleVerifyTwoFactor)
+	r.Post("/tokens/password-reset", app.TokenHandler.HandleCreatePasswordResetToken)
+	r.Put("/users/password", app.UserHandler.HandleUpdatePassword)
+	r.Put("/users/activated", app.UserHandler.HandleActivateUser)
+	r.Get("/.well-known/jwks.json", app.TokenHandler.HandleJWKS)
 
 	return r
 }
@@ -0,0 +1,237 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+var ErrInvalidBucket = errors.New("bucket must be one of day, week or month")
+
+// AnalyticsRange selects workouts performed between the calendar days From
+// and To, both inclusive, in Timezone. Buckets are calendar days, Monday
+// based weeks or months in that same time zone.
+type AnalyticsRange struct {
+	UserID   int
+	From     time.Time
+	To       time.Time
+	Bucket   string
+	Timezone string
+}
+
+type TotalsBucket struct {
+	Start        string  `json:"start"`
+	Workouts     int     `json:"workouts"`
+	TotalMinutes int     `json:"total_minutes"`
+	Calories     int     `json:"calories"`
+	Tonnage      float64 `json:"tonnage"`
+}
+
+type ProgressionPoint struct {
+	Start         string   `json:"start"`
+	MaxWeight     *float64 `json:"max_weight"`
+	Estimated1RM  *float64 `json:"estimated_1rm"`
+	TotalReps     int      `json:"total_reps"`
+	Tonnage       float64  `json:"tonnage"`
+	MaxDuration   *int     `json:"max_duration_seconds"`
+	TotalSets     int      `json:"total_sets"`
+	WorkoutsCount int      `json:"workouts"`
+}
+
+type MuscleGroupVolume struct {
+	Start       string  `json:"start"`
+	MuscleGroup string  `json:"muscle_group"`
+	Sets        int     `json:"sets"`
+	Tonnage     float64 `json:"tonnage"`
+}
+
+// performancesCTE expands every entry of the user's workouts in range into
+// one row per completed working set, or one row carrying the entry's
+// sets/reps/weight when it was logged without sets_detail. Expects $1 user
+// id, $2 and $3 the first and last day, $4 the bucket and $5 the time zone.
+const performancesCTE = `
+	WITH ranged AS (
+		SELECT w.id, w.performed_at, w.duration_minutes, w.calories_burned,
+		       date_trunc($4, w.performed_at AT TIME ZONE $5) AS bucket
+		FROM workouts w
+		WHERE w.user_id = $1
+		  AND w.performed_at >= ($2::date::timestamp AT TIME ZONE $5)
+		  AND w.performed_at < (($3::date + 1)::timestamp AT TIME ZONE $5)
+	),
+	performances AS (
+		SELECT r.id AS workout_id, r.bucket, e.exercise_id, 1 AS sets, s.reps, s.duration_seconds, s.weight
+		FROM ranged r
+		INNER JOIN workout_entries e ON e.workout_id = r.id
+		INNER JOIN workout_sets s ON s.entry_id = e.id
+		WHERE s.completed AND s.set_type <> 'warmup'
+		UNION ALL
+		SELECT r.id, r.bucket, e.exercise_id, e.sets, e.reps, e.duration_seconds, e.weight
+		FROM ranged r
+		INNER JOIN workout_entries e ON e.workout_id = r.id
+		WHERE NOT EXISTS (SELECT 1 FROM workout_sets s WHERE s.entry_id = e.id)
+	)
+`
+
+func validBucket(bucket string) bool {
+	switch bucket {
+	case "day", "week", "month":
+		return true
+	}
+	return false
+}
+
+type PostgresAnalyticsStore struct {
+	db *sql.DB
+}
+
+func NewPostgresAnalyticsStore(db *sql.DB) *PostgresAnalyticsStore {
+	return &PostgresAnalyticsStore{db: db}
+}
+
+type AnalyticsStore interface {
+	Totals(AnalyticsRange) ([]TotalsBucket, error)
+	ExerciseProgression(r AnalyticsRange, exerciseID int64) ([]ProgressionPoint, error)
+	MuscleGroupVolume(AnalyticsRange) ([]MuscleGroupVolume, error)
+}
+
+func (a AnalyticsRange) args() []interface{} {
+	return []interface{}{a.UserID, a.From.Format(dateLayout), a.To.Format(dateLayout), a.Bucket, a.Timezone}
+}
+
+func (s *PostgresAnalyticsStore) Totals(r AnalyticsRange) ([]TotalsBucket, error) {
+	if !validBucket(r.Bucket) {
+		return nil, ErrInvalidBucket
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	query := performancesCTE + `
+	, tonnage AS (
+		SELECT workout_id, SUM(sets * reps * weight) AS tonnage
+		FROM performances
+		WHERE reps IS NOT NULL AND weight IS NOT NULL
+		GROUP BY workout_id
+	)
+	SELECT to_char(r.bucket, 'YYYY-MM-DD'),
+	       COUNT(*),
+	       COALESCE(SUM(r.duration_minutes), 0),
+	       COALESCE(SUM(r.calories_burned), 0),
+	       COALESCE(SUM(t.tonnage), 0)
+	FROM ranged r
+	LEFT JOIN tonnage t ON t.workout_id = r.id
+	GROUP BY r.bucket
+	ORDER BY r.bucket
+	`
+	rows, err := s.db.QueryContext(ctx, query, r.args()...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	buckets := []TotalsBucket{}
+	for rows.Next() {
+		var bucket TotalsBucket
+		err = rows.Scan(&bucket.Start, &bucket.Workouts, &bucket.TotalMinutes, &bucket.Calories, &bucket.Tonnage)
+		if err != nil {
+			return nil, err
+		}
+		buckets = append(buckets, bucket)
+	}
+	return buckets, rows.Err()
+}
+
+func (s *PostgresAnalyticsStore) ExerciseProgression(r AnalyticsRange, exerciseID int64) ([]ProgressionPoint, error) {
+	if !validBucket(r.Bucket) {
+		return nil, ErrInvalidBucket
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// the 1RM estimate mirrors EstimateOneRepMax
+	query := performancesCTE + `
+	SELECT to_char(bucket, 'YYYY-MM-DD'),
+	       MAX(weight),
+	       MAX(CASE
+	             WHEN reps IS NULL OR weight IS NULL OR reps < 1 THEN NULL
+	             WHEN reps = 1 THEN weight
+	             WHEN reps <= 10 THEN weight * 36 / (37 - reps)
+	             ELSE weight * (1 + reps / 30.0)
+	           END),
+	       COALESCE(SUM(sets * reps), 0),
+	       COALESCE(SUM(sets * reps * weight), 0),
+	       MAX(duration_seconds),
+	       COALESCE(SUM(sets), 0),
+	       COUNT(DISTINCT workout_id)
+	FROM performances
+	WHERE exercise_id = $6
+	GROUP BY bucket
+	ORDER BY bucket
+	`
+	rows, err := s.db.QueryContext(ctx, query, append(r.args(), exerciseID)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	points := []ProgressionPoint{}
+	for rows.Next() {
+		var point ProgressionPoint
+		err = rows.Scan(
+			&point.Start,
+			&point.MaxWeight,
+			&point.Estimated1RM,
+			&point.TotalReps,
+			&point.Tonnage,
+			&point.MaxDuration,
+			&point.TotalSets,
+			&point.WorkoutsCount,
+		)
+		if err != nil {
+			return nil, err
+		}
+		points = append(points, point)
+	}
+	return points, rows.Err()
+}
+
+// MuscleGroupVolume credits every set in full to each muscle group its
+// exercise lists.
+func (s *PostgresAnalyticsStore) MuscleGroupVolume(r AnalyticsRange) ([]MuscleGroupVolume, error) {
+	if !validBucket(r.Bucket) {
+		return nil, ErrInvalidBucket
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	query := performancesCTE + `
+	SELECT to_char(p.bucket, 'YYYY-MM-DD'),
+	       m.muscle_group,
+	       COALESCE(SUM(p.sets), 0),
+	       COALESCE(SUM(p.sets * p.reps * p.weight), 0)
+	FROM performances p
+	INNER JOIN exercises x ON x.id = p.exercise_id
+	CROSS JOIN LATERAL unnest(x.muscle_groups) AS m(muscle_group)
+	GROUP BY p.bucket, m.muscle_group
+	ORDER BY p.bucket, m.muscle_group
+	`
+	rows, err := s.db.QueryContext(ctx, query, r.args()...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	volumes := []MuscleGroupVolume{}
+	for rows.Next() {
+		var volume MuscleGroupVolume
+		err = rows.Scan(&volume.Start, &volume.MuscleGroup, &volume.Sets, &volume.Tonnage)
+		if err != nil {
+			return nil, err
+		}
+		volumes = append(volumes, volume)
+	}
+	return volumes, rows.Err()
+}
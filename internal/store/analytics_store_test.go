@@ -0,0 +1,208 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// seedAnalyticsWorkouts logs four workouts around the first days of June
+// 2025 and returns the ids of the Bench Press and Squat exercises. In
+// America/New_York (UTC-4) the late workout of 2025-06-03 02:30 UTC belongs
+// to June 2 and the one of 2025-06-01 02:00 UTC to May 31.
+func seedAnalyticsWorkouts(t *testing.T, workoutStore *PostgresWorkoutStore, userID int) (bench, squat int64) {
+	t.Helper()
+
+	workouts := []*Workout{
+		{
+			Title:           "before the range in New York",
+			DurationMinutes: 10,
+			PerformedAt:     time.Date(2025, 6, 1, 2, 0, 0, 0, time.UTC),
+			Entries: []WorkoutEntry{
+				{ExerciseName: "Bench Press", Sets: 1, Reps: IntPtr(1), Weight: FloatPtr(50)},
+			},
+		},
+		{
+			Title:           "squats",
+			DurationMinutes: 45,
+			CaloriesBurned:  300,
+			PerformedAt:     time.Date(2025, 6, 2, 14, 0, 0, 0, time.UTC),
+			Entries: []WorkoutEntry{
+				{
+					ExerciseName: "Squat",
+					SetsDetail: []WorkoutSet{
+						{Reps: IntPtr(5), Weight: FloatPtr(60), SetType: SetTypeWarmup, Completed: true},
+						{Reps: IntPtr(5), Weight: FloatPtr(100), Completed: true},
+						{Reps: IntPtr(3), Weight: FloatPtr(120), Completed: true},
+						{Reps: IntPtr(1), Weight: FloatPtr(130), Completed: false},
+					},
+				},
+			},
+		},
+		{
+			Title:           "late bench",
+			DurationMinutes: 30,
+			CaloriesBurned:  200,
+			PerformedAt:     time.Date(2025, 6, 3, 2, 30, 0, 0, time.UTC),
+			Entries: []WorkoutEntry{
+				{ExerciseName: "Bench Press", Sets: 3, Reps: IntPtr(5), Weight: FloatPtr(100)},
+			},
+		},
+		{
+			Title:           "bench volume",
+			DurationMinutes: 20,
+			CaloriesBurned:  100,
+			PerformedAt:     time.Date(2025, 6, 3, 15, 0, 0, 0, time.UTC),
+			Entries: []WorkoutEntry{
+				{ExerciseName: "Bench Press", Sets: 2, Reps: IntPtr(10), Weight: FloatPtr(80)},
+			},
+		},
+	}
+
+	for _, workout := range workouts {
+		workout.UserID = userID
+		created, err := workoutStore.CreateWorkout(context.Background(), workout)
+		require.NoError(t, err)
+		for _, entry := range created.Entries {
+			switch entry.ExerciseName {
+			case "Bench Press":
+				bench = int64(entry.ExerciseID)
+			case "Squat":
+				squat = int64(entry.ExerciseID)
+			}
+		}
+	}
+	return bench, squat
+}
+
+func TestAnalyticsTotals(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	userID := createTestUser(t, db)
+	seedAnalyticsWorkouts(t, NewPostgresWorkoutStore(db), userID)
+	store := NewPostgresAnalyticsStore(db)
+
+	june := func(timezone string) AnalyticsRange {
+		return AnalyticsRange{
+			UserID:   userID,
+			From:     time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC),
+			To:       time.Date(2025, 6, 30, 0, 0, 0, 0, time.UTC),
+			Bucket:   "day",
+			Timezone: timezone,
+		}
+	}
+
+	tests := []struct {
+		name     string
+		timezone string
+		want     []TotalsBucket
+	}{
+		{
+			name:     "new york moves the late workout to the previous day",
+			timezone: "America/New_York",
+			want: []TotalsBucket{
+				// 3x5x100 + 5x100 + 3x120, the warmup and the missed set don't count
+				{Start: "2025-06-02", Workouts: 2, TotalMinutes: 75, Calories: 500, Tonnage: 2360},
+				{Start: "2025-06-03", Workouts: 1, TotalMinutes: 20, Calories: 100, Tonnage: 1600},
+			},
+		},
+		{
+			name:     "utc",
+			timezone: "UTC",
+			want: []TotalsBucket{
+				{Start: "2025-06-01", Workouts: 1, TotalMinutes: 10, Calories: 0, Tonnage: 50},
+				{Start: "2025-06-02", Workouts: 1, TotalMinutes: 45, Calories: 300, Tonnage: 860},
+				{Start: "2025-06-03", Workouts: 2, TotalMinutes: 50, Calories: 300, Tonnage: 3100},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buckets, err := store.Totals(june(tt.timezone))
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, buckets)
+		})
+	}
+
+	_, err := store.Totals(AnalyticsRange{UserID: userID, Bucket: "year", Timezone: "UTC"})
+	assert.ErrorIs(t, err, ErrInvalidBucket)
+}
+
+func TestAnalyticsExerciseProgression(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	userID := createTestUser(t, db)
+	bench, squat := seedAnalyticsWorkouts(t, NewPostgresWorkoutStore(db), userID)
+	store := NewPostgresAnalyticsStore(db)
+
+	r := AnalyticsRange{
+		UserID:   userID,
+		From:     time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC),
+		To:       time.Date(2025, 6, 30, 0, 0, 0, 0, time.UTC),
+		Bucket:   "week",
+		Timezone: "America/New_York",
+	}
+
+	points, err := store.ExerciseProgression(r, bench)
+	require.NoError(t, err)
+	require.Len(t, points, 1)
+	// 2025-06-02 is a Monday
+	assert.Equal(t, "2025-06-02", points[0].Start)
+	require.NotNil(t, points[0].MaxWeight)
+	assert.Equal(t, 100.0, *points[0].MaxWeight)
+	// 5 reps at 100 beats 10 reps at 80 (106.67)
+	require.NotNil(t, points[0].Estimated1RM)
+	assert.InDelta(t, 112.5, *points[0].Estimated1RM, 0.01)
+	assert.Equal(t, 35, points[0].TotalReps)
+	assert.Equal(t, 3100.0, points[0].Tonnage)
+	assert.Nil(t, points[0].MaxDuration)
+	assert.Equal(t, 5, points[0].TotalSets)
+	assert.Equal(t, 2, points[0].WorkoutsCount)
+
+	r.Bucket = "day"
+	points, err = store.ExerciseProgression(r, squat)
+	require.NoError(t, err)
+	require.Len(t, points, 1)
+	assert.Equal(t, "2025-06-02", points[0].Start)
+	require.NotNil(t, points[0].MaxWeight)
+	assert.Equal(t, 120.0, *points[0].MaxWeight)
+	require.NotNil(t, points[0].Estimated1RM)
+	assert.InDelta(t, EstimateOneRepMax(120, 3), *points[0].Estimated1RM, 0.01)
+	assert.Equal(t, 8, points[0].TotalReps)
+	assert.Equal(t, 860.0, points[0].Tonnage)
+	assert.Equal(t, 2, points[0].TotalSets)
+	assert.Equal(t, 1, points[0].WorkoutsCount)
+}
+
+func TestAnalyticsMuscleGroupVolume(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	userID := createTestUser(t, db)
+	seedAnalyticsWorkouts(t, NewPostgresWorkoutStore(db), userID)
+	store := NewPostgresAnalyticsStore(db)
+
+	volumes, err := store.MuscleGroupVolume(AnalyticsRange{
+		UserID:   userID,
+		From:     time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC),
+		To:       time.Date(2025, 6, 30, 0, 0, 0, 0, time.UTC),
+		Bucket:   "month",
+		Timezone: "America/New_York",
+	})
+	require.NoError(t, err)
+
+	// every set counts in full for each muscle group of its exercise
+	assert.Equal(t, []MuscleGroupVolume{
+		{Start: "2025-06-01", MuscleGroup: "chest", Sets: 5, Tonnage: 3100},
+		{Start: "2025-06-01", MuscleGroup: "glutes", Sets: 2, Tonnage: 860},
+		{Start: "2025-06-01", MuscleGroup: "quads", Sets: 2, Tonnage: 860},
+		{Start: "2025-06-01", MuscleGroup: "shoulders", Sets: 5, Tonnage: 3100},
+		{Start: "2025-06-01", MuscleGroup: "triceps", Sets: 5, Tonnage: 3100},
+	}, volumes)
+}
@@ -0,0 +1,204 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgtype"
+	"github.com/shiponcs/femProject/internal/tokens"
+)
+
+// Permissions an API key can be granted. Session tokens can do everything
+// their user can.
+const (
+	APIScopeWorkoutsRead  = "workouts:read"
+	APIScopeWorkoutsWrite = "workouts:write"
+	APIScopeAnalyticsRead = "analytics:read"
+)
+
+var APIScopes = []string{APIScopeWorkoutsRead, APIScopeWorkoutsWrite, APIScopeAnalyticsRead}
+
+var ErrUnknownAPIScope = errors.New("unknown api key scope")
+
+type APIKey struct {
+	ID         int64      `json:"id"`
+	UserID     int        `json:"-"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	// Key is the plaintext key, only known right after it was created.
+	Key string `json:"key,omitempty"`
+}
+
+func (k *APIKey) HasScope(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+type PostgresAPIKeyStore struct {
+	db *sql.DB
+}
+
+func NewPostgresAPIKeyStore(db *sql.DB) *PostgresAPIKeyStore {
+	return &PostgresAPIKeyStore{db: db}
+}
+
+type APIKeyStore interface {
+	CreateAPIKey(userID int, name string, scopes []string, expiresAt *time.Time) (*APIKey, error)
+	ListAPIKeys(userID int) ([]APIKey, error)
+	DeleteAPIKey(userID int, id int64) error
+	GetUserByAPIKey(plaintext string) (*User, *APIKey, error)
+}
+
+func validateAPIScopes(scopes []string) error {
+	for _, scope := range scopes {
+		known := false
+		for _, s := range APIScopes {
+			if s == scope {
+				known = true
+			}
+		}
+		if !known {
+			return ErrUnknownAPIScope
+		}
+	}
+	return nil
+}
+
+func (pg *PostgresAPIKeyStore) CreateAPIKey(userID int, name string, scopes []string, expiresAt *time.Time) (*APIKey, error) {
+	if err := validateAPIScopes(scopes); err != nil {
+		return nil, err
+	}
+
+	generated, err := tokens.GenerateAPIKey()
+	if err != nil {
+		return nil, err
+	}
+
+	key := &APIKey{
+		UserID:    userID,
+		Name:      name,
+		Prefix:    generated.Prefix,
+		Scopes:    nonNilStrings(scopes),
+		ExpiresAt: expiresAt,
+		Key:       generated.Plaintext,
+	}
+
+	query := `
+	INSERT INTO api_keys (user_id, name, prefix, hash, scopes, expires_at)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	RETURNING id, created_at
+	`
+	err = pg.db.QueryRow(query, userID, name, key.Prefix, generated.Hash, key.Scopes, expiresAt).Scan(&key.ID, &key.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func (pg *PostgresAPIKeyStore) ListAPIKeys(userID int) ([]APIKey, error) {
+	query := `
+	SELECT id, name, prefix, scopes, created_at, last_used_at, expires_at
+	FROM api_keys
+	WHERE user_id = $1
+	ORDER BY created_at DESC
+	`
+	rows, err := pg.db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []APIKey{}
+	for rows.Next() {
+		key := APIKey{UserID: userID}
+		var scopes pgtype.TextArray
+		err = rows.Scan(&key.ID, &key.Name, &key.Prefix, &scopes, &key.CreatedAt, &key.LastUsedAt, &key.ExpiresAt)
+		if err != nil {
+			return nil, err
+		}
+		key.Scopes = []string{}
+		if err := scopes.AssignTo(&key.Scopes); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+func (pg *PostgresAPIKeyStore) DeleteAPIKey(userID int, id int64) error {
+	result, err := pg.db.Exec(`DELETE FROM api_keys WHERE id = $1 AND user_id = $2`, id, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// GetUserByAPIKey returns nil for unknown and expired keys. Like
+// GetUserToken it touches last_used_at at most once a minute.
+func (pg *PostgresAPIKeyStore) GetUserByAPIKey(plaintext string) (*User, *APIKey, error) {
+	query := `
+	WITH touched AS (
+		UPDATE api_keys
+		SET last_used_at = CURRENT_TIMESTAMP
+		WHERE hash = $1
+		  AND (last_used_at IS NULL OR last_used_at < CURRENT_TIMESTAMP - INTERVAL '1 minute')
+	)
+	SELECT u.id, u.username, u.email, u.password_hash, u.bio, u.activated, u.role, u.created_at, u.updated_at,
+	       k.id, k.name, k.prefix, k.scopes, k.created_at, k.last_used_at, k.expires_at
+	FROM users u
+	INNER JOIN api_keys k ON k.user_id = u.id
+	WHERE k.hash = $1 AND (k.expires_at IS NULL OR k.expires_at > CURRENT_TIMESTAMP)
+	`
+	user := &User{}
+	key := &APIKey{}
+	var scopes pgtype.TextArray
+
+	err := pg.db.QueryRow(query, tokens.Hash(plaintext)).Scan(
+		&user.ID,
+		&user.Username,
+		&user.Email,
+		&user.PasswordHash.hash,
+		&user.Bio,
+		&user.Activated,
+		&user.Role,
+		&user.CreatedAt,
+		&user.UpdatedAt,
+		&key.ID,
+		&key.Name,
+		&key.Prefix,
+		&scopes,
+		&key.CreatedAt,
+		&key.LastUsedAt,
+		&key.ExpiresAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	key.UserID = user.ID
+	key.Scopes = []string{}
+	if err := scopes.AssignTo(&key.Scopes); err != nil {
+		return nil, nil, err
+	}
+	return user, key, nil
+}
@@ -0,0 +1,55 @@
+package store
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shiponcs/femProject/internal/tokens"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPIKeys(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	userID := createTestUser(t, db)
+	store := NewPostgresAPIKeyStore(db)
+
+	_, err := store.CreateAPIKey(userID, "bad", []string{"workouts:delete"}, nil)
+	assert.ErrorIs(t, err, ErrUnknownAPIScope)
+
+	key, err := store.CreateAPIKey(userID, "garmin sync", []string{APIScopeWorkoutsWrite}, nil)
+	require.NoError(t, err)
+	assert.True(t, tokens.IsAPIKey(key.Key))
+	assert.True(t, strings.HasPrefix(key.Key, key.Prefix))
+
+	user, found, err := store.GetUserByAPIKey(key.Key)
+	require.NoError(t, err)
+	require.NotNil(t, user)
+	assert.Equal(t, userID, user.ID)
+	assert.True(t, found.HasScope(APIScopeWorkoutsWrite))
+	assert.False(t, found.HasScope(APIScopeAnalyticsRead))
+
+	expired := time.Now().Add(-time.Hour)
+	old, err := store.CreateAPIKey(userID, "old", []string{APIScopeWorkoutsRead}, &expired)
+	require.NoError(t, err)
+	user, _, err = store.GetUserByAPIKey(old.Key)
+	require.NoError(t, err)
+	assert.Nil(t, user)
+
+	keys, err := store.ListAPIKeys(userID)
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, len(keys), 2)
+	for _, listed := range keys {
+		assert.Empty(t, listed.Key)
+	}
+
+	require.NoError(t, store.DeleteAPIKey(userID, key.ID))
+	assert.ErrorIs(t, store.DeleteAPIKey(userID, key.ID), sql.ErrNoRows)
+	user, _, err = store.GetUserByAPIKey(key.Key)
+	require.NoError(t, err)
+	assert.Nil(t, user)
+}
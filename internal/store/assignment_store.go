@@ -0,0 +1,156 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+var ErrAssignmentStarted = errors.New("assignment was already started")
+
+// Assignment is a template a coach assigned to an athlete. WorkoutID is set
+// once the athlete started it.
+type Assignment struct {
+	ID            int64      `json:"id"`
+	CoachID       int        `json:"coach_id"`
+	CoachUsername string     `json:"coach_username"`
+	AthleteID     int        `json:"athlete_id"`
+	TemplateID    int64      `json:"template_id"`
+	TemplateTitle string     `json:"template_title"`
+	Note          string     `json:"note"`
+	DueDate       *time.Time `json:"due_date"`
+	WorkoutID     *int64     `json:"workout_id"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+type PostgresAssignmentStore struct {
+	db *sql.DB
+}
+
+func NewPostgresAssignmentStore(db *sql.DB) *PostgresAssignmentStore {
+	return &PostgresAssignmentStore{db: db}
+}
+
+type AssignmentStore interface {
+	CreateAssignment(ctx context.Context, assignment *Assignment) error
+	GetAssignment(ctx context.Context, id int64) (*Assignment, error)
+	ListAssignmentsForAthlete(ctx context.Context, athleteID int) ([]Assignment, error)
+	ListAssignments(ctx context.Context, coachID, athleteID int) ([]Assignment, error)
+	StartAssignment(ctx context.Context, id int64, workoutID int64) error
+}
+
+func (pg *PostgresAssignmentStore) CreateAssignment(ctx context.Context, assignment *Assignment) error {
+	query := `
+	INSERT INTO coach_assignments (coach_id, athlete_id, template_id, note, due_date)
+	VALUES ($1, $2, $3, $4, $5)
+	RETURNING id, created_at
+	`
+
+	err := pg.db.QueryRowContext(ctx, query,
+		assignment.CoachID,
+		assignment.AthleteID,
+		assignment.TemplateID,
+		assignment.Note,
+		assignment.DueDate,
+	).Scan(&assignment.ID, &assignment.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	created, err := pg.GetAssignment(ctx, assignment.ID)
+	if err != nil {
+		return err
+	}
+	*assignment = *created
+	return nil
+}
+
+const assignmentColumns = `
+	SELECT ca.id, ca.coach_id, u.username, ca.athlete_id, ca.template_id, t.title,
+	       ca.note, ca.due_date, ca.workout_id, ca.created_at
+	FROM coach_assignments ca
+	INNER JOIN users u ON u.id = ca.coach_id
+	INNER JOIN workout_templates t ON t.id = ca.template_id
+	`
+
+func scanAssignment(row interface{ Scan(...interface{}) error }, assignment *Assignment) error {
+	return row.Scan(
+		&assignment.ID,
+		&assignment.CoachID,
+		&assignment.CoachUsername,
+		&assignment.AthleteID,
+		&assignment.TemplateID,
+		&assignment.TemplateTitle,
+		&assignment.Note,
+		&assignment.DueDate,
+		&assignment.WorkoutID,
+		&assignment.CreatedAt,
+	)
+}
+
+func (pg *PostgresAssignmentStore) GetAssignment(ctx context.Context, id int64) (*Assignment, error) {
+	assignment := &Assignment{}
+	err := scanAssignment(pg.db.QueryRowContext(ctx, assignmentColumns+`WHERE ca.id = $1`, id), assignment)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return assignment, nil
+}
+
+// ListAssignmentsForAthlete returns what is left to do first, soonest due
+// first.
+func (pg *PostgresAssignmentStore) ListAssignmentsForAthlete(ctx context.Context, athleteID int) ([]Assignment, error) {
+	return pg.listAssignments(ctx, `
+	WHERE ca.athlete_id = $1
+	ORDER BY ca.workout_id IS NOT NULL, ca.due_date NULLS LAST, ca.created_at
+	`, athleteID)
+}
+
+// ListAssignments returns what coachID assigned to athleteID, newest first.
+func (pg *PostgresAssignmentStore) ListAssignments(ctx context.Context, coachID, athleteID int) ([]Assignment, error) {
+	return pg.listAssignments(ctx, `
+	WHERE ca.coach_id = $1 AND ca.athlete_id = $2
+	ORDER BY ca.created_at DESC
+	`, coachID, athleteID)
+}
+
+func (pg *PostgresAssignmentStore) listAssignments(ctx context.Context, where string, args ...interface{}) ([]Assignment, error) {
+	rows, err := pg.db.QueryContext(ctx, assignmentColumns+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	assignments := []Assignment{}
+	for rows.Next() {
+		var assignment Assignment
+		err = scanAssignment(rows, &assignment)
+		if err != nil {
+			return nil, err
+		}
+		assignments = append(assignments, assignment)
+	}
+	return assignments, rows.Err()
+}
+
+// StartAssignment links the workout the athlete logged for the assignment.
+// It returns ErrAssignmentStarted if another workout got there first.
+func (pg *PostgresAssignmentStore) StartAssignment(ctx context.Context, id int64, workoutID int64) error {
+	result, err := pg.db.ExecContext(ctx, `UPDATE coach_assignments SET workout_id = $1 WHERE id = $2 AND workout_id IS NULL`, workoutID, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrAssignmentStarted
+	}
+	return nil
+}
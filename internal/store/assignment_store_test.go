@@ -0,0 +1,45 @@
+package store
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAssignments(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	athleteID := createTestUser(t, db)
+	coachID := createTestCoach(t, db, RoleCoach)
+
+	template := &WorkoutTemplate{UserID: coachID, Title: "Deload week A"}
+	require.NoError(t, NewPostgresTemplateStore(db).CreateTemplate(context.Background(), template))
+
+	store := NewPostgresAssignmentStore(db)
+	assignment := &Assignment{CoachID: coachID, AthleteID: athleteID, TemplateID: int64(template.ID), Note: "keep RPE at 7"}
+	require.NoError(t, store.CreateAssignment(context.Background(), assignment))
+	assert.Equal(t, "Deload week A", assignment.TemplateTitle)
+	assert.Equal(t, "store_test_coach", assignment.CoachUsername)
+
+	assignments, err := store.ListAssignmentsForAthlete(context.Background(), athleteID)
+	require.NoError(t, err)
+	require.NotEmpty(t, assignments)
+	assert.Nil(t, assignments[0].WorkoutID)
+
+	workout, err := NewPostgresWorkoutStore(db).CreateWorkout(context.Background(), template.NewWorkout(athleteID))
+	require.NoError(t, err)
+	require.NoError(t, store.StartAssignment(context.Background(), assignment.ID, int64(workout.ID)))
+	assert.ErrorIs(t, store.StartAssignment(context.Background(), assignment.ID, int64(workout.ID)), ErrAssignmentStarted)
+
+	started, err := store.GetAssignment(context.Background(), assignment.ID)
+	require.NoError(t, err)
+	require.NotNil(t, started.WorkoutID)
+	assert.Equal(t, int64(workout.ID), *started.WorkoutID)
+
+	assignments, err = store.ListAssignments(context.Background(), coachID, athleteID)
+	require.NoError(t, err)
+	assert.NotEmpty(t, assignments)
+}
@@ -0,0 +1,174 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+var ErrNotACoach = errors.New("user is not a coach")
+
+// CoachRelationship links a coach and an athlete. It is an invitation until
+// the athlete accepts it, from then on the coach can read and comment on
+// the athlete's workouts and assign them templates.
+type CoachRelationship struct {
+	CoachID         int        `json:"coach_id"`
+	CoachUsername   string     `json:"coach_username"`
+	AthleteID       int        `json:"athlete_id"`
+	AthleteUsername string     `json:"athlete_username"`
+	InvitedAt       time.Time  `json:"invited_at"`
+	AcceptedAt      *time.Time `json:"accepted_at"`
+}
+
+type PostgresCoachStore struct {
+	db *sql.DB
+}
+
+func NewPostgresCoachStore(db *sql.DB) *PostgresCoachStore {
+	return &PostgresCoachStore{db: db}
+}
+
+type CoachStore interface {
+	InviteAthlete(ctx context.Context, coachID, athleteID int) (*CoachRelationship, error)
+	AcceptInvitation(ctx context.Context, athleteID, coachID int) error
+	RevokeAccess(ctx context.Context, athleteID, coachID int) error
+	ListCoaches(ctx context.Context, athleteID int) ([]CoachRelationship, error)
+	ListAthletes(ctx context.Context, coachID int) ([]CoachRelationship, error)
+	IsCoachOf(ctx context.Context, coachID, athleteID int) (bool, error)
+}
+
+// InviteAthlete returns ErrNotACoach unless coachID has the coach role.
+// Inviting an athlete twice returns the existing relationship.
+func (pg *PostgresCoachStore) InviteAthlete(ctx context.Context, coachID, athleteID int) (*CoachRelationship, error) {
+	var isCoach bool
+	err := pg.db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM users WHERE id = $1 AND role = $2)`, coachID, RoleCoach).Scan(&isCoach)
+	if err != nil {
+		return nil, err
+	}
+	if !isCoach || coachID == athleteID {
+		return nil, ErrNotACoach
+	}
+
+	query := `
+	INSERT INTO coach_athletes (coach_id, athlete_id)
+	VALUES ($1, $2)
+	ON CONFLICT (coach_id, athlete_id) DO NOTHING
+	`
+	_, err = pg.db.ExecContext(ctx, query, coachID, athleteID)
+	if err != nil {
+		return nil, err
+	}
+
+	relationships, err := pg.listRelationships(ctx, `WHERE ca.coach_id = $1 AND ca.athlete_id = $2`, coachID, athleteID)
+	if err != nil {
+		return nil, err
+	}
+	if len(relationships) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return &relationships[0], nil
+}
+
+// AcceptInvitation returns sql.ErrNoRows when the coach didn't invite the
+// athlete. Accepting twice is a no-op.
+func (pg *PostgresCoachStore) AcceptInvitation(ctx context.Context, athleteID, coachID int) error {
+	query := `
+	UPDATE coach_athletes
+	SET accepted_at = COALESCE(accepted_at, CURRENT_TIMESTAMP)
+	WHERE coach_id = $1 AND athlete_id = $2
+	`
+
+	result, err := pg.db.ExecContext(ctx, query, coachID, athleteID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// RevokeAccess ends the relationship, or declines the invitation, from
+// either side.
+func (pg *PostgresCoachStore) RevokeAccess(ctx context.Context, athleteID, coachID int) error {
+	result, err := pg.db.ExecContext(ctx, `DELETE FROM coach_athletes WHERE coach_id = $1 AND athlete_id = $2`, coachID, athleteID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (pg *PostgresCoachStore) ListCoaches(ctx context.Context, athleteID int) ([]CoachRelationship, error) {
+	return pg.listRelationships(ctx, `WHERE ca.athlete_id = $1`, athleteID)
+}
+
+func (pg *PostgresCoachStore) ListAthletes(ctx context.Context, coachID int) ([]CoachRelationship, error) {
+	return pg.listRelationships(ctx, `WHERE ca.coach_id = $1`, coachID)
+}
+
+func (pg *PostgresCoachStore) listRelationships(ctx context.Context, where string, args ...interface{}) ([]CoachRelationship, error) {
+	query := `
+	SELECT ca.coach_id, c.username, ca.athlete_id, a.username, ca.created_at, ca.accepted_at
+	FROM coach_athletes ca
+	INNER JOIN users c ON c.id = ca.coach_id
+	INNER JOIN users a ON a.id = ca.athlete_id
+	` + where + `
+	ORDER BY ca.created_at
+	`
+
+	rows, err := pg.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	relationships := []CoachRelationship{}
+	for rows.Next() {
+		var relationship CoachRelationship
+		err = rows.Scan(
+			&relationship.CoachID,
+			&relationship.CoachUsername,
+			&relationship.AthleteID,
+			&relationship.AthleteUsername,
+			&relationship.InvitedAt,
+			&relationship.AcceptedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		relationships = append(relationships, relationship)
+	}
+	return relationships, rows.Err()
+}
+
+// IsCoachOf reports whether the athlete accepted the coach. Access lapses
+// when the coach loses the coach role.
+func (pg *PostgresCoachStore) IsCoachOf(ctx context.Context, coachID, athleteID int) (bool, error) {
+	query := `
+	SELECT EXISTS (
+		SELECT 1
+		FROM coach_athletes ca
+		INNER JOIN users u ON u.id = ca.coach_id
+		WHERE ca.coach_id = $1 AND ca.athlete_id = $2
+		  AND ca.accepted_at IS NOT NULL AND u.role = $3
+	)
+	`
+
+	var ok bool
+	err := pg.db.QueryRowContext(ctx, query, coachID, athleteID, RoleCoach).Scan(&ok)
+	return ok, err
+}
@@ -0,0 +1,67 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestCoachAccess(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	athleteID := createTestUser(t, db)
+	coachID := createTestCoach(t, db, RoleUser)
+
+	store := NewPostgresCoachStore(db)
+	_, err := db.Exec(`DELETE FROM coach_athletes WHERE athlete_id = $1`, athleteID)
+	require.NoError(t, err)
+
+	_, err = store.InviteAthlete(context.Background(), coachID, athleteID)
+	assert.ErrorIs(t, err, ErrNotACoach)
+
+	require.NoError(t, NewPostgresUserStore(db, bcrypt.MinCost).UpdateRole(context.Background(), coachID, RoleCoach))
+	invitation, err := store.InviteAthlete(context.Background(), coachID, athleteID)
+	require.NoError(t, err)
+	assert.Nil(t, invitation.AcceptedAt)
+	_, err = store.InviteAthlete(context.Background(), coachID, athleteID)
+	require.NoError(t, err)
+
+	// invitations don't grant access until the athlete accepts them
+	ok, err := store.IsCoachOf(context.Background(), coachID, athleteID)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	assert.ErrorIs(t, store.AcceptInvitation(context.Background(), coachID, athleteID), sql.ErrNoRows)
+	require.NoError(t, store.AcceptInvitation(context.Background(), athleteID, coachID))
+
+	ok, err = store.IsCoachOf(context.Background(), coachID, athleteID)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = store.IsCoachOf(context.Background(), athleteID, coachID)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	coaches, err := store.ListCoaches(context.Background(), athleteID)
+	require.NoError(t, err)
+	require.Len(t, coaches, 1)
+	assert.Equal(t, "store_test_coach", coaches[0].CoachUsername)
+	assert.NotNil(t, coaches[0].AcceptedAt)
+
+	athletes, err := store.ListAthletes(context.Background(), coachID)
+	require.NoError(t, err)
+	require.Len(t, athletes, 1)
+	assert.Equal(t, athleteID, athletes[0].AthleteID)
+
+	require.NoError(t, NewPostgresUserStore(db, bcrypt.MinCost).UpdateRole(context.Background(), coachID, RoleUser))
+	ok, err = store.IsCoachOf(context.Background(), coachID, athleteID)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	require.NoError(t, store.RevokeAccess(context.Background(), athleteID, coachID))
+	assert.ErrorIs(t, store.RevokeAccess(context.Background(), athleteID, coachID), sql.ErrNoRows)
+}
@@ -2,23 +2,40 @@ package store
 
 import (
 	"database/sql"
+	"database/sql/driver"
 	"fmt"
 	"io/fs"
+	"log/slog"
+	"time"
 
-	_ "github.com/jackc/pgx/v4/stdlib"
+	"github.com/jackc/pgx/v4/stdlib"
 	"github.com/pressly/goose/v3"
 )
 
-func Open() (*sql.DB, error) {
-	db, err := sql.Open("pgx", "host=localhost user=postgres password=postgres dbname=postgres port=5432 sslmode=disable")
+// Pool sizes the connection pool, zero values mean no limit as in sql.DB.
+type Pool struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+}
+
+// Open connects to Postgres. Statements run with the context of a traced
+// request are traced, see tracedConn.
+func Open(dsn string, pool Pool) (*sql.DB, error) {
+	connector, err := stdlib.GetDefaultDriver().(driver.DriverContext).OpenConnector(dsn)
 	if err != nil {
 		return nil, fmt.Errorf("db: open %w", err)
 	}
-	fmt.Println("connected to the database")
-
+	db := sql.OpenDB(tracedConnector{Connector: connector})
+	db.SetMaxOpenConns(pool.MaxOpenConns)
+	db.SetMaxIdleConns(pool.MaxIdleConns)
+	db.SetConnMaxLifetime(pool.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(pool.ConnMaxIdleTime)
 	if err := db.Ping(); err != nil {
 		return nil, fmt.Errorf("can't ping the database")
 	}
+	slog.Info("connected to the database")
 	return db, nil
 }
 
@@ -0,0 +1,220 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+const (
+	GroupTypeSuperset = "superset"
+	GroupTypeCircuit  = "circuit"
+	GroupTypeEMOM     = "emom"
+	GroupTypeAMRAP    = "amrap"
+)
+
+var ErrInvalidEntryGroups = errors.New("invalid entry groups")
+
+// EntryGroup ties consecutive entries of a workout together. Entries of the
+// same group share its Label; on input a Label, or the ID of an existing
+// group of the workout, is enough to join it.
+type EntryGroup struct {
+	ID                       int    `json:"id"`
+	Label                    string `json:"label"`
+	Type                     string `json:"type"`
+	Rounds                   int    `json:"rounds"`
+	RestBetweenRoundsSeconds int    `json:"rest_between_rounds_seconds"`
+}
+
+type entryGroupError struct {
+	reason string
+}
+
+func (e *entryGroupError) Error() string {
+	return e.reason
+}
+
+func (e *entryGroupError) Is(target error) bool {
+	return target == ErrInvalidEntryGroups
+}
+
+func invalidGroups(format string, args ...interface{}) error {
+	return &entryGroupError{reason: fmt.Sprintf(format, args...)}
+}
+
+func groupKey(group *EntryGroup) string {
+	switch {
+	case group == nil:
+		return ""
+	case group.Label != "":
+		return group.Label
+	case group.ID != 0:
+		return fmt.Sprintf("#%d", group.ID)
+	}
+	return ""
+}
+
+// ValidateEntryGroups checks that grouped entries sit next to each other in
+// order_index, that every entry of a group describes the group the same
+// way and that supersets pair at least two exercises. Errors match
+// ErrInvalidEntryGroups.
+func ValidateEntryGroups(entries []WorkoutEntry) error {
+	sorted := make([]WorkoutEntry, len(entries))
+	copy(sorted, entries)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].OrderIndex < sorted[j].OrderIndex })
+
+	groups := make(map[string]*EntryGroup)
+	sizes := make(map[string]int)
+	closed := make(map[string]bool)
+	current := ""
+
+	for _, entry := range sorted {
+		key := groupKey(entry.Group)
+		if key != current {
+			if current != "" {
+				closed[current] = true
+			}
+			if closed[key] {
+				return invalidGroups("entries of group %q must be contiguous in order_index", key)
+			}
+			current = key
+		}
+		if key == "" {
+			continue
+		}
+		sizes[key]++
+
+		group := entry.Group
+		if group.Label == "" {
+			// joins an existing group by ID, its settings are already stored
+			continue
+		}
+		if len(group.Label) > 50 {
+			return invalidGroups("group label %q can't be greater than 50 characters", group.Label)
+		}
+		switch group.Type {
+		case GroupTypeSuperset, GroupTypeCircuit, GroupTypeEMOM, GroupTypeAMRAP:
+		default:
+			return invalidGroups("group %q: type must be one of superset, circuit, emom or amrap", key)
+		}
+		if group.Rounds < 1 {
+			return invalidGroups("group %q: rounds must be at least 1", key)
+		}
+		if group.RestBetweenRoundsSeconds < 0 {
+			return invalidGroups("group %q: rest_between_rounds_seconds can't be negative", key)
+		}
+
+		if first, ok := groups[key]; ok {
+			if first.Type != group.Type || first.Rounds != group.Rounds || first.RestBetweenRoundsSeconds != group.RestBetweenRoundsSeconds {
+				return invalidGroups("entries of group %q disagree on its settings", key)
+			}
+		} else {
+			groups[key] = group
+		}
+	}
+
+	for key, group := range groups {
+		if group.Type == GroupTypeSuperset && sizes[key] < 2 {
+			return invalidGroups("superset %q needs at least two entries", key)
+		}
+	}
+	return nil
+}
+
+// assignEntryGroup creates or updates the group an entry is part of and
+// stores its ID on entry.Group.
+func assignEntryGroup(ctx context.Context, tx *sql.Tx, workoutID int64, entry *WorkoutEntry) error {
+	group := entry.Group
+	if group == nil || (group.Label == "" && group.ID == 0) {
+		entry.Group = nil
+		return nil
+	}
+
+	if group.Label == "" {
+		query := `
+		SELECT label, group_type, rounds, rest_between_rounds_seconds
+		FROM workout_entry_groups
+		WHERE id = $1 AND workout_id = $2
+		`
+		err := tx.QueryRowContext(ctx, query, group.ID, workoutID).Scan(&group.Label, &group.Type, &group.Rounds, &group.RestBetweenRoundsSeconds)
+		if err == sql.ErrNoRows {
+			return invalidGroups("group %d doesn't belong to this workout", group.ID)
+		}
+		return err
+	}
+
+	query := `
+	INSERT INTO workout_entry_groups (workout_id, label, group_type, rounds, rest_between_rounds_seconds)
+	VALUES ($1, $2, $3, $4, $5)
+	ON CONFLICT (workout_id, label) DO UPDATE
+	SET group_type = EXCLUDED.group_type, rounds = EXCLUDED.rounds, rest_between_rounds_seconds = EXCLUDED.rest_between_rounds_seconds
+	RETURNING id
+	`
+	return tx.QueryRowContext(ctx, query, workoutID, group.Label, group.Type, group.Rounds, group.RestBetweenRoundsSeconds).Scan(&group.ID)
+}
+
+// finalizeEntryGroups drops groups no entry points to anymore and checks
+// the stored entries of the workout with ValidateEntryGroups, which catches
+// entry level edits that split a group.
+func finalizeEntryGroups(ctx context.Context, tx *sql.Tx, workoutID int64) error {
+	_, err := tx.ExecContext(ctx, `
+	DELETE FROM workout_entry_groups g
+	WHERE g.workout_id = $1 AND NOT EXISTS (SELECT 1 FROM workout_entries e WHERE e.group_id = g.id)
+	`, workoutID)
+	if err != nil {
+		return err
+	}
+
+	query := `
+	SELECT e.order_index, g.id, g.label, g.group_type, g.rounds, g.rest_between_rounds_seconds
+	FROM workout_entries e
+	LEFT JOIN workout_entry_groups g ON g.id = e.group_id
+	WHERE e.workout_id = $1
+	`
+	rows, err := tx.QueryContext(ctx, query, workoutID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var entries []WorkoutEntry
+	for rows.Next() {
+		var entry WorkoutEntry
+		var group nullableEntryGroup
+		err = rows.Scan(&entry.OrderIndex, &group.ID, &group.Label, &group.Type, &group.Rounds, &group.RestBetweenRoundsSeconds)
+		if err != nil {
+			return err
+		}
+		entry.Group = group.get()
+		entries = append(entries, entry)
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	return ValidateEntryGroups(entries)
+}
+
+// nullableEntryGroup scans the columns of a LEFT JOINed group.
+type nullableEntryGroup struct {
+	ID                       sql.NullInt64
+	Label                    sql.NullString
+	Type                     sql.NullString
+	Rounds                   sql.NullInt64
+	RestBetweenRoundsSeconds sql.NullInt64
+}
+
+func (g *nullableEntryGroup) get() *EntryGroup {
+	if !g.ID.Valid {
+		return nil
+	}
+	return &EntryGroup{
+		ID:                       int(g.ID.Int64),
+		Label:                    g.Label.String,
+		Type:                     g.Type.String,
+		Rounds:                   int(g.Rounds.Int64),
+		RestBetweenRoundsSeconds: int(g.RestBetweenRoundsSeconds.Int64),
+	}
+}
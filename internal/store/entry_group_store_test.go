@@ -0,0 +1,84 @@
+package store
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateEntryGroups(t *testing.T) {
+	superset := func() *EntryGroup {
+		return &EntryGroup{Label: "A", Type: GroupTypeSuperset, Rounds: 3, RestBetweenRoundsSeconds: 90}
+	}
+
+	tests := []struct {
+		name    string
+		entries []WorkoutEntry
+		wantErr bool
+	}{
+		{
+			name: "contiguous superset",
+			entries: []WorkoutEntry{
+				{OrderIndex: 1},
+				{OrderIndex: 2, Group: superset()},
+				{OrderIndex: 3, Group: superset()},
+			},
+		},
+		{
+			name: "order_index decides contiguity, not slice order",
+			entries: []WorkoutEntry{
+				{OrderIndex: 3, Group: superset()},
+				{OrderIndex: 1},
+				{OrderIndex: 2, Group: superset()},
+			},
+		},
+		{
+			name: "split group",
+			entries: []WorkoutEntry{
+				{OrderIndex: 1, Group: superset()},
+				{OrderIndex: 2},
+				{OrderIndex: 3, Group: superset()},
+			},
+			wantErr: true,
+		},
+		{
+			name: "superset with one entry",
+			entries: []WorkoutEntry{
+				{OrderIndex: 1, Group: superset()},
+			},
+			wantErr: true,
+		},
+		{
+			name: "single entry amrap",
+			entries: []WorkoutEntry{
+				{OrderIndex: 1, Group: &EntryGroup{Label: "finisher", Type: GroupTypeAMRAP, Rounds: 1}},
+			},
+		},
+		{
+			name: "entries disagree on rounds",
+			entries: []WorkoutEntry{
+				{OrderIndex: 1, Group: superset()},
+				{OrderIndex: 2, Group: &EntryGroup{Label: "A", Type: GroupTypeSuperset, Rounds: 4, RestBetweenRoundsSeconds: 90}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "unknown type",
+			entries: []WorkoutEntry{
+				{OrderIndex: 1, Group: &EntryGroup{Label: "B", Type: "tabata", Rounds: 8}},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateEntryGroups(tt.entries)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidEntryGroups)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
@@ -0,0 +1,272 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgtype"
+)
+
+const (
+	MeasurementReps     = "reps"
+	MeasurementDuration = "duration"
+	MeasurementDistance = "distance"
+)
+
+var (
+	ErrDuplicateExercise = errors.New("an exercise with this name already exists")
+	ErrExerciseInUse     = errors.New("exercise is referenced by logged workouts")
+	ErrUnknownExercise   = errors.New("unknown exercise")
+)
+
+type Exercise struct {
+	ID              int       `json:"id"`
+	Name            string    `json:"name"`
+	Aliases         []string  `json:"aliases"`
+	MuscleGroups    []string  `json:"muscle_groups"`
+	Equipment       string    `json:"equipment"`
+	MeasurementType string    `json:"measurement_type"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+type PostgresExerciseStore struct {
+	db *sql.DB
+}
+
+func NewPostgresExerciseStore(db *sql.DB) *PostgresExerciseStore {
+	return &PostgresExerciseStore{db: db}
+}
+
+type ExerciseStore interface {
+	CreateExercise(*Exercise) error
+	GetExerciseByID(id int64) (*Exercise, error)
+	ListExercises(search, muscleGroup string) ([]*Exercise, error)
+	UpdateExercise(*Exercise) error
+	DeleteExercise(id int64) error
+	SeedExercises(seedFS fs.FS, name string) error
+}
+
+// translateExerciseError maps constraint violations to the store's errors.
+func translateExerciseError(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch pgErr.Code {
+		case "23505":
+			return ErrDuplicateExercise
+		case "23503":
+			return ErrExerciseInUse
+		}
+	}
+	return err
+}
+
+func scanExercise(scanner interface{ Scan(...interface{}) error }) (*Exercise, error) {
+	exercise := &Exercise{}
+	var aliases, muscleGroups pgtype.TextArray
+
+	err := scanner.Scan(
+		&exercise.ID,
+		&exercise.Name,
+		&aliases,
+		&muscleGroups,
+		&exercise.Equipment,
+		&exercise.MeasurementType,
+		&exercise.CreatedAt,
+		&exercise.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	exercise.Aliases = []string{}
+	if err := aliases.AssignTo(&exercise.Aliases); err != nil {
+		return nil, err
+	}
+	exercise.MuscleGroups = []string{}
+	if err := muscleGroups.AssignTo(&exercise.MuscleGroups); err != nil {
+		return nil, err
+	}
+	return exercise, nil
+}
+
+func (s *PostgresExerciseStore) CreateExercise(exercise *Exercise) error {
+	query := `
+	INSERT INTO exercises (name, aliases, muscle_groups, equipment, measurement_type)
+	VALUES ($1, $2, $3, $4, $5)
+	RETURNING id, created_at, updated_at
+	`
+	err := s.db.QueryRow(query,
+		exercise.Name,
+		nonNilStrings(exercise.Aliases),
+		nonNilStrings(exercise.MuscleGroups),
+		exercise.Equipment,
+		exercise.MeasurementType,
+	).Scan(&exercise.ID, &exercise.CreatedAt, &exercise.UpdatedAt)
+	return translateExerciseError(err)
+}
+
+func (s *PostgresExerciseStore) GetExerciseByID(id int64) (*Exercise, error) {
+	query := `
+	SELECT id, name, aliases, muscle_groups, equipment, measurement_type, created_at, updated_at
+	FROM exercises
+	WHERE id = $1
+	`
+	exercise, err := scanExercise(s.db.QueryRow(query, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return exercise, nil
+}
+
+// ListExercises matches search against names and aliases, case
+// insensitively. Empty arguments don't filter.
+func (s *PostgresExerciseStore) ListExercises(search, muscleGroup string) ([]*Exercise, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+	SELECT id, name, aliases, muscle_groups, equipment, measurement_type, created_at, updated_at
+	FROM exercises
+	WHERE ($1 = '' OR name ILIKE '%' || $1 || '%' OR EXISTS (SELECT 1 FROM unnest(aliases) a WHERE a ILIKE '%' || $1 || '%'))
+	  AND ($2 = '' OR lower($2) = ANY(muscle_groups))
+	ORDER BY name
+	`
+	rows, err := s.db.QueryContext(ctx, query, search, muscleGroup)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	exercises := []*Exercise{}
+	for rows.Next() {
+		exercise, err := scanExercise(rows)
+		if err != nil {
+			return nil, err
+		}
+		exercises = append(exercises, exercise)
+	}
+	return exercises, rows.Err()
+}
+
+func (s *PostgresExerciseStore) UpdateExercise(exercise *Exercise) error {
+	query := `
+	UPDATE exercises
+	SET name = $1, aliases = $2, muscle_groups = $3, equipment = $4, measurement_type = $5, updated_at = CURRENT_TIMESTAMP
+	WHERE id = $6
+	RETURNING updated_at
+	`
+	err := s.db.QueryRow(query,
+		exercise.Name,
+		nonNilStrings(exercise.Aliases),
+		nonNilStrings(exercise.MuscleGroups),
+		exercise.Equipment,
+		exercise.MeasurementType,
+		exercise.ID,
+	).Scan(&exercise.UpdatedAt)
+	return translateExerciseError(err)
+}
+
+func (s *PostgresExerciseStore) DeleteExercise(id int64) error {
+	result, err := s.db.Exec(`DELETE FROM exercises WHERE id = $1`, id)
+	if err != nil {
+		return translateExerciseError(err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// SeedExercises loads the JSON catalog called name from seedFS. Exercises
+// that already exist, by case-insensitive name, are left untouched so it is
+// safe to run on every start.
+func (s *PostgresExerciseStore) SeedExercises(seedFS fs.FS, name string) error {
+	data, err := fs.ReadFile(seedFS, name)
+	if err != nil {
+		return fmt.Errorf("seed exercises: %w", err)
+	}
+
+	var exercises []Exercise
+	if err := json.Unmarshal(data, &exercises); err != nil {
+		return fmt.Errorf("seed exercises: %w", err)
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+	INSERT INTO exercises (name, aliases, muscle_groups, equipment, measurement_type)
+	VALUES ($1, $2, $3, $4, $5)
+	ON CONFLICT (lower(name)) DO NOTHING
+	`
+	for _, exercise := range exercises {
+		_, err = tx.Exec(query,
+			exercise.Name,
+			nonNilStrings(exercise.Aliases),
+			nonNilStrings(exercise.MuscleGroups),
+			exercise.Equipment,
+			exercise.MeasurementType,
+		)
+		if err != nil {
+			return fmt.Errorf("seed exercise %q: %w", exercise.Name, err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// resolveExercise fills in the exercise ID and the canonical name of an
+// entry. An explicit ID wins, otherwise the name is matched against catalog
+// names and aliases. Names that match neither are ErrUnknownExercise, the
+// catalog is only extended through the exercises API.
+func resolveExercise(ctx context.Context, tx *sql.Tx, id *int, name *string) error {
+	if *id != 0 {
+		err := tx.QueryRowContext(ctx, `SELECT name FROM exercises WHERE id = $1`, *id).Scan(name)
+		if err == sql.ErrNoRows {
+			return ErrUnknownExercise
+		}
+		return err
+	}
+
+	if *name == "" {
+		return ErrUnknownExercise
+	}
+
+	lookup := `
+	SELECT id, name
+	FROM exercises
+	WHERE lower(name) = lower($1)
+	   OR EXISTS (SELECT 1 FROM unnest(aliases) a WHERE lower(a) = lower($1))
+	ORDER BY lower(name) = lower($1) DESC, id
+	LIMIT 1
+	`
+	err := tx.QueryRowContext(ctx, lookup, *name).Scan(id, name)
+	if err == sql.ErrNoRows {
+		return ErrUnknownExercise
+	}
+	return err
+}
+
+func nonNilStrings(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
@@ -0,0 +1,58 @@
+package store
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolveExercise(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	ctx := context.Background()
+	var benchPressID int
+	err := db.QueryRow(`SELECT id FROM exercises WHERE name = 'Bench Press'`).Scan(&benchPressID)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		id       int
+		input    string
+		wantName string
+		wantErr  error
+	}{
+		{name: "canonical name", input: "Bench Press", wantName: "Bench Press"},
+		{name: "name in another case", input: "bench PRESS", wantName: "Bench Press"},
+		{name: "alias", input: "bp", wantName: "Bench Press"},
+		{name: "explicit id wins", id: benchPressID, input: "Squat", wantName: "Bench Press"},
+		{name: "unknown name", input: "bench pres", wantErr: ErrUnknownExercise},
+		{name: "no name", wantErr: ErrUnknownExercise},
+		{name: "unknown id", id: -1, input: "Bench Press", wantErr: ErrUnknownExercise},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tx, err := db.BeginTx(ctx, nil)
+			require.NoError(t, err)
+			defer tx.Rollback()
+
+			id, name := tt.id, tt.input
+			err = resolveExercise(ctx, tx, &id, &name)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, benchPressID, id)
+			assert.Equal(t, tt.wantName, name)
+		})
+	}
+
+	var count int
+	err = db.QueryRow(`SELECT count(*) FROM exercises WHERE lower(name) = 'bench pres'`).Scan(&count)
+	require.NoError(t, err)
+	assert.Zero(t, count, "unknown names must not be added to the catalog")
+}
@@ -0,0 +1,193 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"time"
+)
+
+// LoginFailures counts the failed logins of a key, like a username or a
+// client IP, since the counter was last reset.
+type LoginFailures struct {
+	Count         int
+	LastFailureAt time.Time
+}
+
+type LoginAttemptStore interface {
+	GetLoginFailures(ctx context.Context, key string) (LoginFailures, error)
+	// ReserveLoginAttempt counts an attempt at at as a failure, unless wait
+	// returns how long the client has to wait given the failures so far.
+	// Reading the failures and counting the attempt is atomic, so concurrent
+	// attempts see each other. Failures older than window are forgotten, the
+	// count starts over.
+	ReserveLoginAttempt(ctx context.Context, key string, at time.Time, window time.Duration, wait func(LoginFailures) time.Duration) (time.Duration, error)
+	// ReleaseLoginAttempt takes back one reserved attempt that didn't fail.
+	ReleaseLoginAttempt(ctx context.Context, key string) error
+	ResetLoginFailures(ctx context.Context, key string) error
+}
+
+// loginFailuresPruneInterval is how often a store drops the counters that
+// are out of the window, keys nobody tries again would pile up otherwise.
+const loginFailuresPruneInterval = time.Minute
+
+// pruneSchedule tells a store when to prune, at most once every
+// loginFailuresPruneInterval.
+type pruneSchedule struct {
+	mu   sync.Mutex
+	last time.Time
+}
+
+func (p *pruneSchedule) due(at time.Time) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if at.Sub(p.last) < loginFailuresPruneInterval {
+		return false
+	}
+	p.last = at
+	return true
+}
+
+type PostgresLoginAttemptStore struct {
+	db    *sql.DB
+	prune pruneSchedule
+}
+
+func NewPostgresLoginAttemptStore(db *sql.DB) *PostgresLoginAttemptStore {
+	return &PostgresLoginAttemptStore{db: db}
+}
+
+func (pg *PostgresLoginAttemptStore) GetLoginFailures(ctx context.Context, key string) (LoginFailures, error) {
+	var failures LoginFailures
+	err := pg.db.QueryRowContext(ctx, `SELECT count, last_failure_at FROM login_failures WHERE key = $1`, key).Scan(&failures.Count, &failures.LastFailureAt)
+	if err == sql.ErrNoRows {
+		return LoginFailures{}, nil
+	}
+	return failures, err
+}
+
+func (pg *PostgresLoginAttemptStore) ReserveLoginAttempt(ctx context.Context, key string, at time.Time, window time.Duration, wait func(LoginFailures) time.Duration) (time.Duration, error) {
+	if pg.prune.due(at) {
+		_, err := pg.db.ExecContext(ctx, `DELETE FROM login_failures WHERE last_failure_at < $1`, at.Add(-window))
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	tx, err := pg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// the row is locked until the transaction ends, concurrent attempts for
+	// key wait for this one to be counted
+	_, err = tx.ExecContext(ctx, `
+	INSERT INTO login_failures (key, count, last_failure_at)
+	VALUES ($1, 0, $2)
+	ON CONFLICT (key) DO NOTHING
+	`, key, at)
+	if err != nil {
+		return 0, err
+	}
+
+	var failures LoginFailures
+	err = tx.QueryRowContext(ctx, `SELECT count, last_failure_at FROM login_failures WHERE key = $1 FOR UPDATE`, key).Scan(&failures.Count, &failures.LastFailureAt)
+	if err != nil {
+		return 0, err
+	}
+	if failures.LastFailureAt.Before(at.Add(-window)) {
+		failures = LoginFailures{}
+	}
+
+	if d := wait(failures); d > 0 {
+		return d, nil
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE login_failures SET count = $2, last_failure_at = $3 WHERE key = $1`, key, failures.Count+1, at)
+	if err != nil {
+		return 0, err
+	}
+	return 0, tx.Commit()
+}
+
+func (pg *PostgresLoginAttemptStore) ReleaseLoginAttempt(ctx context.Context, key string) error {
+	_, err := pg.db.ExecContext(ctx, `UPDATE login_failures SET count = count - 1 WHERE key = $1 AND count > 0`, key)
+	return err
+}
+
+func (pg *PostgresLoginAttemptStore) ResetLoginFailures(ctx context.Context, key string) error {
+	_, err := pg.db.ExecContext(ctx, `DELETE FROM login_failures WHERE key = $1`, key)
+	return err
+}
+
+// MemoryLoginAttemptStore keeps the counters in the process, for a single
+// instance deployment. They are lost on restart.
+type MemoryLoginAttemptStore struct {
+	mu       sync.Mutex
+	failures map[string]LoginFailures
+	prune    pruneSchedule
+}
+
+func NewMemoryLoginAttemptStore() *MemoryLoginAttemptStore {
+	return &MemoryLoginAttemptStore{failures: make(map[string]LoginFailures)}
+}
+
+func (m *MemoryLoginAttemptStore) GetLoginFailures(ctx context.Context, key string) (LoginFailures, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.failures[key], nil
+}
+
+func (m *MemoryLoginAttemptStore) ReserveLoginAttempt(ctx context.Context, key string, at time.Time, window time.Duration, wait func(LoginFailures) time.Duration) (time.Duration, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.prune.due(at) {
+		for k, failures := range m.failures {
+			if failures.LastFailureAt.Before(at.Add(-window)) {
+				delete(m.failures, k)
+			}
+		}
+	}
+
+	failures := m.failures[key]
+	if failures.LastFailureAt.Before(at.Add(-window)) {
+		failures = LoginFailures{}
+	}
+	if d := wait(failures); d > 0 {
+		return d, nil
+	}
+
+	failures.Count++
+	failures.LastFailureAt = at
+	m.failures[key] = failures
+	return 0, nil
+}
+
+func (m *MemoryLoginAttemptStore) ReleaseLoginAttempt(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	failures, ok := m.failures[key]
+	if !ok {
+		return nil
+	}
+	failures.Count--
+	if failures.Count <= 0 {
+		delete(m.failures, key)
+		return nil
+	}
+	m.failures[key] = failures
+	return nil
+}
+
+func (m *MemoryLoginAttemptStore) ResetLoginFailures(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.failures, key)
+	return nil
+}
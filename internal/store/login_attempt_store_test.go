@@ -0,0 +1,118 @@
+package store
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testLoginAttemptStore(t *testing.T, store LoginAttemptStore) {
+	t.Helper()
+
+	now := time.Now().Truncate(time.Second)
+	require.NoError(t, store.ResetLoginFailures(context.Background(), "user:store_test"))
+
+	failures, err := store.GetLoginFailures(context.Background(), "user:store_test")
+	require.NoError(t, err)
+	assert.Zero(t, failures.Count)
+
+	// allows the first three attempts
+	limit := func(failures LoginFailures) time.Duration {
+		if failures.Count >= 3 {
+			return time.Minute
+		}
+		return 0
+	}
+
+	for i := 0; i < 3; i++ {
+		wait, err := store.ReserveLoginAttempt(context.Background(), "user:store_test", now, time.Hour, limit)
+		require.NoError(t, err)
+		assert.Zero(t, wait)
+	}
+	wait, err := store.ReserveLoginAttempt(context.Background(), "user:store_test", now, time.Hour, limit)
+	require.NoError(t, err)
+	assert.Equal(t, time.Minute, wait)
+
+	failures, err = store.GetLoginFailures(context.Background(), "user:store_test")
+	require.NoError(t, err)
+	assert.Equal(t, 3, failures.Count)
+	assert.True(t, now.Equal(failures.LastFailureAt))
+
+	require.NoError(t, store.ReleaseLoginAttempt(context.Background(), "user:store_test"))
+	failures, err = store.GetLoginFailures(context.Background(), "user:store_test")
+	require.NoError(t, err)
+	assert.Equal(t, 2, failures.Count)
+
+	_, err = store.ReserveLoginAttempt(context.Background(), "user:stale_test", now, time.Hour, limit)
+	require.NoError(t, err)
+
+	// the count starts over once the last failure is out of the window
+	var seen LoginFailures
+	_, err = store.ReserveLoginAttempt(context.Background(), "user:store_test", now.Add(2*time.Hour), time.Hour, func(failures LoginFailures) time.Duration {
+		seen = failures
+		return 0
+	})
+	require.NoError(t, err)
+	assert.Zero(t, seen.Count)
+
+	// and keys nobody tries again are pruned
+	failures, err = store.GetLoginFailures(context.Background(), "user:stale_test")
+	require.NoError(t, err)
+	assert.Zero(t, failures.Count)
+
+	require.NoError(t, store.ResetLoginFailures(context.Background(), "user:store_test"))
+	failures, err = store.GetLoginFailures(context.Background(), "user:store_test")
+	require.NoError(t, err)
+	assert.Zero(t, failures.Count)
+
+	// concurrent attempts see each other
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := store.ReserveLoginAttempt(context.Background(), "user:store_test", now, time.Hour, limit)
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	failures, err = store.GetLoginFailures(context.Background(), "user:store_test")
+	require.NoError(t, err)
+	assert.Equal(t, 3, failures.Count)
+	require.NoError(t, store.ResetLoginFailures(context.Background(), "user:store_test"))
+}
+
+func TestMemoryLoginAttemptStore(t *testing.T) {
+	testLoginAttemptStore(t, NewMemoryLoginAttemptStore())
+}
+
+func TestMemoryLoginAttemptStorePruneSchedule(t *testing.T) {
+	store := NewMemoryLoginAttemptStore()
+	start := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	allow := func(LoginFailures) time.Duration { return 0 }
+
+	_, err := store.ReserveLoginAttempt(context.Background(), "a", start, 10*time.Second, allow)
+	require.NoError(t, err)
+
+	// "a" is stale but only the reserved key is looked at between prunes
+	_, err = store.ReserveLoginAttempt(context.Background(), "b", start.Add(30*time.Second), 10*time.Second, allow)
+	require.NoError(t, err)
+	assert.Len(t, store.failures, 2)
+
+	_, err = store.ReserveLoginAttempt(context.Background(), "c", start.Add(61*time.Second), 10*time.Second, allow)
+	require.NoError(t, err)
+	assert.Len(t, store.failures, 1)
+	assert.Contains(t, store.failures, "c")
+}
+
+func TestPostgresLoginAttemptStore(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	testLoginAttemptStore(t, NewPostgresLoginAttemptStore(db))
+}
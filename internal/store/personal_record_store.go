@@ -0,0 +1,336 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"math"
+	"sort"
+	"time"
+)
+
+const (
+	RecordMaxWeight       = "max_weight"
+	RecordMaxRepsAtWeight = "max_reps_at_weight"
+	RecordEstimated1RM    = "estimated_1rm"
+	RecordMaxDuration     = "max_duration"
+)
+
+type PersonalRecord struct {
+	ID           int       `json:"id"`
+	ExerciseID   int       `json:"exercise_id"`
+	ExerciseName string    `json:"exercise_name"`
+	RecordType   string    `json:"record_type"`
+	Weight       float64   `json:"weight,omitempty"`
+	Value        float64   `json:"value"`
+	WorkoutID    int       `json:"workout_id"`
+	EntryID      int       `json:"entry_id"`
+	AchievedAt   time.Time `json:"achieved_at"`
+}
+
+// EstimateOneRepMax uses Brzycki up to 10 reps and Epley above, where
+// Brzycki starts to overestimate.
+func EstimateOneRepMax(weight float64, reps int) float64 {
+	switch {
+	case reps <= 0:
+		return 0
+	case reps == 1:
+		return weight
+	case reps <= 10:
+		return weight * 36 / float64(37-reps)
+	default:
+		return weight * (1 + float64(reps)/30)
+	}
+}
+
+// performance is one completed set, or a whole entry when it was logged
+// without sets_detail.
+type performance struct {
+	WorkoutID       int
+	EntryID         int
+	ExerciseID      int
+	PerformedAt     time.Time
+	Reps            *int
+	DurationSeconds *int
+	Weight          *float64
+}
+
+type recordKey struct {
+	exerciseID int
+	recordType string
+	weight     float64
+}
+
+// computePersonalRecords expects performances in chronological order. On a
+// tie the earlier performance keeps the record.
+func computePersonalRecords(performances []performance) []PersonalRecord {
+	best := make(map[recordKey]*PersonalRecord)
+	consider := func(key recordKey, value float64, p performance) {
+		if value <= 0 {
+			return
+		}
+		if current, ok := best[key]; ok && current.Value >= value {
+			return
+		}
+		best[key] = &PersonalRecord{
+			ExerciseID: key.exerciseID,
+			RecordType: key.recordType,
+			Weight:     key.weight,
+			Value:      value,
+			WorkoutID:  p.WorkoutID,
+			EntryID:    p.EntryID,
+			AchievedAt: p.PerformedAt,
+		}
+	}
+
+	for _, p := range performances {
+		if p.DurationSeconds != nil {
+			consider(recordKey{p.ExerciseID, RecordMaxDuration, 0}, float64(*p.DurationSeconds), p)
+		}
+		if p.Reps == nil {
+			continue
+		}
+
+		var weight float64
+		if p.Weight != nil {
+			weight = math.Round(*p.Weight*100) / 100
+		}
+		consider(recordKey{p.ExerciseID, RecordMaxRepsAtWeight, weight}, float64(*p.Reps), p)
+		consider(recordKey{p.ExerciseID, RecordMaxWeight, 0}, weight, p)
+		consider(recordKey{p.ExerciseID, RecordEstimated1RM, 0}, math.Round(EstimateOneRepMax(weight, *p.Reps)*100)/100, p)
+	}
+
+	records := make([]PersonalRecord, 0, len(best))
+	for _, record := range best {
+		records = append(records, *record)
+	}
+	sort.Slice(records, func(i, j int) bool {
+		a, b := records[i], records[j]
+		if a.ExerciseID != b.ExerciseID {
+			return a.ExerciseID < b.ExerciseID
+		}
+		if a.RecordType != b.RecordType {
+			return a.RecordType < b.RecordType
+		}
+		return a.Weight < b.Weight
+	})
+	return records
+}
+
+// newPersonalRecords returns the records of after held by workoutID that it
+// didn't hold in before, or holds with a better value. Records it already
+// held are left out, so an edit that changes nothing announces nothing.
+func newPersonalRecords(before, after []PersonalRecord, workoutID int) []PersonalRecord {
+	previous := make(map[recordKey]PersonalRecord, len(before))
+	for _, record := range before {
+		previous[recordKey{record.ExerciseID, record.RecordType, record.Weight}] = record
+	}
+
+	records := []PersonalRecord{}
+	for _, record := range after {
+		if record.WorkoutID != workoutID {
+			continue
+		}
+		prev, ok := previous[recordKey{record.ExerciseID, record.RecordType, record.Weight}]
+		if ok && prev.WorkoutID == workoutID && prev.Value >= record.Value {
+			continue
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+// recomputePersonalRecords rebuilds the records of a user for the given
+// exercises from the whole history. Rebuilding instead of comparing against
+// the stored best means edits and deletes that lower a record restore the
+// previous one. It returns the records workoutID set or improved, see
+// newPersonalRecords.
+func recomputePersonalRecords(ctx context.Context, tx *sql.Tx, userID int, exerciseIDs []int64, workoutID int) ([]PersonalRecord, error) {
+	if len(exerciseIDs) == 0 {
+		return []PersonalRecord{}, nil
+	}
+
+	query := `
+	SELECT e.workout_id, e.id, e.exercise_id, w.performed_at, s.reps, s.duration_seconds, s.weight
+	FROM workout_entries e
+	INNER JOIN workouts w ON w.id = e.workout_id
+	INNER JOIN workout_sets s ON s.entry_id = e.id
+	WHERE w.user_id = $1 AND e.exercise_id = ANY($2) AND s.completed AND s.set_type <> 'warmup'
+	UNION ALL
+	SELECT e.workout_id, e.id, e.exercise_id, w.performed_at, e.reps, e.duration_seconds, e.weight
+	FROM workout_entries e
+	INNER JOIN workouts w ON w.id = e.workout_id
+	WHERE w.user_id = $1 AND e.exercise_id = ANY($2)
+	  AND NOT EXISTS (SELECT 1 FROM workout_sets s WHERE s.entry_id = e.id)
+	ORDER BY 4, 2
+	`
+	rows, err := tx.QueryContext(ctx, query, userID, exerciseIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var performances []performance
+	for rows.Next() {
+		var p performance
+		err = rows.Scan(&p.WorkoutID, &p.EntryID, &p.ExerciseID, &p.PerformedAt, &p.Reps, &p.DurationSeconds, &p.Weight)
+		if err != nil {
+			return nil, err
+		}
+		performances = append(performances, p)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	before, err := storedPersonalRecords(ctx, tx, userID, exerciseIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM personal_records WHERE user_id = $1 AND exercise_id = ANY($2)`, userID, exerciseIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	insert := `
+	INSERT INTO personal_records (user_id, exercise_id, record_type, weight, value, workout_id, entry_id, achieved_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	RETURNING id, (SELECT name FROM exercises WHERE id = $2)
+	`
+	after := computePersonalRecords(performances)
+	for i := range after {
+		record := &after[i]
+		err = tx.QueryRowContext(ctx, insert,
+			userID,
+			record.ExerciseID,
+			record.RecordType,
+			record.Weight,
+			record.Value,
+			record.WorkoutID,
+			record.EntryID,
+			record.AchievedAt,
+		).Scan(&record.ID, &record.ExerciseName)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return newPersonalRecords(before, after, workoutID), nil
+}
+
+// storedPersonalRecords lists the records of a user for the given exercises
+// as they are before being recomputed.
+func storedPersonalRecords(ctx context.Context, tx *sql.Tx, userID int, exerciseIDs []int64) ([]PersonalRecord, error) {
+	query := `
+	SELECT exercise_id, record_type, weight, value, workout_id
+	FROM personal_records
+	WHERE user_id = $1 AND exercise_id = ANY($2)
+	`
+	rows, err := tx.QueryContext(ctx, query, userID, exerciseIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []PersonalRecord
+	for rows.Next() {
+		var record PersonalRecord
+		err = rows.Scan(&record.ExerciseID, &record.RecordType, &record.Weight, &record.Value, &record.WorkoutID)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
+
+// workoutExerciseIDs lists the exercises a workout currently references.
+func workoutExerciseIDs(ctx context.Context, tx *sql.Tx, workoutID int64) ([]int64, error) {
+	rows, err := tx.QueryContext(ctx, `SELECT DISTINCT exercise_id FROM workout_entries WHERE workout_id = $1`, workoutID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []int64{}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// refreshPersonalRecords recomputes the records touched by a change to a
+// workout. before are the exercises the workout referenced prior to the
+// change, so records of exercises that were removed from it are restored.
+func refreshPersonalRecords(ctx context.Context, tx *sql.Tx, userID int, workoutID int64, before []int64) ([]PersonalRecord, error) {
+	after, err := workoutExerciseIDs(ctx, tx, workoutID)
+	if err != nil {
+		return nil, err
+	}
+	return recomputePersonalRecords(ctx, tx, userID, mergeIDs(before, after), int(workoutID))
+}
+
+func mergeIDs(a, b []int64) []int64 {
+	seen := make(map[int64]bool, len(a)+len(b))
+	merged := make([]int64, 0, len(a)+len(b))
+	for _, id := range append(append([]int64{}, a...), b...) {
+		if !seen[id] {
+			seen[id] = true
+			merged = append(merged, id)
+		}
+	}
+	return merged
+}
+
+type PostgresPersonalRecordStore struct {
+	db *sql.DB
+}
+
+func NewPostgresPersonalRecordStore(db *sql.DB) *PostgresPersonalRecordStore {
+	return &PostgresPersonalRecordStore{db: db}
+}
+
+type PersonalRecordStore interface {
+	ListPersonalRecords(userID int, exerciseID *int) ([]PersonalRecord, error)
+}
+
+func (s *PostgresPersonalRecordStore) ListPersonalRecords(userID int, exerciseID *int) ([]PersonalRecord, error) {
+	query := `
+	SELECT r.id, r.exercise_id, x.name, r.record_type, r.weight, r.value, r.workout_id, r.entry_id, r.achieved_at
+	FROM personal_records r
+	INNER JOIN exercises x ON x.id = r.exercise_id
+	WHERE r.user_id = $1 AND ($2::bigint IS NULL OR r.exercise_id = $2)
+	ORDER BY x.name, r.record_type, r.weight
+	`
+	rows, err := s.db.Query(query, userID, exerciseID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	records := []PersonalRecord{}
+	for rows.Next() {
+		var record PersonalRecord
+		err = rows.Scan(
+			&record.ID,
+			&record.ExerciseID,
+			&record.ExerciseName,
+			&record.RecordType,
+			&record.Weight,
+			&record.Value,
+			&record.WorkoutID,
+			&record.EntryID,
+			&record.AchievedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
@@ -0,0 +1,107 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEstimateOneRepMax(t *testing.T) {
+	assert.Equal(t, 100.0, EstimateOneRepMax(100, 1))
+	assert.InDelta(t, 112.5, EstimateOneRepMax(100, 5), 0.01)  // Brzycki
+	assert.InDelta(t, 140.0, EstimateOneRepMax(100, 12), 0.01) // Epley
+	assert.Equal(t, 0.0, EstimateOneRepMax(100, 0))
+}
+
+func TestComputePersonalRecords(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2025, 6, d, 18, 0, 0, 0, time.UTC) }
+
+	performances := []performance{
+		{WorkoutID: 1, EntryID: 10, ExerciseID: 7, PerformedAt: day(1), Reps: IntPtr(5), Weight: FloatPtr(100)},
+		{WorkoutID: 2, EntryID: 20, ExerciseID: 7, PerformedAt: day(2), Reps: IntPtr(3), Weight: FloatPtr(110)},
+		// same reps at 100 later on doesn't take the record over
+		{WorkoutID: 3, EntryID: 30, ExerciseID: 7, PerformedAt: day(3), Reps: IntPtr(5), Weight: FloatPtr(100)},
+		{WorkoutID: 3, EntryID: 31, ExerciseID: 8, PerformedAt: day(3), DurationSeconds: IntPtr(90)},
+	}
+
+	records := computePersonalRecords(performances)
+
+	byType := make(map[recordKey]PersonalRecord)
+	for _, record := range records {
+		byType[recordKey{record.ExerciseID, record.RecordType, record.Weight}] = record
+	}
+
+	assert.Len(t, records, 5)
+	assert.Equal(t, 2, byType[recordKey{7, RecordMaxWeight, 0}].WorkoutID)
+	assert.Equal(t, 110.0, byType[recordKey{7, RecordMaxWeight, 0}].Value)
+	assert.Equal(t, 1, byType[recordKey{7, RecordMaxRepsAtWeight, 100}].WorkoutID)
+	assert.Equal(t, 2, byType[recordKey{7, RecordMaxRepsAtWeight, 110}].WorkoutID)
+	assert.Equal(t, 2, byType[recordKey{7, RecordEstimated1RM, 0}].WorkoutID)
+	assert.Equal(t, 90.0, byType[recordKey{8, RecordMaxDuration, 0}].Value)
+}
+
+func TestNewPersonalRecords(t *testing.T) {
+	before := []PersonalRecord{
+		{ExerciseID: 7, RecordType: RecordMaxWeight, Value: 100, WorkoutID: 1},
+		{ExerciseID: 7, RecordType: RecordEstimated1RM, Value: 110, WorkoutID: 2},
+		{ExerciseID: 7, RecordType: RecordMaxRepsAtWeight, Weight: 100, Value: 5, WorkoutID: 2},
+	}
+	after := []PersonalRecord{
+		// held before, unchanged
+		{ExerciseID: 7, RecordType: RecordMaxWeight, Value: 100, WorkoutID: 1},
+		// taken over from workout 2
+		{ExerciseID: 7, RecordType: RecordEstimated1RM, Value: 115, WorkoutID: 1},
+		{ExerciseID: 7, RecordType: RecordMaxRepsAtWeight, Weight: 100, Value: 5, WorkoutID: 2},
+		// a weight never lifted before
+		{ExerciseID: 7, RecordType: RecordMaxRepsAtWeight, Weight: 105, Value: 3, WorkoutID: 1},
+	}
+
+	records := newPersonalRecords(before, after, 1)
+	require.Len(t, records, 2)
+	assert.Equal(t, RecordEstimated1RM, records[0].RecordType)
+	assert.Equal(t, 105.0, records[1].Weight)
+
+	// improving a record the workout already held counts
+	improved := []PersonalRecord{{ExerciseID: 7, RecordType: RecordMaxWeight, Value: 102.5, WorkoutID: 1}}
+	assert.Len(t, newPersonalRecords(before, improved, 1), 1)
+
+	assert.Empty(t, newPersonalRecords(after, after, 1))
+}
+
+func TestUnchangedWorkoutSetsNoRecords(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	ctx := context.Background()
+	store := NewPostgresWorkoutStore(db)
+	_, err := db.Exec(`DELETE FROM personal_records`)
+	require.NoError(t, err)
+
+	workout, err := store.CreateWorkout(ctx, &Workout{
+		UserID:          createTestUser(t, db),
+		Title:           "deadlift day",
+		DurationMinutes: 40,
+		Entries: []WorkoutEntry{
+			{ExerciseName: "Deadlift", Sets: 3, Reps: IntPtr(5), Weight: FloatPtr(140)},
+		},
+	})
+	require.NoError(t, err)
+	assert.NotEmpty(t, workout.PersonalRecords)
+
+	// the same workout sent back as it is
+	err = store.UpdateWorkout(ctx, workout)
+	require.NoError(t, err)
+	assert.Empty(t, workout.PersonalRecords)
+
+	workout.Entries[0].Weight = FloatPtr(150)
+	err = store.UpdateWorkout(ctx, workout)
+	require.NoError(t, err)
+	types := []string{}
+	for _, record := range workout.PersonalRecords {
+		types = append(types, record.RecordType)
+	}
+	assert.ElementsMatch(t, []string{RecordMaxWeight, RecordEstimated1RM, RecordMaxRepsAtWeight}, types)
+}
@@ -0,0 +1,359 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// dateLayout is how calendar dates are handed to Postgres. Passing them as
+// text keeps the session time zone from shifting them by a day.
+const dateLayout = "2006-01-02"
+
+type Program struct {
+	ID          int          `json:"id"`
+	UserID      int          `json:"user_id"`
+	Name        string       `json:"name"`
+	Description string       `json:"description"`
+	Weeks       int          `json:"weeks"`
+	Days        []ProgramDay `json:"days"`
+	CreatedAt   time.Time    `json:"created_at"`
+	UpdatedAt   time.Time    `json:"updated_at"`
+}
+
+// ProgramDay maps day 1-7 of a week of the program to a template. Day 1 of
+// week 1 falls on the start date of an enrollment.
+type ProgramDay struct {
+	ID            int    `json:"id"`
+	Week          int    `json:"week"`
+	Day           int    `json:"day"`
+	TemplateID    int    `json:"template_id"`
+	TemplateTitle string `json:"template_title"`
+}
+
+type ProgramEnrollment struct {
+	ID        int        `json:"id"`
+	ProgramID int        `json:"program_id"`
+	UserID    int        `json:"user_id"`
+	StartDate time.Time  `json:"start_date"`
+	CreatedAt time.Time  `json:"created_at"`
+	Adherence *Adherence `json:"adherence,omitempty"`
+}
+
+// Adherence only counts sessions scheduled up to and including the day it
+// was computed for.
+type Adherence struct {
+	Scheduled int     `json:"scheduled"`
+	Completed int     `json:"completed"`
+	Rate      float64 `json:"rate"`
+}
+
+type ScheduledSession struct {
+	ID            int        `json:"id"`
+	EnrollmentID  int        `json:"enrollment_id"`
+	ProgramID     int        `json:"program_id"`
+	ProgramName   string     `json:"program_name"`
+	TemplateID    int        `json:"template_id"`
+	TemplateTitle string     `json:"template_title"`
+	ScheduledDate time.Time  `json:"scheduled_date"`
+	WorkoutID     *int       `json:"workout_id"`
+	CompletedAt   *time.Time `json:"completed_at"`
+}
+
+type PostgresProgramStore struct {
+	db *sql.DB
+}
+
+func NewPostgresProgramStore(db *sql.DB) *PostgresProgramStore {
+	return &PostgresProgramStore{db: db}
+}
+
+type ProgramStore interface {
+	CreateProgram(*Program) error
+	GetProgramByID(id int64) (*Program, error)
+	ListPrograms(userID int) ([]*Program, error)
+	DeleteProgram(id int64) error
+	Enroll(*ProgramEnrollment) error
+	GetEnrollment(id int64, today time.Time) (*ProgramEnrollment, error)
+	ListScheduledSessions(userID int, from, to time.Time) ([]*ScheduledSession, error)
+	CompleteSession(sessionID int64, userID int, workoutID int64) error
+}
+
+func (s *PostgresProgramStore) CreateProgram(program *Program) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+	INSERT INTO programs (user_id, name, description, weeks)
+	VALUES ($1, $2, $3, $4)
+	RETURNING id, created_at, updated_at
+	`
+	err = tx.QueryRowContext(ctx, query, program.UserID, program.Name, program.Description, program.Weeks).
+		Scan(&program.ID, &program.CreatedAt, &program.UpdatedAt)
+	if err != nil {
+		return err
+	}
+
+	dayQuery := `
+	INSERT INTO program_days (program_id, week, day, template_id)
+	VALUES ($1, $2, $3, $4)
+	RETURNING id, (SELECT title FROM workout_templates WHERE id = $4)
+	`
+	for i := range program.Days {
+		day := &program.Days[i]
+		err = tx.QueryRowContext(ctx, dayQuery, program.ID, day.Week, day.Day, day.TemplateID).Scan(&day.ID, &day.TemplateTitle)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (s *PostgresProgramStore) GetProgramByID(id int64) (*Program, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	program := &Program{Days: []ProgramDay{}}
+	query := `
+	SELECT id, user_id, name, description, weeks, created_at, updated_at
+	FROM programs
+	WHERE id = $1
+	`
+	err := s.db.QueryRowContext(ctx, query, id).Scan(
+		&program.ID,
+		&program.UserID,
+		&program.Name,
+		&program.Description,
+		&program.Weeks,
+		&program.CreatedAt,
+		&program.UpdatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	dayQuery := `
+	SELECT d.id, d.week, d.day, d.template_id, t.title
+	FROM program_days d
+	INNER JOIN workout_templates t ON t.id = d.template_id
+	WHERE d.program_id = $1
+	ORDER BY d.week, d.day
+	`
+	rows, err := s.db.QueryContext(ctx, dayQuery, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var day ProgramDay
+		err = rows.Scan(&day.ID, &day.Week, &day.Day, &day.TemplateID, &day.TemplateTitle)
+		if err != nil {
+			return nil, err
+		}
+		program.Days = append(program.Days, day)
+	}
+
+	return program, rows.Err()
+}
+
+// ListPrograms returns the programs authored by a user without their days.
+func (s *PostgresProgramStore) ListPrograms(userID int) ([]*Program, error) {
+	query := `
+	SELECT id, user_id, name, description, weeks, created_at, updated_at
+	FROM programs
+	WHERE user_id = $1
+	ORDER BY name, id
+	`
+	rows, err := s.db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	programs := []*Program{}
+	for rows.Next() {
+		program := &Program{}
+		err = rows.Scan(
+			&program.ID,
+			&program.UserID,
+			&program.Name,
+			&program.Description,
+			&program.Weeks,
+			&program.CreatedAt,
+			&program.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		programs = append(programs, program)
+	}
+
+	return programs, rows.Err()
+}
+
+func (s *PostgresProgramStore) DeleteProgram(id int64) error {
+	result, err := s.db.Exec(`DELETE FROM programs WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// Enroll schedules every day of the program relative to the start date in
+// the same transaction, so later schedule lookups are plain date ranges.
+func (s *PostgresProgramStore) Enroll(enrollment *ProgramEnrollment) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+	INSERT INTO program_enrollments (program_id, user_id, start_date)
+	VALUES ($1, $2, $3)
+	RETURNING id, created_at
+	`
+	err = tx.QueryRowContext(ctx, query, enrollment.ProgramID, enrollment.UserID, enrollment.StartDate.Format(dateLayout)).
+		Scan(&enrollment.ID, &enrollment.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	sessionQuery := `
+	INSERT INTO program_sessions (enrollment_id, program_day_id, scheduled_date)
+	SELECT $1, d.id, $2::date + ((d.week - 1) * 7 + (d.day - 1))
+	FROM program_days d
+	WHERE d.program_id = $3
+	`
+	_, err = tx.ExecContext(ctx, sessionQuery, enrollment.ID, enrollment.StartDate.Format(dateLayout), enrollment.ProgramID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *PostgresProgramStore) GetEnrollment(id int64, today time.Time) (*ProgramEnrollment, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	enrollment := &ProgramEnrollment{Adherence: &Adherence{}}
+	query := `
+	SELECT e.id, e.program_id, e.user_id, e.start_date, e.created_at,
+	       COUNT(s.id) FILTER (WHERE s.scheduled_date <= $2::date),
+	       COUNT(s.workout_id) FILTER (WHERE s.scheduled_date <= $2::date)
+	FROM program_enrollments e
+	LEFT JOIN program_sessions s ON s.enrollment_id = e.id
+	WHERE e.id = $1
+	GROUP BY e.id
+	`
+	err := s.db.QueryRowContext(ctx, query, id, today.Format(dateLayout)).Scan(
+		&enrollment.ID,
+		&enrollment.ProgramID,
+		&enrollment.UserID,
+		&enrollment.StartDate,
+		&enrollment.CreatedAt,
+		&enrollment.Adherence.Scheduled,
+		&enrollment.Adherence.Completed,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if enrollment.Adherence.Scheduled > 0 {
+		enrollment.Adherence.Rate = float64(enrollment.Adherence.Completed) / float64(enrollment.Adherence.Scheduled)
+	}
+	return enrollment, nil
+}
+
+// ListScheduledSessions returns the sessions of all enrollments of a user
+// scheduled between from and to, both inclusive.
+func (s *PostgresProgramStore) ListScheduledSessions(userID int, from, to time.Time) ([]*ScheduledSession, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+	SELECT s.id, s.enrollment_id, p.id, p.name, t.id, t.title, s.scheduled_date, s.workout_id, s.completed_at
+	FROM program_sessions s
+	INNER JOIN program_enrollments e ON e.id = s.enrollment_id
+	INNER JOIN programs p ON p.id = e.program_id
+	INNER JOIN program_days d ON d.id = s.program_day_id
+	INNER JOIN workout_templates t ON t.id = d.template_id
+	WHERE e.user_id = $1 AND s.scheduled_date BETWEEN $2::date AND $3::date
+	ORDER BY s.scheduled_date, s.id
+	`
+	rows, err := s.db.QueryContext(ctx, query, userID, from.Format(dateLayout), to.Format(dateLayout))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []*ScheduledSession{}
+	for rows.Next() {
+		session := &ScheduledSession{}
+		err = rows.Scan(
+			&session.ID,
+			&session.EnrollmentID,
+			&session.ProgramID,
+			&session.ProgramName,
+			&session.TemplateID,
+			&session.TemplateTitle,
+			&session.ScheduledDate,
+			&session.WorkoutID,
+			&session.CompletedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+
+	return sessions, rows.Err()
+}
+
+// CompleteSession links a logged workout to a session of userID. It
+// returns sql.ErrNoRows when the session doesn't belong to the user.
+func (s *PostgresProgramStore) CompleteSession(sessionID int64, userID int, workoutID int64) error {
+	query := `
+	UPDATE program_sessions s
+	SET workout_id = $1, completed_at = CURRENT_TIMESTAMP
+	FROM program_enrollments e
+	WHERE s.id = $2 AND e.id = s.enrollment_id AND e.user_id = $3
+	`
+	result, err := s.db.Exec(query, workoutID, sessionID, userID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func createTestTemplate(t *testing.T, templateStore *PostgresTemplateStore, userID int, title string) *WorkoutTemplate {
+	t.Helper()
+
+	template := &WorkoutTemplate{
+		UserID: userID,
+		Title:  title,
+		Entries: []WorkoutTemplateEntry{
+			{ExerciseName: "Squat", TargetSets: 3, TargetReps: IntPtr(5)},
+		},
+	}
+	require.NoError(t, templateStore.CreateTemplate(context.Background(), template))
+	return template
+}
+
+func TestProgramEnrollment(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	_, err := db.Exec(`TRUNCATE programs CASCADE`)
+	require.NoError(t, err)
+
+	userID := createTestUser(t, db)
+	templateStore := NewPostgresTemplateStore(db)
+	store := NewPostgresProgramStore(db)
+	day := func(d int) time.Time { return time.Date(2025, 6, d, 0, 0, 0, 0, time.UTC) }
+
+	push := createTestTemplate(t, templateStore, userID, "push")
+	pull := createTestTemplate(t, templateStore, userID, "pull")
+
+	program := &Program{
+		UserID: userID,
+		Name:   "two weeks",
+		Weeks:  2,
+		Days: []ProgramDay{
+			{Week: 2, Day: 1, TemplateID: push.ID},
+			{Week: 1, Day: 3, TemplateID: pull.ID},
+			{Week: 1, Day: 1, TemplateID: push.ID},
+		},
+	}
+	require.NoError(t, store.CreateProgram(program))
+
+	stored, err := store.GetProgramByID(int64(program.ID))
+	require.NoError(t, err)
+	require.Len(t, stored.Days, 3)
+	assert.Equal(t, []string{"push", "pull", "push"}, []string{
+		stored.Days[0].TemplateTitle, stored.Days[1].TemplateTitle, stored.Days[2].TemplateTitle,
+	})
+	assert.Equal(t, 2, stored.Days[2].Week)
+
+	// 2025-06-02 is a Monday
+	enrollment := &ProgramEnrollment{ProgramID: program.ID, UserID: userID, StartDate: day(2)}
+	require.NoError(t, store.Enroll(enrollment))
+
+	sessions, err := store.ListScheduledSessions(userID, day(2), day(8))
+	require.NoError(t, err)
+	require.Len(t, sessions, 2)
+	assert.Equal(t, "2025-06-02", sessions[0].ScheduledDate.Format(dateLayout))
+	assert.Equal(t, "push", sessions[0].TemplateTitle)
+	assert.Equal(t, "2025-06-04", sessions[1].ScheduledDate.Format(dateLayout))
+	assert.Equal(t, "pull", sessions[1].TemplateTitle)
+	assert.Equal(t, "two weeks", sessions[1].ProgramName)
+
+	sessions, err = store.ListScheduledSessions(userID, day(9), day(9))
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+	assert.Equal(t, push.ID, sessions[0].TemplateID)
+
+	workout, err := NewPostgresWorkoutStore(db).CreateWorkout(context.Background(), &Workout{
+		UserID:          userID,
+		Title:           "push",
+		DurationMinutes: 45,
+		PerformedAt:     day(2),
+	})
+	require.NoError(t, err)
+
+	sessions, err = store.ListScheduledSessions(userID, day(2), day(2))
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+	firstSession := int64(sessions[0].ID)
+
+	err = store.CompleteSession(firstSession, userID+1, int64(workout.ID))
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+	require.NoError(t, store.CompleteSession(firstSession, userID, int64(workout.ID)))
+
+	tests := []struct {
+		name  string
+		today time.Time
+		want  Adherence
+	}{
+		{name: "before the start", today: day(1), want: Adherence{}},
+		{name: "first week", today: day(5), want: Adherence{Scheduled: 2, Completed: 1, Rate: 0.5}},
+		{name: "after the end", today: day(30), want: Adherence{Scheduled: 3, Completed: 1, Rate: 1.0 / 3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := store.GetEnrollment(int64(enrollment.ID), tt.today)
+			require.NoError(t, err)
+			require.NotNil(t, got.Adherence)
+			assert.Equal(t, tt.want.Scheduled, got.Adherence.Scheduled)
+			assert.Equal(t, tt.want.Completed, got.Adherence.Completed)
+			assert.InDelta(t, tt.want.Rate, got.Adherence.Rate, 0.001)
+		})
+	}
+
+	missing, err := store.GetEnrollment(int64(enrollment.ID)+1000, day(5))
+	require.NoError(t, err)
+	assert.Nil(t, missing)
+}
+
+func TestDeleteTemplateUsedByProgram(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	userID := createTestUser(t, db)
+	templateStore := NewPostgresTemplateStore(db)
+	store := NewPostgresProgramStore(db)
+
+	template := createTestTemplate(t, templateStore, userID, "legs")
+	program := &Program{
+		UserID: userID,
+		Name:   "legs only",
+		Weeks:  1,
+		Days:   []ProgramDay{{Week: 1, Day: 1, TemplateID: template.ID}},
+	}
+	require.NoError(t, store.CreateProgram(program))
+
+	err := templateStore.DeleteTemplate(context.Background(), int64(template.ID))
+	assert.ErrorIs(t, err, ErrTemplateInUse)
+
+	require.NoError(t, store.DeleteProgram(int64(program.ID)))
+	require.NoError(t, templateStore.DeleteTemplate(context.Background(), int64(template.ID)))
+	assert.ErrorIs(t, store.DeleteProgram(int64(program.ID)), sql.ErrNoRows)
+}
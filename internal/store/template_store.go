@@ -0,0 +1,293 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgconn"
+)
+
+var ErrTemplateInUse = errors.New("template is used by a program")
+
+type WorkoutTemplate struct {
+	ID              int                    `json:"id"`
+	UserID          int                    `json:"user_id"`
+	Title           string                 `json:"title"`
+	Description     string                 `json:"description"`
+	DurationMinutes int                    `json:"duration_minutes"`
+	Entries         []WorkoutTemplateEntry `json:"entries"`
+	CreatedAt       time.Time              `json:"created_at"`
+	UpdatedAt       time.Time              `json:"updated_at"`
+}
+
+// WorkoutTemplateEntry is a planned exercise. The targets become the
+// actual values of the WorkoutEntry when a workout is started from the
+// template.
+type WorkoutTemplateEntry struct {
+	ID                    int      `json:"id"`
+	ExerciseID            int      `json:"exercise_id"`
+	ExerciseName          string   `json:"exercise_name"`
+	TargetSets            int      `json:"target_sets"`
+	TargetReps            *int     `json:"target_reps"`
+	TargetDurationSeconds *int     `json:"target_duration_seconds"`
+	TargetWeight          *float64 `json:"target_weight"`
+	Notes                 string   `json:"notes"`
+	OrderIndex            int      `json:"order_index"`
+}
+
+// NewWorkout instantiates the template as an unsaved workout for userID.
+func (t *WorkoutTemplate) NewWorkout(userID int) *Workout {
+	workout := &Workout{
+		UserID:          userID,
+		Title:           t.Title,
+		Description:     t.Description,
+		DurationMinutes: t.DurationMinutes,
+		Entries:         make([]WorkoutEntry, 0, len(t.Entries)),
+	}
+
+	for _, planned := range t.Entries {
+		workout.Entries = append(workout.Entries, WorkoutEntry{
+			ExerciseID:      planned.ExerciseID,
+			ExerciseName:    planned.ExerciseName,
+			Sets:            planned.TargetSets,
+			Reps:            planned.TargetReps,
+			DurationSeconds: planned.TargetDurationSeconds,
+			Weight:          planned.TargetWeight,
+			Notes:           planned.Notes,
+			OrderIndex:      planned.OrderIndex,
+		})
+	}
+	return workout
+}
+
+type PostgresTemplateStore struct {
+	db *sql.DB
+}
+
+func NewPostgresTemplateStore(db *sql.DB) *PostgresTemplateStore {
+	return &PostgresTemplateStore{db: db}
+}
+
+type TemplateStore interface {
+	CreateTemplate(ctx context.Context, template *WorkoutTemplate) error
+	GetTemplateByID(ctx context.Context, id int64) (*WorkoutTemplate, error)
+	ListTemplates(ctx context.Context, userID int) ([]*WorkoutTemplate, error)
+	UpdateTemplate(ctx context.Context, template *WorkoutTemplate) error
+	DeleteTemplate(ctx context.Context, id int64) error
+	GetTemplateOwner(ctx context.Context, id int64) (int, error)
+}
+
+func (s *PostgresTemplateStore) CreateTemplate(ctx context.Context, template *WorkoutTemplate) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+	INSERT INTO workout_templates (user_id, title, description, duration_minutes)
+	VALUES ($1, $2, $3, $4)
+	RETURNING id, created_at, updated_at
+	`
+	err = tx.QueryRowContext(ctx, query, template.UserID, template.Title, template.Description, template.DurationMinutes).
+		Scan(&template.ID, &template.CreatedAt, &template.UpdatedAt)
+	if err != nil {
+		return err
+	}
+
+	err = insertTemplateEntries(ctx, tx, template)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func insertTemplateEntries(ctx context.Context, tx *sql.Tx, template *WorkoutTemplate) error {
+	query := `
+	INSERT INTO workout_template_entries (template_id, exercise_id, exercise_name, target_sets, target_reps, target_duration_seconds, target_weight, notes, order_index)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	RETURNING id
+	`
+	for i := range template.Entries {
+		entry := &template.Entries[i]
+
+		err := resolveExercise(ctx, tx, &entry.ExerciseID, &entry.ExerciseName)
+		if err != nil {
+			return err
+		}
+
+		err = tx.QueryRowContext(ctx, query,
+			template.ID,
+			entry.ExerciseID,
+			entry.ExerciseName,
+			entry.TargetSets,
+			entry.TargetReps,
+			entry.TargetDurationSeconds,
+			entry.TargetWeight,
+			entry.Notes,
+			entry.OrderIndex,
+		).Scan(&entry.ID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *PostgresTemplateStore) GetTemplateByID(ctx context.Context, id int64) (*WorkoutTemplate, error) {
+	template := &WorkoutTemplate{Entries: []WorkoutTemplateEntry{}}
+	query := `
+	SELECT id, user_id, title, description, duration_minutes, created_at, updated_at
+	FROM workout_templates
+	WHERE id = $1
+	`
+	err := s.db.QueryRowContext(ctx, query, id).Scan(
+		&template.ID,
+		&template.UserID,
+		&template.Title,
+		&template.Description,
+		&template.DurationMinutes,
+		&template.CreatedAt,
+		&template.UpdatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	entryQuery := `
+	SELECT id, exercise_id, exercise_name, target_sets, target_reps, target_duration_seconds, target_weight, notes, order_index
+	FROM workout_template_entries
+	WHERE template_id = $1
+	ORDER BY order_index
+	`
+	rows, err := s.db.QueryContext(ctx, entryQuery, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var entry WorkoutTemplateEntry
+		err = rows.Scan(
+			&entry.ID,
+			&entry.ExerciseID,
+			&entry.ExerciseName,
+			&entry.TargetSets,
+			&entry.TargetReps,
+			&entry.TargetDurationSeconds,
+			&entry.TargetWeight,
+			&entry.Notes,
+			&entry.OrderIndex,
+		)
+		if err != nil {
+			return nil, err
+		}
+		template.Entries = append(template.Entries, entry)
+	}
+
+	return template, rows.Err()
+}
+
+// ListTemplates returns the templates of a user without their entries.
+func (s *PostgresTemplateStore) ListTemplates(ctx context.Context, userID int) ([]*WorkoutTemplate, error) {
+	query := `
+	SELECT id, user_id, title, description, duration_minutes, created_at, updated_at
+	FROM workout_templates
+	WHERE user_id = $1
+	ORDER BY title, id
+	`
+	rows, err := s.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	templates := []*WorkoutTemplate{}
+	for rows.Next() {
+		template := &WorkoutTemplate{}
+		err = rows.Scan(
+			&template.ID,
+			&template.UserID,
+			&template.Title,
+			&template.Description,
+			&template.DurationMinutes,
+			&template.CreatedAt,
+			&template.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		templates = append(templates, template)
+	}
+
+	return templates, rows.Err()
+}
+
+// UpdateTemplate replaces the planned entries wholesale, nothing references
+// them by ID.
+func (s *PostgresTemplateStore) UpdateTemplate(ctx context.Context, template *WorkoutTemplate) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+	UPDATE workout_templates
+	SET title = $1, description = $2, duration_minutes = $3, updated_at = CURRENT_TIMESTAMP
+	WHERE id = $4
+	RETURNING updated_at
+	`
+	err = tx.QueryRowContext(ctx, query, template.Title, template.Description, template.DurationMinutes, template.ID).Scan(&template.UpdatedAt)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM workout_template_entries WHERE template_id = $1`, template.ID)
+	if err != nil {
+		return err
+	}
+
+	err = insertTemplateEntries(ctx, tx, template)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DeleteTemplate returns ErrTemplateInUse while a program day still
+// schedules the template.
+func (s *PostgresTemplateStore) DeleteTemplate(ctx context.Context, id int64) error {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM workout_templates WHERE id = $1`, id)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23503" {
+		return ErrTemplateInUse
+	}
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (s *PostgresTemplateStore) GetTemplateOwner(ctx context.Context, id int64) (int, error) {
+	var userID int
+	err := s.db.QueryRowContext(ctx, `SELECT user_id FROM workout_templates WHERE id = $1`, id).Scan(&userID)
+	if err != nil {
+		return 0, err
+	}
+	return userID, nil
+}
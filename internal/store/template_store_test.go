@@ -0,0 +1,139 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTemplateNewWorkout(t *testing.T) {
+	template := &WorkoutTemplate{
+		Title:           "upper",
+		Description:     "push and pull",
+		DurationMinutes: 50,
+		Entries: []WorkoutTemplateEntry{
+			{ExerciseID: 1, ExerciseName: "Bench Press", TargetSets: 3, TargetReps: IntPtr(8), TargetWeight: FloatPtr(80), OrderIndex: 1},
+			{ExerciseID: 2, ExerciseName: "Plank", TargetSets: 2, TargetDurationSeconds: IntPtr(60), Notes: "brace", OrderIndex: 2},
+		},
+	}
+
+	workout := template.NewWorkout(7)
+	assert.Equal(t, 7, workout.UserID)
+	assert.Equal(t, "upper", workout.Title)
+	assert.Equal(t, 50, workout.DurationMinutes)
+	assert.Zero(t, workout.ID)
+	assert.Equal(t, []WorkoutEntry{
+		{ExerciseID: 1, ExerciseName: "Bench Press", Sets: 3, Reps: IntPtr(8), Weight: FloatPtr(80), OrderIndex: 1},
+		{ExerciseID: 2, ExerciseName: "Plank", Sets: 2, DurationSeconds: IntPtr(60), Notes: "brace", OrderIndex: 2},
+	}, workout.Entries)
+}
+
+func TestTemplateCRUD(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	userID := createTestUser(t, db)
+	store := NewPostgresTemplateStore(db)
+
+	template := &WorkoutTemplate{
+		UserID:          userID,
+		Title:           "full body",
+		DurationMinutes: 60,
+		Entries: []WorkoutTemplateEntry{
+			{ExerciseName: "plank", TargetSets: 3, TargetDurationSeconds: IntPtr(45), OrderIndex: 2},
+			{ExerciseName: "Squat", TargetSets: 5, TargetReps: IntPtr(5), TargetWeight: FloatPtr(100), OrderIndex: 1},
+		},
+	}
+	require.NoError(t, store.CreateTemplate(context.Background(), template))
+	assert.NotZero(t, template.ID)
+
+	stored, err := store.GetTemplateByID(context.Background(), int64(template.ID))
+	require.NoError(t, err)
+	require.Len(t, stored.Entries, 2)
+	assert.Equal(t, "Squat", stored.Entries[0].ExerciseName)
+	assert.Equal(t, "Plank", stored.Entries[1].ExerciseName)
+	assert.NotZero(t, stored.Entries[1].ExerciseID)
+
+	templates, err := store.ListTemplates(context.Background(), userID)
+	require.NoError(t, err)
+	ids := []int{}
+	for _, listed := range templates {
+		ids = append(ids, listed.ID)
+	}
+	assert.Contains(t, ids, template.ID)
+
+	owner, err := store.GetTemplateOwner(context.Background(), int64(template.ID))
+	require.NoError(t, err)
+	assert.Equal(t, userID, owner)
+
+	stored.Title = "lower body"
+	stored.Entries = []WorkoutTemplateEntry{
+		{ExerciseName: "Deadlift", TargetSets: 3, TargetReps: IntPtr(5), OrderIndex: 1},
+	}
+	require.NoError(t, store.UpdateTemplate(context.Background(), stored))
+
+	updated, err := store.GetTemplateByID(context.Background(), int64(template.ID))
+	require.NoError(t, err)
+	assert.Equal(t, "lower body", updated.Title)
+	require.Len(t, updated.Entries, 1)
+	assert.Equal(t, "Deadlift", updated.Entries[0].ExerciseName)
+
+	// a failed update leaves the template as it was
+	updated.Entries = []WorkoutTemplateEntry{{ExerciseName: "Not An Exercise", TargetSets: 1, TargetReps: IntPtr(1)}}
+	assert.ErrorIs(t, store.UpdateTemplate(context.Background(), updated), ErrUnknownExercise)
+	unchanged, err := store.GetTemplateByID(context.Background(), int64(template.ID))
+	require.NoError(t, err)
+	require.Len(t, unchanged.Entries, 1)
+	assert.Equal(t, "Deadlift", unchanged.Entries[0].ExerciseName)
+
+	require.NoError(t, store.DeleteTemplate(context.Background(), int64(template.ID)))
+	deleted, err := store.GetTemplateByID(context.Background(), int64(template.ID))
+	require.NoError(t, err)
+	assert.Nil(t, deleted)
+	assert.ErrorIs(t, store.DeleteTemplate(context.Background(), int64(template.ID)), sql.ErrNoRows)
+	_, err = store.GetTemplateOwner(context.Background(), int64(template.ID))
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+}
+
+func TestStartWorkoutFromTemplate(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	userID := createTestUser(t, db)
+	templateStore := NewPostgresTemplateStore(db)
+	workoutStore := NewPostgresWorkoutStore(db)
+
+	template := &WorkoutTemplate{
+		UserID: userID,
+		Title:  "pull",
+		Entries: []WorkoutTemplateEntry{
+			{ExerciseName: "Pull Up", TargetSets: 4, TargetReps: IntPtr(6), OrderIndex: 1},
+			{ExerciseName: "Barbell Row", TargetSets: 3, TargetReps: IntPtr(8), TargetWeight: FloatPtr(70), OrderIndex: 2},
+			{ExerciseName: "Bicep Curl", TargetSets: 3, TargetReps: IntPtr(12), Notes: "slow negatives", OrderIndex: 3},
+		},
+	}
+	require.NoError(t, templateStore.CreateTemplate(context.Background(), template))
+
+	stored, err := templateStore.GetTemplateByID(context.Background(), int64(template.ID))
+	require.NoError(t, err)
+
+	created, err := workoutStore.CreateWorkout(context.Background(), stored.NewWorkout(userID))
+	require.NoError(t, err)
+
+	workout, err := workoutStore.GetWorkoutByID(context.Background(), int64(created.ID))
+	require.NoError(t, err)
+	assert.Equal(t, "pull", workout.Title)
+	require.Len(t, workout.Entries, len(stored.Entries))
+	for i, planned := range stored.Entries {
+		entry := workout.Entries[i]
+		assert.Equal(t, planned.ExerciseID, entry.ExerciseID)
+		assert.Equal(t, planned.TargetSets, entry.Sets)
+		assert.Equal(t, planned.TargetReps, entry.Reps)
+		assert.Equal(t, planned.TargetWeight, entry.Weight)
+		assert.Equal(t, planned.Notes, entry.Notes)
+		assert.Equal(t, planned.OrderIndex, entry.OrderIndex)
+	}
+}
@@ -1,12 +1,19 @@
 package store
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"time"
 
 	"github.com/shiponcs/femProject/internal/tokens"
 )
 
+var (
+	ErrInvalidToken = errors.New("invalid or expired token")
+	ErrTokenReused  = errors.New("refresh token was already used")
+)
+
 type PostgresTokenStore struct {
 	db *sql.DB
 }
@@ -17,37 +24,247 @@ func NewPostgresTokenStore(db *sql.DB) *PostgresTokenStore {
 	}
 }
 
+// SessionInfo describes the client a session was started from.
+type SessionInfo struct {
+	UserAgent string
+	IP        string
+	Label     string
+}
+
+// Session is a token family as shown to its owner: one login and the
+// refreshes that kept it alive.
+type Session struct {
+	ID         int64      `json:"id"`
+	Label      string     `json:"label"`
+	UserAgent  string     `json:"user_agent"`
+	IP         string     `json:"ip"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	Current    bool       `json:"current"`
+}
+
 type TokenStore interface {
-	Insert(token *tokens.Token) error
-	CreateNewToken(userID int, ttl time.Duration, scope string) (*tokens.Token, error)
-	DeleteAllTokensForUser(userID int, scope string) error
+	Insert(ctx context.Context, token *tokens.Token) error
+	CreateNewToken(ctx context.Context, userID int, ttl time.Duration, scope string) (*tokens.Token, error)
+	DeleteAllTokensForUser(ctx context.Context, userID int, scope string) error
+	CreateSession(ctx context.Context, userID int, refreshTTL time.Duration, info SessionInfo) (*tokens.Token, error)
+	RotateRefreshToken(ctx context.Context, plaintext string, refreshTTL time.Duration, info SessionInfo) (*tokens.Token, error)
+	ListSessions(ctx context.Context, userID int, currentSessionID int64) ([]Session, error)
+	DeleteSession(ctx context.Context, userID int, sessionID int64) error
 }
 
-func (t *PostgresTokenStore) CreateNewToken(userID int, ttl time.Duration, scope string) (*tokens.Token, error) {
+func (t *PostgresTokenStore) CreateNewToken(ctx context.Context, userID int, ttl time.Duration, scope string) (*tokens.Token, error) {
 	token, err := tokens.GenerateToken(userID, ttl, scope)
 	if err != nil {
 		return nil, err
 	}
 
-	err = t.Insert(token)
+	err = t.Insert(ctx, token)
 	return token, err
 }
 
-func (t *PostgresTokenStore) Insert(token *tokens.Token) error {
+func (t *PostgresTokenStore) Insert(ctx context.Context, token *tokens.Token) error {
+	return insertToken(ctx, t.db, token, SessionInfo{})
+}
+
+type queryRower interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// insertToken starts a new family when token.FamilyID is zero and stores
+// the family it ended up in on the token.
+func insertToken(ctx context.Context, db queryRower, token *tokens.Token, info SessionInfo) error {
+	var familyID *int64
+	if token.FamilyID != 0 {
+		familyID = &token.FamilyID
+	}
+
 	query := `
-	INSERT INTO tokens (hash, user_id, expiry, scope)
-	VALUES ($1, $2, $3, $4)  
+	INSERT INTO tokens (hash, user_id, expiry, scope, family_id, user_agent, ip, label)
+	VALUES ($1, $2, $3, $4, COALESCE($5, nextval('token_family_seq')), $6, $7, $8)
+	RETURNING family_id
 	`
-	_, err := t.db.Exec(query, token.Hash, token.UserID, token.Expiry, token.Scope)
-
-	return err
+	return db.QueryRowContext(ctx, query,
+		token.Hash,
+		token.UserID,
+		token.Expiry,
+		token.Scope,
+		familyID,
+		info.UserAgent,
+		info.IP,
+		info.Label,
+	).Scan(&token.FamilyID)
 }
 
-func (t *PostgresTokenStore) DeleteAllTokensForUser(userId int, scope string) error {
+func (t *PostgresTokenStore) DeleteAllTokensForUser(ctx context.Context, userId int, scope string) error {
 	query := `
-	DELETE FROM tokens 
+	DELETE FROM tokens
 	WHERE scope = $1 AND user_id = $2
 	`
-	_, err := t.db.Exec(query, scope, userId)
+	_, err := t.db.ExecContext(ctx, query, scope, userId)
 	return err
 }
+
+// CreateSession starts a new token family with the refresh token that keeps
+// it alive. Access tokens for the session are issued separately, with the
+// family ID of the returned token.
+func (t *PostgresTokenStore) CreateSession(ctx context.Context, userID int, refreshTTL time.Duration, info SessionInfo) (*tokens.Token, error) {
+	refresh, err := tokens.GenerateToken(userID, refreshTTL, tokens.ScopeRefresh)
+	if err != nil {
+		return nil, err
+	}
+
+	err = insertToken(ctx, t.db, refresh, info)
+	if err != nil {
+		return nil, err
+	}
+	return refresh, nil
+}
+
+// TokenReusedError is returned by RotateRefreshToken for a refresh token
+// that was already rotated. It matches ErrTokenReused and names the session
+// that was revoked because of it.
+type TokenReusedError struct {
+	UserID    int
+	SessionID int64
+}
+
+func (e *TokenReusedError) Error() string {
+	return ErrTokenReused.Error()
+}
+
+func (e *TokenReusedError) Is(target error) bool {
+	return target == ErrTokenReused
+}
+
+// RotateRefreshToken exchanges a refresh token for a new one of the same
+// family. A refresh token can only be used once: presenting one that was
+// already rotated means it leaked, so every token of its family is deleted
+// and a *TokenReusedError is returned. The new token keeps the label of the
+// session and records the client that refreshed it.
+func (t *PostgresTokenStore) RotateRefreshToken(ctx context.Context, plaintext string, refreshTTL time.Duration, info SessionInfo) (*tokens.Token, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	tx, err := t.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `
+	SELECT user_id, family_id, expiry, rotated_at, label
+	FROM tokens
+	WHERE hash = $1 AND scope = $2
+	FOR UPDATE
+	`
+	var userID int
+	var familyID int64
+	var expiry time.Time
+	var rotatedAt sql.NullTime
+	err = tx.QueryRowContext(ctx, query, tokens.Hash(plaintext), tokens.ScopeRefresh).Scan(&userID, &familyID, &expiry, &rotatedAt, &info.Label)
+	if err == sql.ErrNoRows {
+		return nil, ErrInvalidToken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if rotatedAt.Valid {
+		_, err = tx.ExecContext(ctx, `DELETE FROM tokens WHERE family_id = $1`, familyID)
+		if err != nil {
+			return nil, err
+		}
+		err = tx.Commit()
+		if err != nil {
+			return nil, err
+		}
+		return nil, &TokenReusedError{UserID: userID, SessionID: familyID}
+	}
+
+	if !expiry.After(time.Now()) {
+		return nil, ErrInvalidToken
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE tokens SET rotated_at = CURRENT_TIMESTAMP WHERE hash = $1`, tokens.Hash(plaintext))
+	if err != nil {
+		return nil, err
+	}
+
+	refresh, err := tokens.GenerateToken(userID, refreshTTL, tokens.ScopeRefresh)
+	if err != nil {
+		return nil, err
+	}
+	refresh.FamilyID = familyID
+
+	err = insertToken(ctx, tx, refresh, info)
+	if err != nil {
+		return nil, err
+	}
+
+	return refresh, tx.Commit()
+}
+
+// ListSessions returns the live sessions of a user, most recently used
+// first. Rotated refresh tokens are kept for reuse detection only and
+// don't keep a session alive. The client of a session is the one that last
+// refreshed it, access tokens don't carry client details.
+func (t *PostgresTokenStore) ListSessions(ctx context.Context, userID int, currentSessionID int64) ([]Session, error) {
+	query := `
+	SELECT family_id,
+	       MIN(created_at),
+	       MAX(last_used_at),
+	       MAX(expiry) FILTER (WHERE rotated_at IS NULL),
+	       COALESCE((array_agg(user_agent ORDER BY created_at DESC) FILTER (WHERE scope = $3))[1], ''),
+	       COALESCE((array_agg(ip ORDER BY created_at DESC) FILTER (WHERE scope = $3))[1], ''),
+	       COALESCE((array_agg(label ORDER BY created_at DESC) FILTER (WHERE scope = $3))[1], '')
+	FROM tokens
+	WHERE user_id = $1 AND scope = ANY($2)
+	GROUP BY family_id
+	HAVING MAX(expiry) FILTER (WHERE rotated_at IS NULL) > CURRENT_TIMESTAMP
+	ORDER BY COALESCE(MAX(last_used_at), MIN(created_at)) DESC
+	`
+	rows, err := t.db.QueryContext(ctx, query, userID, []string{tokens.ScopeAuth, tokens.ScopeRefresh}, tokens.ScopeRefresh)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []Session{}
+	for rows.Next() {
+		var session Session
+		err = rows.Scan(
+			&session.ID,
+			&session.CreatedAt,
+			&session.LastUsedAt,
+			&session.ExpiresAt,
+			&session.UserAgent,
+			&session.IP,
+			&session.Label,
+		)
+		if err != nil {
+			return nil, err
+		}
+		session.Current = session.ID == currentSessionID
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+
+// DeleteSession revokes every token of one session of the user.
+func (t *PostgresTokenStore) DeleteSession(ctx context.Context, userID int, sessionID int64) error {
+	result, err := t.db.ExecContext(ctx, `DELETE FROM tokens WHERE user_id = $1 AND family_id = $2`, userID, sessionID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/shiponcs/femProject/internal/tokens"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// insertAccessToken stores an opaque access token for a session, the way
+// the stateful access token backend does.
+func insertAccessToken(t *testing.T, tokenStore *PostgresTokenStore, userID int, sessionID int64) *tokens.Token {
+	t.Helper()
+
+	token, err := tokens.GenerateToken(userID, time.Minute, tokens.ScopeAuth)
+	require.NoError(t, err)
+	token.FamilyID = sessionID
+	require.NoError(t, tokenStore.Insert(context.Background(), token))
+	return token
+}
+
+func TestRotateRefreshToken(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	userID := createTestUser(t, db)
+	tokenStore := NewPostgresTokenStore(db)
+	userStore := NewPostgresUserStore(db, bcrypt.MinCost)
+
+	refresh, err := tokenStore.CreateSession(context.Background(), userID, time.Hour, SessionInfo{Label: "laptop"})
+	require.NoError(t, err)
+	access := insertAccessToken(t, tokenStore, userID, refresh.FamilyID)
+
+	newRefresh, err := tokenStore.RotateRefreshToken(context.Background(), refresh.Plaintext, time.Hour, SessionInfo{})
+	require.NoError(t, err)
+	assert.Equal(t, refresh.FamilyID, newRefresh.FamilyID)
+	newAccess := insertAccessToken(t, tokenStore, userID, newRefresh.FamilyID)
+
+	_, err = tokenStore.RotateRefreshToken(context.Background(), "not-a-token", time.Hour, SessionInfo{})
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	// replaying the first refresh token revokes the whole family
+	_, err = tokenStore.RotateRefreshToken(context.Background(), refresh.Plaintext, time.Hour, SessionInfo{})
+	assert.ErrorIs(t, err, ErrTokenReused)
+	var reused *TokenReusedError
+	require.ErrorAs(t, err, &reused)
+	assert.Equal(t, refresh.FamilyID, reused.SessionID)
+
+	for _, plaintext := range []string{access.Plaintext, newAccess.Plaintext} {
+		user, err := userStore.GetUserToken(context.Background(), tokens.ScopeAuth, plaintext)
+		require.NoError(t, err)
+		assert.Nil(t, user)
+	}
+	_, err = tokenStore.RotateRefreshToken(context.Background(), newRefresh.Plaintext, time.Hour, SessionInfo{})
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestSessions(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	userID := createTestUser(t, db)
+	tokenStore := NewPostgresTokenStore(db)
+	userStore := NewPostgresUserStore(db, bcrypt.MinCost)
+
+	_, err := db.Exec(`DELETE FROM tokens WHERE user_id = $1`, userID)
+	require.NoError(t, err)
+
+	laptop, err := tokenStore.CreateSession(context.Background(), userID, time.Hour, SessionInfo{UserAgent: "curl/8.0", IP: "10.0.0.1", Label: "laptop"})
+	require.NoError(t, err)
+	phone, err := tokenStore.CreateSession(context.Background(), userID, time.Hour, SessionInfo{Label: "phone"})
+	require.NoError(t, err)
+	access := insertAccessToken(t, tokenStore, userID, laptop.FamilyID)
+
+	user, err := userStore.GetUserToken(context.Background(), tokens.ScopeAuth, access.Plaintext)
+	require.NoError(t, err)
+	require.NotNil(t, user)
+	assert.Equal(t, laptop.FamilyID, user.SessionID)
+
+	sessions, err := tokenStore.ListSessions(context.Background(), userID, user.SessionID)
+	require.NoError(t, err)
+	require.Len(t, sessions, 2)
+	for _, session := range sessions {
+		if session.ID == laptop.FamilyID {
+			assert.True(t, session.Current)
+			assert.Equal(t, "laptop", session.Label)
+			assert.Equal(t, "10.0.0.1", session.IP)
+			assert.NotNil(t, session.LastUsedAt)
+		} else {
+			assert.False(t, session.Current)
+		}
+	}
+
+	require.NoError(t, tokenStore.DeleteSession(context.Background(), userID, phone.FamilyID))
+	assert.ErrorIs(t, tokenStore.DeleteSession(context.Background(), userID, phone.FamilyID), sql.ErrNoRows)
+
+	sessions, err = tokenStore.ListSessions(context.Background(), userID, 0)
+	require.NoError(t, err)
+	assert.Len(t, sessions, 1)
+}
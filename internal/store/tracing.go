@@ -0,0 +1,165 @@
+package store
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// The database connections are wrapped so every SQL statement run with the
+// context of a traced request is a child span of it. Statements run outside
+// of a trace, like the migrations, aren't traced.
+
+var tracer = otel.Tracer("github.com/shiponcs/femProject/internal/store")
+
+// startSpan starts the span of query, ok is false when ctx isn't traced.
+func startSpan(ctx context.Context, query string) (context.Context, trace.Span, bool) {
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		return ctx, nil, false
+	}
+
+	operation := "QUERY"
+	if fields := strings.Fields(query); len(fields) > 0 {
+		operation = strings.ToUpper(fields[0])
+	}
+	ctx, span := tracer.Start(ctx, operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemPostgreSQL,
+			semconv.DBOperationName(operation),
+			semconv.DBQueryText(strings.TrimSpace(query)),
+		),
+	)
+	return ctx, span, true
+}
+
+func endSpan(span trace.Span, err error) {
+	if err != nil && !errors.Is(err, driver.ErrSkip) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+type tracedConnector struct {
+	driver.Connector
+}
+
+func (c tracedConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &tracedConn{Conn: conn}, nil
+}
+
+// tracedConn forwards the optional interfaces of database/sql/driver to the
+// pgx connection, tracing the statements on the way.
+type tracedConn struct {
+	driver.Conn
+}
+
+func (c *tracedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	execer, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+
+	ctx, span, traced := startSpan(ctx, query)
+	result, err := execer.ExecContext(ctx, query, args)
+	if traced {
+		endSpan(span, err)
+	}
+	return result, err
+}
+
+// QueryContext spans end once the query returns, not when the rows are read.
+func (c *tracedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	queryer, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+
+	ctx, span, traced := startSpan(ctx, query)
+	rows, err := queryer.QueryContext(ctx, query, args)
+	if traced {
+		endSpan(span, err)
+	}
+	return rows, err
+}
+
+func (c *tracedConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	if preparer, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		return preparer.PrepareContext(ctx, query)
+	}
+	return c.Conn.Prepare(query)
+}
+
+func (c *tracedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	beginner, ok := c.Conn.(driver.ConnBeginTx)
+	if !ok {
+		return nil, errors.New("store: driver doesn't support BeginTx")
+	}
+
+	spanCtx, span, traced := startSpan(ctx, "BEGIN")
+	tx, err := beginner.BeginTx(spanCtx, opts)
+	if traced {
+		endSpan(span, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &tracedTx{Tx: tx, ctx: ctx}, nil
+}
+
+func (c *tracedConn) Ping(ctx context.Context) error {
+	if pinger, ok := c.Conn.(driver.Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *tracedConn) ResetSession(ctx context.Context) error {
+	if resetter, ok := c.Conn.(driver.SessionResetter); ok {
+		return resetter.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *tracedConn) CheckNamedValue(value *driver.NamedValue) error {
+	if checker, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(value)
+	}
+	return driver.ErrSkip
+}
+
+// tracedTx keeps the context the transaction was started with, Commit and
+// Rollback don't get one.
+type tracedTx struct {
+	driver.Tx
+	ctx context.Context
+}
+
+func (tx *tracedTx) Commit() error {
+	_, span, traced := startSpan(tx.ctx, "COMMIT")
+	err := tx.Tx.Commit()
+	if traced {
+		endSpan(span, err)
+	}
+	return err
+}
+
+func (tx *tracedTx) Rollback() error {
+	_, span, traced := startSpan(tx.ctx, "ROLLBACK")
+	err := tx.Tx.Rollback()
+	if traced {
+		endSpan(span, err)
+	}
+	return err
+}
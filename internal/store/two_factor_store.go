@@ -0,0 +1,189 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/shiponcs/femProject/internal/tokens"
+)
+
+var ErrTwoFactorEnabled = errors.New("two-factor authentication is already enabled")
+
+// TwoFactor is the TOTP enrollment of a user. It only protects logins once
+// Enabled, i.e. after the user confirmed a first code.
+type TwoFactor struct {
+	UserID  int
+	Secret  string
+	Enabled bool
+}
+
+type PostgresTwoFactorStore struct {
+	db *sql.DB
+}
+
+func NewPostgresTwoFactorStore(db *sql.DB) *PostgresTwoFactorStore {
+	return &PostgresTwoFactorStore{db: db}
+}
+
+type TwoFactorStore interface {
+	GetTwoFactor(userID int) (*TwoFactor, error)
+	StartEnrollment(userID int, secret string) error
+	ConfirmEnrollment(userID int, step int64, recoveryCodes []string) error
+	AcceptStep(userID int, step int64) (bool, error)
+	UseRecoveryCode(userID int, code string) (bool, error)
+	DisableTwoFactor(userID int) error
+}
+
+// GetTwoFactor returns nil when the user never started an enrollment.
+func (pg *PostgresTwoFactorStore) GetTwoFactor(userID int) (*TwoFactor, error) {
+	twoFactor := &TwoFactor{UserID: userID}
+
+	query := `
+	SELECT secret, confirmed_at IS NOT NULL
+	FROM user_two_factor
+	WHERE user_id = $1
+	`
+	err := pg.db.QueryRow(query, userID).Scan(&twoFactor.Secret, &twoFactor.Enabled)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return twoFactor, nil
+}
+
+// StartEnrollment stores a new unconfirmed secret, replacing an earlier
+// unconfirmed one. It fails with ErrTwoFactorEnabled once 2FA is enabled.
+func (pg *PostgresTwoFactorStore) StartEnrollment(userID int, secret string) error {
+	query := `
+	INSERT INTO user_two_factor (user_id, secret)
+	VALUES ($1, $2)
+	ON CONFLICT (user_id) DO UPDATE
+	SET secret = EXCLUDED.secret, last_step = 0, created_at = CURRENT_TIMESTAMP
+	WHERE user_two_factor.confirmed_at IS NULL
+	`
+	result, err := pg.db.Exec(query, userID, secret)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrTwoFactorEnabled
+	}
+	return nil
+}
+
+// ConfirmEnrollment enables 2FA and replaces the recovery codes of the user,
+// which are only kept hashed.
+func (pg *PostgresTwoFactorStore) ConfirmEnrollment(userID int, step int64, recoveryCodes []string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := pg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+	UPDATE user_two_factor
+	SET confirmed_at = CURRENT_TIMESTAMP, last_step = $2
+	WHERE user_id = $1 AND confirmed_at IS NULL
+	`
+	result, err := tx.ExecContext(ctx, query, userID, step)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrTwoFactorEnabled
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM two_factor_recovery_codes WHERE user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+
+	for _, code := range recoveryCodes {
+		_, err = tx.ExecContext(ctx,
+			`INSERT INTO two_factor_recovery_codes (user_id, hash) VALUES ($1, $2)`,
+			userID, tokens.Hash(code))
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// AcceptStep records step as used and reports false when it, or a later
+// step, was already used, so an intercepted code can't be replayed.
+func (pg *PostgresTwoFactorStore) AcceptStep(userID int, step int64) (bool, error) {
+	query := `
+	UPDATE user_two_factor
+	SET last_step = $2
+	WHERE user_id = $1 AND last_step < $2
+	`
+	result, err := pg.db.Exec(query, userID, step)
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rowsAffected == 1, nil
+}
+
+// UseRecoveryCode burns one of the recovery codes of the user and reports
+// whether code was a valid, unused one.
+func (pg *PostgresTwoFactorStore) UseRecoveryCode(userID int, code string) (bool, error) {
+	query := `
+	UPDATE two_factor_recovery_codes
+	SET used_at = CURRENT_TIMESTAMP
+	WHERE user_id = $1 AND hash = $2 AND used_at IS NULL
+	`
+	result, err := pg.db.Exec(query, userID, tokens.Hash(code))
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rowsAffected == 1, nil
+}
+
+func (pg *PostgresTwoFactorStore) DisableTwoFactor(userID int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := pg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM two_factor_recovery_codes WHERE user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `DELETE FROM user_two_factor WHERE user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,53 @@
+package store
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTwoFactorEnrollment(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	userID := createTestUser(t, db)
+	store := NewPostgresTwoFactorStore(db)
+	require.NoError(t, store.DisableTwoFactor(userID))
+
+	twoFactor, err := store.GetTwoFactor(userID)
+	require.NoError(t, err)
+	assert.Nil(t, twoFactor)
+
+	require.NoError(t, store.StartEnrollment(userID, "FIRSTSECRET"))
+	require.NoError(t, store.StartEnrollment(userID, "SECONDSECRET"))
+
+	twoFactor, err = store.GetTwoFactor(userID)
+	require.NoError(t, err)
+	assert.Equal(t, "SECONDSECRET", twoFactor.Secret)
+	assert.False(t, twoFactor.Enabled)
+
+	require.NoError(t, store.ConfirmEnrollment(userID, 100, []string{"aaaaabbbbb", "cccccddddd"}))
+	assert.ErrorIs(t, store.StartEnrollment(userID, "THIRDSECRET"), ErrTwoFactorEnabled)
+
+	// steps can't be replayed
+	ok, err := store.AcceptStep(userID, 100)
+	require.NoError(t, err)
+	assert.False(t, ok)
+	ok, err = store.AcceptStep(userID, 101)
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	// recovery codes work once
+	ok, err = store.UseRecoveryCode(userID, "aaaaabbbbb")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = store.UseRecoveryCode(userID, "aaaaabbbbb")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	require.NoError(t, store.DisableTwoFactor(userID))
+	twoFactor, err = store.GetTwoFactor(userID)
+	require.NoError(t, err)
+	assert.Nil(t, twoFactor)
+}
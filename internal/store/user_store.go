@@ -1,10 +1,12 @@
 package store
 
 import (
+	"context"
 	"crypto/sha256"
 	"database/sql"
 	"errors"
-	"fmt"
+	"log/slog"
+	"sync"
 	"time"
 
 	"golang.org/x/crypto/bcrypt"
@@ -15,8 +17,8 @@ type password struct {
 	hash      []byte
 }
 
-func (p *password) Set(plainTextPassword string) error {
-	hash, err := bcrypt.GenerateFromPassword([]byte(plainTextPassword), 12)
+func (p *password) set(plainTextPassword string, cost int) error {
+	hash, err := bcrypt.GenerateFromPassword([]byte(plainTextPassword), cost)
 	if err != nil {
 		return err
 	}
@@ -45,10 +47,27 @@ type User struct {
 	Email        string    `json:"emai"`
 	PasswordHash password  `json:"-"`
 	Bio          string    `json:"json"`
+	Activated    bool      `json:"activated"`
+	Role         string    `json:"role"`
 	CreatedAt    time.Time `json:"created_at"`
 	UpdatedAt    time.Time `json:"updated_at"`
+	// SessionID is the token family the user authenticated with, set by
+	// GetUserToken.
+	SessionID int64 `json:"-"`
 }
 
+// Roles a user can have. Every user starts out as RoleUser, admins promote
+// others through the admin endpoints.
+const (
+	RoleUser  = "user"
+	RoleCoach = "coach"
+	RoleAdmin = "admin"
+)
+
+var Roles = []string{RoleUser, RoleCoach, RoleAdmin}
+
+var ErrUnknownRole = errors.New("unknown role")
+
 var AnonymousUser = &User{}
 
 func (u *User) IsAnonymous() bool {
@@ -57,28 +76,58 @@ func (u *User) IsAnonymous() bool {
 
 type PostgresUserStore struct {
 	db *sql.DB
+	// passwordCost is the bcrypt cost of new password hashes, existing
+	// hashes keep the cost they were made with.
+	passwordCost int
+
+	dummyHashOnce sync.Once
+	dummyHash     []byte
 }
 
-func NewPostgresUserStore(db *sql.DB) *PostgresUserStore {
+func NewPostgresUserStore(db *sql.DB, passwordCost int) *PostgresUserStore {
 	return &PostgresUserStore{
-		db: db,
+		db:           db,
+		passwordCost: passwordCost,
 	}
 }
 
 type UserStore interface {
-	CreateUser(*User) error
-	GetUserByusername(username string) (*User, error)
-	UpdateUser(*User) error
-	GetUserToken(scope, plainTextPassword string) (*User, error)
+	CreateUser(ctx context.Context, user *User) error
+	GetUserByusername(ctx context.Context, username string) (*User, error)
+	GetUserByID(ctx context.Context, id int) (*User, error)
+	GetUserByEmail(ctx context.Context, email string) (*User, error)
+	UpdateUser(ctx context.Context, user *User) error
+	UpdatePassword(ctx context.Context, user *User) error
+	GetUserToken(ctx context.Context, scope, plainTextPassword string) (*User, error)
+	ListUsers(ctx context.Context) ([]*User, error)
+	UpdateRole(ctx context.Context, userID int, role string) error
+	DeleteUser(ctx context.Context, userID int) error
+	SetPassword(user *User, plainTextPassword string) error
+	SimulatePasswordCheck(plainTextPassword string)
+}
+
+// SetPassword hashes plainTextPassword into user.PasswordHash, it is saved
+// with CreateUser or UpdatePassword.
+func (s *PostgresUserStore) SetPassword(user *User, plainTextPassword string) error {
+	return user.PasswordHash.set(plainTextPassword, s.passwordCost)
+}
+
+// SimulatePasswordCheck costs as much as checking a password, so logins
+// with an unknown username can't be told apart by how long they take.
+func (s *PostgresUserStore) SimulatePasswordCheck(plainTextPassword string) {
+	s.dummyHashOnce.Do(func() {
+		s.dummyHash, _ = bcrypt.GenerateFromPassword([]byte("not a real password"), s.passwordCost)
+	})
+	bcrypt.CompareHashAndPassword(s.dummyHash, []byte(plainTextPassword))
 }
 
-func (s *PostgresUserStore) CreateUser(user *User) error {
+func (s *PostgresUserStore) CreateUser(ctx context.Context, user *User) error {
 	query := `
 	INSERT INTO users (username, email, password_hash, bio)
 	VALUES ($1, $2, $3, $4)
-	RETURNING id, created_at, updated_at
+	RETURNING id, activated, role, created_at, updated_at
 	`
-	err := s.db.QueryRow(query, user.Username, user.Email, user.PasswordHash.hash, user.Bio).Scan(&user.ID, &user.CreatedAt, &user.UpdatedAt)
+	err := s.db.QueryRowContext(ctx, query, user.Username, user.Email, user.PasswordHash.hash, user.Bio).Scan(&user.ID, &user.Activated, &user.Role, &user.CreatedAt, &user.UpdatedAt)
 	if err != nil {
 		return err
 	}
@@ -86,27 +135,61 @@ func (s *PostgresUserStore) CreateUser(user *User) error {
 	return nil
 }
 
-func (s *PostgresUserStore) GetUserByusername(username string) (*User, error) {
+func (s *PostgresUserStore) GetUserByusername(ctx context.Context, username string) (*User, error) {
 	user := &User{}
 
 	query := `
-	SELECT id, username, email, password_hash, bio, created_at, updated_at
+	SELECT id, username, email, password_hash, bio, activated, role, created_at, updated_at
 	FROM users
 	WHERE username = $1
 	`
 
-	err := s.db.QueryRow(query, username).Scan(
+	err := s.db.QueryRowContext(ctx, query, username).Scan(
+		&user.ID,
+		&user.Username,
+		&user.Email,
+		&user.PasswordHash.hash,
+		&user.Bio,
+		&user.Activated,
+		&user.Role,
+		&user.CreatedAt,
+		&user.UpdatedAt,
+	)
+
+	if err == sql.ErrNoRows {
+		slog.DebugContext(ctx, "no user with this username", "username", username)
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+func (s *PostgresUserStore) GetUserByID(ctx context.Context, id int) (*User, error) {
+	user := &User{}
+
+	query := `
+	SELECT id, username, email, password_hash, bio, activated, role, created_at, updated_at
+	FROM users
+	WHERE id = $1
+	`
+
+	err := s.db.QueryRowContext(ctx, query, id).Scan(
 		&user.ID,
 		&user.Username,
 		&user.Email,
 		&user.PasswordHash.hash,
 		&user.Bio,
+		&user.Activated,
+		&user.Role,
 		&user.CreatedAt,
 		&user.UpdatedAt,
 	)
 
 	if err == sql.ErrNoRows {
-		fmt.Println(username)
 		return nil, nil
 	}
 
@@ -117,15 +200,47 @@ func (s *PostgresUserStore) GetUserByusername(username string) (*User, error) {
 	return user, nil
 }
 
-func (s *PostgresUserStore) UpdateUser(user *User) error {
+func (s *PostgresUserStore) GetUserByEmail(ctx context.Context, email string) (*User, error) {
+	user := &User{}
+
+	query := `
+	SELECT id, username, email, password_hash, bio, activated, role, created_at, updated_at
+	FROM users
+	WHERE lower(email) = lower($1)
+	`
+
+	err := s.db.QueryRowContext(ctx, query, email).Scan(
+		&user.ID,
+		&user.Username,
+		&user.Email,
+		&user.PasswordHash.hash,
+		&user.Bio,
+		&user.Activated,
+		&user.Role,
+		&user.CreatedAt,
+		&user.UpdatedAt,
+	)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+func (s *PostgresUserStore) UpdateUser(ctx context.Context, user *User) error {
 	query := `
 	UPDATE users 
-	SET username = $1, email = $2, bio = $3, updated_at = CURRENT_TIMESTAMP
-	WHERE id = $4
+	SET username = $1, email = $2, bio = $3, activated = $4, updated_at = CURRENT_TIMESTAMP
+	WHERE id = $5
 	RETURNING updated_at
 	`
 
-	result, err := s.db.Exec(query, user.Username, user.Email, user.Bio, user.ID)
+	result, err := s.db.ExecContext(ctx, query, user.Username, user.Email, user.Bio, user.Activated, user.ID)
 	if err != nil {
 		return err
 	}
@@ -142,25 +257,52 @@ func (s *PostgresUserStore) UpdateUser(user *User) error {
 	return nil
 }
 
-func (s *PostgresUserStore) GetUserToken(scope, plainTextPassword string) (*User, error) {
+func (s *PostgresUserStore) UpdatePassword(ctx context.Context, user *User) error {
+	query := `
+	UPDATE users
+	SET password_hash = $1, updated_at = CURRENT_TIMESTAMP
+	WHERE id = $2
+	RETURNING updated_at
+	`
+
+	err := s.db.QueryRowContext(ctx, query, user.PasswordHash.hash, user.ID).Scan(&user.UpdatedAt)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *PostgresUserStore) GetUserToken(ctx context.Context, scope, plainTextPassword string) (*User, error) {
 	tokenHash := sha256.Sum256([]byte(plainTextPassword))
 
+	// last_used_at is refreshed in the same round trip, at most once a
+	// minute per token so busy clients don't turn every read into a write
 	query := `
-	SELECT u.id, u.username, u.email, u.password_hash, u.bio, u.created_at, u.updated_at
+	WITH touched AS (
+		UPDATE tokens
+		SET last_used_at = CURRENT_TIMESTAMP
+		WHERE hash = $1 AND scope = $2 AND expiry > $3
+		  AND (last_used_at IS NULL OR last_used_at < CURRENT_TIMESTAMP - INTERVAL '1 minute')
+	)
+	SELECT u.id, u.username, u.email, u.password_hash, u.bio, u.activated, u.role, u.created_at, u.updated_at, t.family_id
 	FROM users u
 	INNER JOIN tokens t ON t.user_id = u.id
 	WHERE t.hash = $1 AND t.scope = $2 AND t.expiry > $3
 	`
 	user := &User{}
 
-	err := s.db.QueryRow(query, tokenHash[:], scope, time.Now()).Scan(
+	err := s.db.QueryRowContext(ctx, query, tokenHash[:], scope, time.Now()).Scan(
 		&user.ID,
 		&user.Username,
 		&user.Email,
 		&user.PasswordHash.hash,
 		&user.Bio,
+		&user.Activated,
+		&user.Role,
 		&user.CreatedAt,
 		&user.UpdatedAt,
+		&user.SessionID,
 	)
 
 	if err == sql.ErrNoRows {
@@ -173,3 +315,91 @@ func (s *PostgresUserStore) GetUserToken(scope, plainTextPassword string) (*User
 
 	return user, nil
 }
+
+func (s *PostgresUserStore) ListUsers(ctx context.Context) ([]*User, error) {
+	query := `
+	SELECT id, username, email, password_hash, bio, activated, role, created_at, updated_at
+	FROM users
+	ORDER BY id
+	`
+
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []*User{}
+	for rows.Next() {
+		user := &User{}
+		err = rows.Scan(
+			&user.ID,
+			&user.Username,
+			&user.Email,
+			&user.PasswordHash.hash,
+			&user.Bio,
+			&user.Activated,
+			&user.Role,
+			&user.CreatedAt,
+			&user.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+func (s *PostgresUserStore) UpdateRole(ctx context.Context, userID int, role string) error {
+	known := false
+	for _, r := range Roles {
+		if r == role {
+			known = true
+		}
+	}
+	if !known {
+		return ErrUnknownRole
+	}
+
+	query := `
+	UPDATE users
+	SET role = $1, updated_at = CURRENT_TIMESTAMP
+	WHERE id = $2
+	`
+
+	result, err := s.db.ExecContext(ctx, query, role, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// DeleteUser removes the user along with everything they own.
+func (s *PostgresUserStore) DeleteUser(ctx context.Context, userID int) error {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM users WHERE id = $1`, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
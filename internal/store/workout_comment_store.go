@@ -0,0 +1,70 @@
+package store
+
+import (
+	"database/sql"
+	"time"
+)
+
+type WorkoutComment struct {
+	ID        int64     `json:"id"`
+	WorkoutID int64     `json:"workout_id"`
+	UserID    int       `json:"user_id"`
+	Username  string    `json:"username"`
+	Body      string    `json:"body"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type PostgresWorkoutCommentStore struct {
+	db *sql.DB
+}
+
+func NewPostgresWorkoutCommentStore(db *sql.DB) *PostgresWorkoutCommentStore {
+	return &PostgresWorkoutCommentStore{db: db}
+}
+
+type WorkoutCommentStore interface {
+	CreateComment(comment *WorkoutComment) error
+	ListComments(workoutID int64) ([]WorkoutComment, error)
+}
+
+func (pg *PostgresWorkoutCommentStore) CreateComment(comment *WorkoutComment) error {
+	query := `
+	WITH inserted AS (
+		INSERT INTO workout_comments (workout_id, user_id, body)
+		VALUES ($1, $2, $3)
+		RETURNING id, user_id, created_at
+	)
+	SELECT i.id, u.username, i.created_at
+	FROM inserted i
+	INNER JOIN users u ON u.id = i.user_id
+	`
+
+	return pg.db.QueryRow(query, comment.WorkoutID, comment.UserID, comment.Body).Scan(&comment.ID, &comment.Username, &comment.CreatedAt)
+}
+
+func (pg *PostgresWorkoutCommentStore) ListComments(workoutID int64) ([]WorkoutComment, error) {
+	query := `
+	SELECT c.id, c.workout_id, c.user_id, u.username, c.body, c.created_at
+	FROM workout_comments c
+	INNER JOIN users u ON u.id = c.user_id
+	WHERE c.workout_id = $1
+	ORDER BY c.created_at, c.id
+	`
+
+	rows, err := pg.db.Query(query, workoutID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	comments := []WorkoutComment{}
+	for rows.Next() {
+		var comment WorkoutComment
+		err = rows.Scan(&comment.ID, &comment.WorkoutID, &comment.UserID, &comment.Username, &comment.Body, &comment.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		comments = append(comments, comment)
+	}
+	return comments, rows.Err()
+}
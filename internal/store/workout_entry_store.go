@@ -0,0 +1,281 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+func insertWorkoutEntry(ctx context.Context, tx *sql.Tx, workoutID int64, entry *WorkoutEntry) error {
+	entry.DeriveAggregates()
+
+	err := resolveExercise(ctx, tx, &entry.ExerciseID, &entry.ExerciseName)
+	if err != nil {
+		return err
+	}
+
+	err = assignEntryGroup(ctx, tx, workoutID, entry)
+	if err != nil {
+		return err
+	}
+
+	query := `
+	INSERT INTO workout_entries (workout_id, exercise_id, exercise_name, sets, reps, duration_seconds, weight, notes, order_index, group_id)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+	RETURNING id
+	`
+	err = tx.QueryRowContext(ctx, query,
+		workoutID,
+		entry.ExerciseID,
+		entry.ExerciseName,
+		entry.Sets,
+		entry.Reps,
+		entry.DurationSeconds,
+		entry.Weight,
+		entry.Notes,
+		entry.OrderIndex,
+		entry.groupID(),
+	).Scan(&entry.ID)
+	if err != nil {
+		return err
+	}
+
+	return replaceWorkoutSets(ctx, tx, entry)
+}
+
+func updateWorkoutEntry(ctx context.Context, tx *sql.Tx, workoutID int64, entry *WorkoutEntry) error {
+	entry.DeriveAggregates()
+
+	err := resolveExercise(ctx, tx, &entry.ExerciseID, &entry.ExerciseName)
+	if err != nil {
+		return err
+	}
+
+	err = assignEntryGroup(ctx, tx, workoutID, entry)
+	if err != nil {
+		return err
+	}
+
+	query := `
+	UPDATE workout_entries
+	SET exercise_id = $1, exercise_name = $2, sets = $3, reps = $4, duration_seconds = $5, weight = $6, notes = $7, order_index = $8, group_id = $9
+	WHERE id = $10 AND workout_id = $11
+	`
+	result, err := tx.ExecContext(ctx, query,
+		entry.ExerciseID,
+		entry.ExerciseName,
+		entry.Sets,
+		entry.Reps,
+		entry.DurationSeconds,
+		entry.Weight,
+		entry.Notes,
+		entry.OrderIndex,
+		entry.groupID(),
+		entry.ID,
+		workoutID,
+	)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return replaceWorkoutSets(ctx, tx, entry)
+}
+
+// bumpWorkoutVersion is the optimistic concurrency check shared by every
+// entry level change: it fails with ErrEditConflict when the caller's view
+// of the workout is stale. It also returns the owner of the workout.
+func bumpWorkoutVersion(ctx context.Context, tx *sql.Tx, workoutID int64, version int) (int, int, error) {
+	query := `
+	UPDATE workouts
+	SET version = version + 1, updated_at = CURRENT_TIMESTAMP
+	WHERE id = $1 AND version = $2
+	RETURNING version, user_id
+	`
+	var newVersion, userID int
+	err := tx.QueryRowContext(ctx, query, workoutID, version).Scan(&newVersion, &userID)
+	if err == sql.ErrNoRows {
+		return 0, 0, ErrEditConflict
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+	return newVersion, userID, nil
+}
+
+func (pg *PostgresWorkoutStore) CreateWorkoutEntry(ctx context.Context, workoutID int64, version int, entry *WorkoutEntry) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	tx, err := pg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	newVersion, userID, err := bumpWorkoutVersion(ctx, tx, workoutID, version)
+	if err != nil {
+		return 0, err
+	}
+
+	exercisesBefore, err := workoutExerciseIDs(ctx, tx, workoutID)
+	if err != nil {
+		return 0, err
+	}
+
+	err = insertWorkoutEntry(ctx, tx, workoutID, entry)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = refreshPersonalRecords(ctx, tx, userID, workoutID, exercisesBefore)
+	if err != nil {
+		return 0, err
+	}
+
+	err = finalizeEntryGroups(ctx, tx, workoutID)
+	if err != nil {
+		return 0, err
+	}
+
+	return newVersion, tx.Commit()
+}
+
+func (pg *PostgresWorkoutStore) UpdateWorkoutEntry(ctx context.Context, workoutID int64, version int, entry *WorkoutEntry) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	tx, err := pg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	newVersion, userID, err := bumpWorkoutVersion(ctx, tx, workoutID, version)
+	if err != nil {
+		return 0, err
+	}
+
+	exercisesBefore, err := workoutExerciseIDs(ctx, tx, workoutID)
+	if err != nil {
+		return 0, err
+	}
+
+	err = updateWorkoutEntry(ctx, tx, workoutID, entry)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = refreshPersonalRecords(ctx, tx, userID, workoutID, exercisesBefore)
+	if err != nil {
+		return 0, err
+	}
+
+	err = finalizeEntryGroups(ctx, tx, workoutID)
+	if err != nil {
+		return 0, err
+	}
+
+	return newVersion, tx.Commit()
+}
+
+func (pg *PostgresWorkoutStore) DeleteWorkoutEntry(ctx context.Context, workoutID, entryID int64, version int) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	tx, err := pg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	newVersion, userID, err := bumpWorkoutVersion(ctx, tx, workoutID, version)
+	if err != nil {
+		return 0, err
+	}
+
+	exercisesBefore, err := workoutExerciseIDs(ctx, tx, workoutID)
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := tx.ExecContext(ctx, `DELETE FROM workout_entries WHERE id = $1 AND workout_id = $2`, entryID, workoutID)
+	if err != nil {
+		return 0, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	if rowsAffected == 0 {
+		return 0, sql.ErrNoRows
+	}
+
+	_, err = refreshPersonalRecords(ctx, tx, userID, workoutID, exercisesBefore)
+	if err != nil {
+		return 0, err
+	}
+
+	err = finalizeEntryGroups(ctx, tx, workoutID)
+	if err != nil {
+		return 0, err
+	}
+
+	return newVersion, tx.Commit()
+}
+
+// ReorderWorkoutEntries rewrites order_index so that entryIDs[i] ends up at
+// position i+1. entryIDs must list every entry of the workout exactly once.
+func (pg *PostgresWorkoutStore) ReorderWorkoutEntries(ctx context.Context, workoutID int64, version int, entryIDs []int64) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	tx, err := pg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	newVersion, _, err := bumpWorkoutVersion(ctx, tx, workoutID, version)
+	if err != nil {
+		return 0, err
+	}
+
+	var total int
+	err = tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM workout_entries WHERE workout_id = $1`, workoutID).Scan(&total)
+	if err != nil {
+		return 0, err
+	}
+
+	query := `
+	UPDATE workout_entries e
+	SET order_index = v.position
+	FROM unnest($1::bigint[]) WITH ORDINALITY AS v(id, position)
+	WHERE e.id = v.id AND e.workout_id = $2
+	`
+	result, err := tx.ExecContext(ctx, query, entryIDs, workoutID)
+	if err != nil {
+		return 0, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	if int(rowsAffected) != total || len(entryIDs) != total {
+		return 0, ErrInvalidEntryOrder
+	}
+
+	err = finalizeEntryGroups(ctx, tx, workoutID)
+	if err != nil {
+		return 0, err
+	}
+
+	return newVersion, tx.Commit()
+}
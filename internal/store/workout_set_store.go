@@ -0,0 +1,230 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+const (
+	SetTypeWarmup  = "warmup"
+	SetTypeWorking = "working"
+	SetTypeDrop    = "drop"
+	SetTypeFailure = "failure"
+)
+
+type WorkoutSet struct {
+	ID              int      `json:"id"`
+	SetNumber       int      `json:"set_number"`
+	Reps            *int     `json:"reps"`
+	DurationSeconds *int     `json:"duration_seconds"`
+	Weight          *float64 `json:"weight"`
+	RPE             *float64 `json:"rpe"`
+	SetType         string   `json:"set_type"`
+	Completed       bool     `json:"completed"`
+}
+
+// UnmarshalJSON defaults completed to true, most logged sets were done.
+func (s *WorkoutSet) UnmarshalJSON(data []byte) error {
+	type plainSet WorkoutSet
+	set := plainSet{Completed: true}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return err
+	}
+	*s = WorkoutSet(set)
+	return nil
+}
+
+// Validate checks a set the same way the workout_sets constraints do, so
+// callers can answer with a 400 instead of a database error.
+func (s *WorkoutSet) Validate() error {
+	if (s.Reps == nil) == (s.DurationSeconds == nil) {
+		return errors.New("exactly one of reps or duration_seconds is required")
+	}
+	switch s.SetType {
+	case "", SetTypeWarmup, SetTypeWorking, SetTypeDrop, SetTypeFailure:
+	default:
+		return errors.New("set_type must be one of warmup, working, drop or failure")
+	}
+	if s.RPE != nil && (*s.RPE < 1 || *s.RPE > 10) {
+		return errors.New("rpe must be between 1 and 10")
+	}
+	return nil
+}
+
+// ValidateSets validates every set of SetsDetail and checks that no two of
+// them share a set_number, sets without one are numbered by their position
+// like replaceWorkoutSets does.
+func (e *WorkoutEntry) ValidateSets() error {
+	numbers := make(map[int]bool, len(e.SetsDetail))
+	for i := range e.SetsDetail {
+		set := &e.SetsDetail[i]
+		if err := set.Validate(); err != nil {
+			return fmt.Errorf("sets_detail[%d]: %w", i, err)
+		}
+
+		number := set.SetNumber
+		if number == 0 {
+			number = i + 1
+		}
+		if numbers[number] {
+			return fmt.Errorf("sets_detail[%d]: set_number %d is used twice", i, number)
+		}
+		numbers[number] = true
+	}
+	return nil
+}
+
+// DeriveAggregates overwrites the legacy sets/reps/duration_seconds/weight
+// fields from SetsDetail so clients that only know the single triple keep
+// seeing sensible numbers: Sets counts the completed non-warmup sets, Reps,
+// DurationSeconds and Weight are the best among them. Warmups only count
+// when there is nothing else. Entries without sets are left alone.
+func (e *WorkoutEntry) DeriveAggregates() {
+	if len(e.SetsDetail) == 0 {
+		return
+	}
+
+	counted := make([]WorkoutSet, 0, len(e.SetsDetail))
+	for _, set := range e.SetsDetail {
+		if set.Completed && set.SetType != SetTypeWarmup {
+			counted = append(counted, set)
+		}
+	}
+	if len(counted) == 0 {
+		counted = e.SetsDetail
+	}
+
+	e.Sets = len(counted)
+	e.Reps, e.DurationSeconds, e.Weight = nil, nil, nil
+	for _, set := range counted {
+		e.Reps = maxIntPtr(e.Reps, set.Reps)
+		e.DurationSeconds = maxIntPtr(e.DurationSeconds, set.DurationSeconds)
+		if set.Weight != nil && (e.Weight == nil || *set.Weight > *e.Weight) {
+			weight := *set.Weight
+			e.Weight = &weight
+		}
+	}
+	// the entry itself must be either rep or time based
+	if e.Reps != nil {
+		e.DurationSeconds = nil
+	}
+}
+
+func maxIntPtr(current, candidate *int) *int {
+	if candidate == nil || (current != nil && *current >= *candidate) {
+		return current
+	}
+	value := *candidate
+	return &value
+}
+
+// replaceWorkoutSets swaps the sets of an entry for entry.SetsDetail. A nil
+// SetsDetail means the caller didn't send any and the stored sets are kept.
+func replaceWorkoutSets(ctx context.Context, tx *sql.Tx, entry *WorkoutEntry) error {
+	if entry.SetsDetail == nil {
+		return nil
+	}
+
+	_, err := tx.ExecContext(ctx, `DELETE FROM workout_sets WHERE entry_id = $1`, entry.ID)
+	if err != nil {
+		return err
+	}
+
+	query := `
+	INSERT INTO workout_sets (entry_id, set_number, reps, duration_seconds, weight, rpe, set_type, completed)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	RETURNING id
+	`
+	for i := range entry.SetsDetail {
+		set := &entry.SetsDetail[i]
+		if set.SetNumber == 0 {
+			set.SetNumber = i + 1
+		}
+		if set.SetType == "" {
+			set.SetType = SetTypeWorking
+		}
+
+		err = tx.QueryRowContext(ctx, query,
+			entry.ID,
+			set.SetNumber,
+			set.Reps,
+			set.DurationSeconds,
+			set.Weight,
+			set.RPE,
+			set.SetType,
+			set.Completed,
+		).Scan(&set.ID)
+		if err != nil {
+			return fmt.Errorf("set %d: %w", set.SetNumber, err)
+		}
+	}
+	return nil
+}
+
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// loadWorkoutSets fills SetsDetail of all given entries with one query.
+// Entries with sets get their aggregate fields derived from them again, an
+// update that left the sets out may have stored other numbers.
+func loadWorkoutSets(ctx context.Context, q queryer, entries []*WorkoutEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, 0, len(entries))
+	byID := make(map[int]*WorkoutEntry, len(entries))
+	for _, entry := range entries {
+		ids = append(ids, int64(entry.ID))
+		byID[entry.ID] = entry
+	}
+
+	query := `
+	SELECT entry_id, id, set_number, reps, duration_seconds, weight, rpe, set_type, completed
+	FROM workout_sets
+	WHERE entry_id = ANY($1)
+	ORDER BY entry_id, set_number
+	`
+	rows, err := q.QueryContext(ctx, query, ids)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var entryID int
+		var set WorkoutSet
+		err = rows.Scan(
+			&entryID,
+			&set.ID,
+			&set.SetNumber,
+			&set.Reps,
+			&set.DurationSeconds,
+			&set.Weight,
+			&set.RPE,
+			&set.SetType,
+			&set.Completed,
+		)
+		if err != nil {
+			return err
+		}
+		if entry, ok := byID[entryID]; ok {
+			entry.SetsDetail = append(entry.SetsDetail, set)
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if entry.SetsDetail == nil {
+			entry.SetsDetail = []WorkoutSet{}
+		}
+		entry.DeriveAggregates()
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeriveAggregates(t *testing.T) {
+	tests := []struct {
+		name         string
+		sets         []WorkoutSet
+		wantSets     int
+		wantReps     *int
+		wantDuration *int
+		wantWeight   *float64
+	}{
+		{
+			name: "pyramid ignores warmups and failed sets",
+			sets: []WorkoutSet{
+				{Reps: IntPtr(12), Weight: FloatPtr(40), SetType: SetTypeWarmup, Completed: true},
+				{Reps: IntPtr(10), Weight: FloatPtr(60), SetType: SetTypeWorking, Completed: true},
+				{Reps: IntPtr(8), Weight: FloatPtr(70), SetType: SetTypeWorking, Completed: true},
+				{Reps: IntPtr(6), Weight: FloatPtr(80), SetType: SetTypeWorking, Completed: true},
+				{Reps: IntPtr(2), Weight: FloatPtr(85), SetType: SetTypeFailure, Completed: false},
+			},
+			wantSets:   3,
+			wantReps:   IntPtr(10),
+			wantWeight: FloatPtr(80),
+		},
+		{
+			name: "only warmups still count",
+			sets: []WorkoutSet{
+				{Reps: IntPtr(15), SetType: SetTypeWarmup, Completed: true},
+			},
+			wantSets: 1,
+			wantReps: IntPtr(15),
+		},
+		{
+			name: "timed sets",
+			sets: []WorkoutSet{
+				{DurationSeconds: IntPtr(45), SetType: SetTypeWorking, Completed: true},
+				{DurationSeconds: IntPtr(60), SetType: SetTypeWorking, Completed: true},
+			},
+			wantSets:     2,
+			wantDuration: IntPtr(60),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry := WorkoutEntry{Sets: 99, Reps: IntPtr(99), SetsDetail: tt.sets}
+			entry.DeriveAggregates()
+
+			assert.Equal(t, tt.wantSets, entry.Sets)
+			assert.Equal(t, tt.wantReps, entry.Reps)
+			assert.Equal(t, tt.wantDuration, entry.DurationSeconds)
+			assert.Equal(t, tt.wantWeight, entry.Weight)
+		})
+	}
+}
+
+func TestValidateSets(t *testing.T) {
+	tests := []struct {
+		name    string
+		sets    []WorkoutSet
+		wantErr string
+	}{
+		{name: "numbered by position", sets: []WorkoutSet{{Reps: IntPtr(5)}, {Reps: IntPtr(5)}}},
+		{name: "explicit numbers", sets: []WorkoutSet{{SetNumber: 2, Reps: IntPtr(5)}, {SetNumber: 1, Reps: IntPtr(5)}}},
+		{
+			name:    "invalid set",
+			sets:    []WorkoutSet{{Reps: IntPtr(5)}, {}},
+			wantErr: "sets_detail[1]: exactly one of reps or duration_seconds is required",
+		},
+		{
+			name:    "duplicate number",
+			sets:    []WorkoutSet{{SetNumber: 1, Reps: IntPtr(5)}, {SetNumber: 1, Reps: IntPtr(5)}},
+			wantErr: "sets_detail[1]: set_number 1 is used twice",
+		},
+		{
+			name:    "explicit number taken by position",
+			sets:    []WorkoutSet{{SetNumber: 2, Reps: IntPtr(5)}, {Reps: IntPtr(5)}},
+			wantErr: "sets_detail[1]: set_number 2 is used twice",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry := WorkoutEntry{SetsDetail: tt.sets}
+			err := entry.ValidateSets()
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.EqualError(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestWorkoutSetDefaultsToCompleted(t *testing.T) {
+	var set WorkoutSet
+	require.NoError(t, json.Unmarshal([]byte(`{"reps": 5}`), &set))
+	assert.True(t, set.Completed)
+
+	require.NoError(t, json.Unmarshal([]byte(`{"reps": 5, "completed": false}`), &set))
+	assert.False(t, set.Completed)
+}
+
+func TestUpdateWorkoutEntryKeepsSets(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	ctx := context.Background()
+	store := NewPostgresWorkoutStore(db)
+	workout, err := store.CreateWorkout(ctx, &Workout{
+		UserID:          createTestUser(t, db),
+		Title:           "bench day",
+		DurationMinutes: 30,
+		Entries: []WorkoutEntry{
+			{
+				ExerciseName: "Bench Press",
+				SetsDetail: []WorkoutSet{
+					{Reps: IntPtr(8), Weight: FloatPtr(80), Completed: true},
+					{Reps: IntPtr(6), Weight: FloatPtr(85), Completed: true},
+				},
+			},
+		},
+	})
+	require.NoError(t, err)
+	workoutID := int64(workout.ID)
+	setIDs := []int{workout.Entries[0].SetsDetail[0].ID, workout.Entries[0].SetsDetail[1].ID}
+
+	// a PATCH of reps alone, the sets aren't sent
+	entry := workout.Entries[0]
+	entry.SetsDetail = nil
+	entry.Reps = IntPtr(12)
+	_, err = store.UpdateWorkoutEntry(ctx, workoutID, 1, &entry)
+	require.NoError(t, err)
+
+	// the stored sets win over the patched aggregate
+	retrieved, err := store.GetWorkoutByID(ctx, workoutID)
+	require.NoError(t, err)
+	require.Len(t, retrieved.Entries, 1)
+	assert.Equal(t, 8, *retrieved.Entries[0].Reps)
+	require.Len(t, retrieved.Entries[0].SetsDetail, 2)
+	assert.Equal(t, setIDs[0], retrieved.Entries[0].SetsDetail[0].ID)
+	assert.Equal(t, setIDs[1], retrieved.Entries[0].SetsDetail[1].ID)
+
+	// sending sets replaces them and derives the aggregates again
+	entry.SetsDetail = []WorkoutSet{{Reps: IntPtr(5), Weight: FloatPtr(90), Completed: true}}
+	_, err = store.UpdateWorkoutEntry(ctx, workoutID, 2, &entry)
+	require.NoError(t, err)
+
+	retrieved, err = store.GetWorkoutByID(ctx, workoutID)
+	require.NoError(t, err)
+	assert.Equal(t, 5, *retrieved.Entries[0].Reps)
+	assert.Equal(t, 1, retrieved.Entries[0].Sets)
+	require.Len(t, retrieved.Entries[0].SetsDetail, 1)
+}
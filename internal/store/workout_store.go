@@ -3,9 +3,15 @@ package store
 import (
 	"context"
 	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"sync"
+	"log/slog"
+	"strconv"
+	"strings"
 	"time"
+	"unicode/utf8"
 )
 
 type Workout struct {
@@ -15,19 +21,158 @@ type Workout struct {
 	Description     string         `json:"description"`
 	DurationMinutes int            `json:"duration_minutes"`
 	CaloriesBurned  int            `json:"calories_burned"`
+	PerformedAt     time.Time      `json:"performed_at"`
+	EndedAt         *time.Time     `json:"ended_at"`
 	Entries         []WorkoutEntry `json:"entries"`
 	Version         int            `json:"version"`
+	// PersonalRecords are the records this workout set or improved when it
+	// was created or updated, only set on those responses.
+	PersonalRecords []PersonalRecord `json:"new_personal_records,omitempty"`
 }
 
 type WorkoutEntry struct {
-	ID              int      `json:"id"`
-	ExerciseName    string   `json:"exercise_name"`
-	Sets            int      `json:"sets"`
-	Reps            *int     `json:"reps"`
-	DurationSeconds *int     `json:"duration_seconds"`
-	Weight          *float64 `json:"weight"`
-	Notes           string   `json:"notes"`
-	OrderIndex      int      `json:"order_index"`
+	ID              int          `json:"id"`
+	ExerciseID      int          `json:"exercise_id"`
+	ExerciseName    string       `json:"exercise_name"`
+	Sets            int          `json:"sets"`
+	Reps            *int         `json:"reps"`
+	DurationSeconds *int         `json:"duration_seconds"`
+	Weight          *float64     `json:"weight"`
+	Notes           string       `json:"notes"`
+	OrderIndex      int          `json:"order_index"`
+	Group           *EntryGroup  `json:"group"`
+	SetsDetail      []WorkoutSet `json:"sets_detail"`
+}
+
+func (e *WorkoutEntry) groupID() *int {
+	if e.Group == nil {
+		return nil
+	}
+	return &e.Group.ID
+}
+
+var (
+	ErrEditConflict      = errors.New("edit conflict")
+	ErrInvalidCursor     = errors.New("invalid cursor")
+	ErrInvalidSort       = errors.New("invalid sort option")
+	ErrInvalidEntryOrder = errors.New("entry order must list every entry of the workout exactly once")
+)
+
+const (
+	DefaultWorkoutListLimit = 20
+	MaxWorkoutListLimit     = 100
+)
+
+// WorkoutFilter narrows down ListWorkouts. Nil pointers and empty strings
+// mean "no filter". Sort is a column name optionally prefixed with "-" for
+// descending order, e.g. "-performed_at".
+type WorkoutFilter struct {
+	UserID          int
+	Title           string
+	MinDuration     *int
+	MaxDuration     *int
+	MinCalories     *int
+	MaxCalories     *int
+	CreatedAfter    *time.Time
+	CreatedBefore   *time.Time
+	PerformedAfter  *time.Time
+	PerformedBefore *time.Time
+	Sort            string
+	Cursor          string
+	Limit           int
+}
+
+type WorkoutPage struct {
+	Workouts   []*Workout `json:"workouts"`
+	NextCursor string     `json:"next_cursor,omitempty"`
+}
+
+type sortColumn struct {
+	column string
+	cast   string
+}
+
+// cursorValue renders the column as the text stored in a cursor. Timestamps
+// are written as RFC 3339 in UTC so they don't depend on the session's
+// DateStyle and can be parsed back by parseCursorValue.
+func (c sortColumn) cursorValue() string {
+	if c.cast == "timestamptz" {
+		return fmt.Sprintf(`to_char(%s AT TIME ZONE 'UTC', 'YYYY-MM-DD"T"HH24:MI:SS.US"Z"')`, c.column)
+	}
+	return c.column + "::text"
+}
+
+// parseCursorValue checks a cursor value against the type of the column so
+// a tampered cursor is rejected before it reaches the query.
+func (c sortColumn) parseCursorValue(value string) (interface{}, error) {
+	switch c.cast {
+	case "timestamptz":
+		t, err := time.Parse(time.RFC3339Nano, value)
+		if err != nil {
+			return nil, ErrInvalidCursor
+		}
+		return t, nil
+	case "integer":
+		n, err := strconv.ParseInt(value, 10, 32)
+		if err != nil {
+			return nil, ErrInvalidCursor
+		}
+		return n, nil
+	default:
+		if !utf8.ValidString(value) || strings.ContainsRune(value, 0) {
+			return nil, ErrInvalidCursor
+		}
+		return value, nil
+	}
+}
+
+var workoutSortColumns = map[string]sortColumn{
+	"created_at":       {column: "w.created_at", cast: "timestamptz"},
+	"performed_at":     {column: "w.performed_at", cast: "timestamptz"},
+	"title":            {column: "w.title", cast: "text"},
+	"duration_minutes": {column: "w.duration_minutes", cast: "integer"},
+	"calories_burned":  {column: "w.calories_burned", cast: "integer"},
+}
+
+// workoutCursor points right after the last row of a page. It carries the
+// sort it was produced for so it can't be replayed against another ordering.
+type workoutCursor struct {
+	Sort  string `json:"s"`
+	Value string `json:"v"`
+	ID    int    `json:"id"`
+
+	// value is Value parsed for the sort column
+	value interface{}
+}
+
+func encodeWorkoutCursor(c workoutCursor) string {
+	js, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(js)
+}
+
+// decodeWorkoutCursor only accepts cursors produced for sort whose value
+// parses as the type of the sort column.
+func decodeWorkoutCursor(s, sort string) (*workoutCursor, error) {
+	js, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var c workoutCursor
+	if err := json.Unmarshal(js, &c); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	if c.Sort != sort || c.ID <= 0 {
+		return nil, ErrInvalidCursor
+	}
+	sortCol, ok := workoutSortColumns[strings.TrimPrefix(sort, "-")]
+	if !ok {
+		return nil, ErrInvalidCursor
+	}
+	c.value, err = sortCol.parseCursorValue(c.Value)
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
 }
 
 type PostgresWorkoutStore struct {
@@ -39,15 +184,20 @@ func NewPostgresWorkoutStore(db *sql.DB) *PostgresWorkoutStore {
 }
 
 type WorkoutStore interface {
-	CreateWorkout(*Workout) (*Workout, error)
-	GetWorkoutByID(int64) (*Workout, error)
-	UpdateWorkout(*Workout) error
-	DeleteWorkoutByID(int64) error
-	GetWorkoutOwner(id int64) (int, error)
+	CreateWorkout(ctx context.Context, workout *Workout) (*Workout, error)
+	GetWorkoutByID(ctx context.Context, id int64) (*Workout, error)
+	UpdateWorkout(ctx context.Context, workout *Workout) error
+	DeleteWorkoutByID(ctx context.Context, id int64) error
+	GetWorkoutOwner(ctx context.Context, id int64) (int, error)
+	ListWorkouts(ctx context.Context, filter WorkoutFilter) (*WorkoutPage, error)
+	CreateWorkoutEntry(ctx context.Context, workoutID int64, version int, entry *WorkoutEntry) (int, error)
+	UpdateWorkoutEntry(ctx context.Context, workoutID int64, version int, entry *WorkoutEntry) (int, error)
+	DeleteWorkoutEntry(ctx context.Context, workoutID, entryID int64, version int) (int, error)
+	ReorderWorkoutEntries(ctx context.Context, workoutID int64, version int, entryIDs []int64) (int, error)
 }
 
-func (pg *PostgresWorkoutStore) CreateWorkout(workout *Workout) (*Workout, error) {
-	tx, err := pg.db.Begin()
+func (pg *PostgresWorkoutStore) CreateWorkout(ctx context.Context, workout *Workout) (*Workout, error) {
+	tx, err := pg.db.BeginTx(ctx, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -55,47 +205,38 @@ func (pg *PostgresWorkoutStore) CreateWorkout(workout *Workout) (*Workout, error
 
 	query :=
 		`
-  INSERT INTO workouts (user_id, title, description, duration_minutes, calories_burned)
-  VALUES ($1, $2, $3, $4, $5)
-  RETURNING id 
+  INSERT INTO workouts (user_id, title, description, duration_minutes, calories_burned, performed_at, ended_at)
+  VALUES ($1, $2, $3, $4, $5, COALESCE($6, CURRENT_TIMESTAMP), $7)
+  RETURNING id, performed_at
   `
 
-	err = tx.QueryRow(query, workout.UserID, workout.Title, workout.Description, workout.DurationMinutes, workout.CaloriesBurned).Scan(&workout.ID)
+	var performedAt *time.Time
+	if !workout.PerformedAt.IsZero() {
+		performedAt = &workout.PerformedAt
+	}
+	err = tx.QueryRowContext(ctx, query, workout.UserID, workout.Title, workout.Description, workout.DurationMinutes, workout.CaloriesBurned, performedAt, workout.EndedAt).Scan(&workout.ID, &workout.PerformedAt)
 	if err != nil {
 		return nil, err
 	}
 
-	// we can insert the entries concurrently
-	errCh := make(chan error, len(workout.Entries))
-	wg := sync.WaitGroup{}
-
-	for indx, entry := range workout.Entries {
-		wg.Add(1)
-
-		go func(entry WorkoutEntry) {
-			defer wg.Done()
-			query := `
-			INSERT INTO workout_entries (workout_id, exercise_name, sets, reps, duration_seconds, weight, notes, order_index)
-			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
-			RETURNING id
-			`
-			err = tx.QueryRow(query, workout.ID, entry.ExerciseName, entry.Sets, entry.Reps, entry.DurationSeconds, entry.Weight, entry.Notes, entry.OrderIndex).Scan(&workout.Entries[indx].ID)
-			if err != nil {
-				errCh <- err
-			}
-
-		}(entry)
-	}
-
-	wg.Wait()
-	close(errCh)
-
-	for err := range errCh {
+	// one at a time, a transaction runs on a single connection
+	for i := range workout.Entries {
+		err = insertWorkoutEntry(ctx, tx, int64(workout.ID), &workout.Entries[i])
 		if err != nil {
 			return nil, err
 		}
 	}
 
+	err = finalizeEntryGroups(ctx, tx, int64(workout.ID))
+	if err != nil {
+		return nil, err
+	}
+
+	workout.PersonalRecords, err = refreshPersonalRecords(ctx, tx, workout.UserID, int64(workout.ID), nil)
+	if err != nil {
+		return nil, err
+	}
+
 	err = tx.Commit()
 	if err != nil {
 		return nil, err
@@ -104,16 +245,16 @@ func (pg *PostgresWorkoutStore) CreateWorkout(workout *Workout) (*Workout, error
 	return workout, nil
 }
 
-func (pg *PostgresWorkoutStore) GetWorkoutByID(id int64) (*Workout, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func (pg *PostgresWorkoutStore) GetWorkoutByID(ctx context.Context, id int64) (*Workout, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 	workout := &Workout{}
 	query := `
-		SELECT id, title, description, duration_minutes, calories_burned, version
+		SELECT id, user_id, title, description, duration_minutes, calories_burned, performed_at, ended_at, version
 		FROM workouts
 		WHERE id = $1
 		`
-	err := pg.db.QueryRowContext(ctx, query, id).Scan(&workout.ID, &workout.Title, &workout.Description, &workout.DurationMinutes, &workout.CaloriesBurned, &workout.Version)
+	err := pg.db.QueryRowContext(ctx, query, id).Scan(&workout.ID, &workout.UserID, &workout.Title, &workout.Description, &workout.DurationMinutes, &workout.CaloriesBurned, &workout.PerformedAt, &workout.EndedAt, &workout.Version)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -124,10 +265,12 @@ func (pg *PostgresWorkoutStore) GetWorkoutByID(id int64) (*Workout, error) {
 
 	// lets get the entries
 	entryQuery := `
-		SELECT id, exercise_name, sets, reps, duration_seconds, weight, notes, order_index
-		FROM workout_entries
-		WHERE workout_id = $1
-		ORDER BY order_index
+		SELECT e.id, e.exercise_id, e.exercise_name, e.sets, e.reps, e.duration_seconds, e.weight, e.notes, e.order_index,
+		       g.id, g.label, g.group_type, g.rounds, g.rest_between_rounds_seconds
+		FROM workout_entries e
+		LEFT JOIN workout_entry_groups g ON g.id = e.group_id
+		WHERE e.workout_id = $1
+		ORDER BY e.order_index
 		`
 
 	rows, err := pg.db.QueryContext(ctx, entryQuery, id)
@@ -138,8 +281,10 @@ func (pg *PostgresWorkoutStore) GetWorkoutByID(id int64) (*Workout, error) {
 
 	for rows.Next() {
 		var entry WorkoutEntry
+		var group nullableEntryGroup
 		err = rows.Scan(
 			&entry.ID,
+			&entry.ExerciseID,
 			&entry.ExerciseName,
 			&entry.Sets,
 			&entry.Reps,
@@ -147,21 +292,39 @@ func (pg *PostgresWorkoutStore) GetWorkoutByID(id int64) (*Workout, error) {
 			&entry.Weight,
 			&entry.Notes,
 			&entry.OrderIndex,
+			&group.ID,
+			&group.Label,
+			&group.Type,
+			&group.Rounds,
+			&group.RestBetweenRoundsSeconds,
 		)
 		if err != nil {
 			return nil, err
 		}
+		entry.Group = group.get()
 		workout.Entries = append(workout.Entries, entry)
 	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	entries := make([]*WorkoutEntry, 0, len(workout.Entries))
+	for i := range workout.Entries {
+		entries = append(entries, &workout.Entries[i])
+	}
+	err = loadWorkoutSets(ctx, pg.db, entries)
+	if err != nil {
+		return nil, err
+	}
 
 	return workout, nil
 }
 
-func (pg *PostgresWorkoutStore) UpdateWorkout(workout *Workout) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func (pg *PostgresWorkoutStore) UpdateWorkout(ctx context.Context, workout *Workout) error {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
-	tx, err := pg.db.Begin()
+	tx, err := pg.db.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
@@ -169,81 +332,311 @@ func (pg *PostgresWorkoutStore) UpdateWorkout(workout *Workout) error {
 
 	query := `
   UPDATE workouts
-  SET title = $1, description = $2, duration_minutes = $3, calories_burned = $4, version = version + 1
-  WHERE id = $5 AND version = $6
-  RETURNING version
+  SET title = $1, description = $2, duration_minutes = $3, calories_burned = $4, performed_at = $5, ended_at = $6, version = version + 1
+  WHERE id = $7 AND version = $8
+  RETURNING version, user_id
   `
 	var newVersion int
-	err = tx.QueryRowContext(ctx, query, workout.Title, workout.Description, workout.DurationMinutes, workout.CaloriesBurned, workout.ID, workout.Version).Scan(&newVersion)
+	err = tx.QueryRowContext(ctx, query, workout.Title, workout.Description, workout.DurationMinutes, workout.CaloriesBurned, workout.PerformedAt, workout.EndedAt, workout.ID, workout.Version).Scan(&newVersion, &workout.UserID)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			fmt.Println("Here", workout.Title, workout.Description, workout.DurationMinutes, workout.CaloriesBurned, workout.ID, workout.Version)
-			return sql.ErrNoRows
+			slog.DebugContext(ctx, "workout not updated, it is missing or its version changed", "workout_id", workout.ID, "version", workout.Version)
+			return ErrEditConflict
 		}
 		return err
 	}
 
-	_, err = tx.Exec(`DELETE FROM workout_entries WHERE workout_id = $1`, workout.ID)
+	exercisesBefore, err := workoutExerciseIDs(ctx, tx, int64(workout.ID))
 	if err != nil {
 		return err
 	}
 
-	for _, entry := range workout.Entries {
-		query := `
-    INSERT INTO workout_entries (workout_id, exercise_name, sets, reps, duration_seconds, weight, notes, order_index)
-    VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
-    `
-
-		_, err := tx.ExecContext(ctx, query,
-			workout.ID,
-			entry.ExerciseName,
-			entry.Sets,
-			entry.Reps,
-			entry.DurationSeconds,
-			entry.Weight,
-			entry.Notes,
-			entry.OrderIndex,
-		)
+	// entries that carry an ID are updated in place so they keep their ID and
+	// created_at, new ones are inserted and the ones left out are removed
+	keepIDs := make([]int64, 0, len(workout.Entries))
+	for i := range workout.Entries {
+		entry := &workout.Entries[i]
+		if entry.ID != 0 {
+			err = updateWorkoutEntry(ctx, tx, int64(workout.ID), entry)
+			if err == nil {
+				keepIDs = append(keepIDs, int64(entry.ID))
+				continue
+			}
+			if err != sql.ErrNoRows {
+				return err
+			}
+		}
 
+		err = insertWorkoutEntry(ctx, tx, int64(workout.ID), entry)
 		if err != nil {
 			return err
 		}
+		keepIDs = append(keepIDs, int64(entry.ID))
 	}
 
-	return tx.Commit()
+	_, err = tx.ExecContext(ctx, `DELETE FROM workout_entries WHERE workout_id = $1 AND NOT (id = ANY($2))`, workout.ID, keepIDs)
+	if err != nil {
+		return err
+	}
+
+	err = finalizeEntryGroups(ctx, tx, int64(workout.ID))
+	if err != nil {
+		return err
+	}
+
+	workout.PersonalRecords, err = refreshPersonalRecords(ctx, tx, workout.UserID, int64(workout.ID), exercisesBefore)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	workout.Version = newVersion
+	return nil
 }
 
-func (pg *PostgresWorkoutStore) DeleteWorkoutByID(id int64) error {
+func (pg *PostgresWorkoutStore) DeleteWorkoutByID(ctx context.Context, id int64) error {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	tx, err := pg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	exercisesBefore, err := workoutExerciseIDs(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+
 	query := `
 	DELETE from workouts WHERE id = $1
+	RETURNING user_id
 	`
-	result, err := pg.db.Exec(query, id)
+	var userID int
+	err = tx.QueryRowContext(ctx, query, id).Scan(&userID)
 	if err != nil {
 		return err
 	}
-	rowsAffected, err := result.RowsAffected()
+
+	// the records it held went with it, fall back to the next best ones
+	_, err = recomputePersonalRecords(ctx, tx, userID, exercisesBefore, 0)
 	if err != nil {
 		return err
 	}
 
-	if rowsAffected == 0 {
-		return sql.ErrNoRows
-	}
-
-	return nil
+	return tx.Commit()
 }
 
-func (pg *PostgresWorkoutStore) GetWorkoutOwner(workoutID int64) (int, error) {
+func (pg *PostgresWorkoutStore) GetWorkoutOwner(ctx context.Context, workoutID int64) (int, error) {
 	var userID int
 
 	query := `SELECT user_id
 	FROM workouts
 	WHERE id = $1`
 
-	err := pg.db.QueryRow(query, workoutID).Scan(&userID)
+	err := pg.db.QueryRowContext(ctx, query, workoutID).Scan(&userID)
 	if err != nil {
 		return 0, err
 	}
 
 	return userID, nil
 }
+
+func (pg *PostgresWorkoutStore) ListWorkouts(ctx context.Context, filter WorkoutFilter) (*WorkoutPage, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	sort := filter.Sort
+	if sort == "" {
+		sort = "-performed_at"
+	}
+	desc := strings.HasPrefix(sort, "-")
+	sortCol, ok := workoutSortColumns[strings.TrimPrefix(sort, "-")]
+	if !ok {
+		return nil, ErrInvalidSort
+	}
+
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = DefaultWorkoutListLimit
+	}
+	if limit > MaxWorkoutListLimit {
+		limit = MaxWorkoutListLimit
+	}
+
+	args := []interface{}{filter.UserID}
+	conditions := []string{"w.user_id = $1"}
+	addCondition := func(format string, value interface{}) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(format, len(args)))
+	}
+
+	if filter.Title != "" {
+		escaper := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+		addCondition("w.title ILIKE '%%' || $%d || '%%'", escaper.Replace(filter.Title))
+	}
+	if filter.MinDuration != nil {
+		addCondition("w.duration_minutes >= $%d", *filter.MinDuration)
+	}
+	if filter.MaxDuration != nil {
+		addCondition("w.duration_minutes <= $%d", *filter.MaxDuration)
+	}
+	if filter.MinCalories != nil {
+		addCondition("w.calories_burned >= $%d", *filter.MinCalories)
+	}
+	if filter.MaxCalories != nil {
+		addCondition("w.calories_burned <= $%d", *filter.MaxCalories)
+	}
+	if filter.CreatedAfter != nil {
+		addCondition("w.created_at >= $%d", *filter.CreatedAfter)
+	}
+	if filter.CreatedBefore != nil {
+		addCondition("w.created_at < $%d", *filter.CreatedBefore)
+	}
+	if filter.PerformedAfter != nil {
+		addCondition("w.performed_at >= $%d", *filter.PerformedAfter)
+	}
+	if filter.PerformedBefore != nil {
+		addCondition("w.performed_at < $%d", *filter.PerformedBefore)
+	}
+
+	direction, comparison := "ASC", ">"
+	if desc {
+		direction, comparison = "DESC", "<"
+	}
+
+	if filter.Cursor != "" {
+		cursor, err := decodeWorkoutCursor(filter.Cursor, sort)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, cursor.value, cursor.ID)
+		conditions = append(conditions, fmt.Sprintf("(%s, w.id) %s ($%d::%s, $%d)",
+			sortCol.column, comparison, len(args)-1, sortCol.cast, len(args)))
+	}
+
+	args = append(args, limit+1)
+	query := fmt.Sprintf(`
+	SELECT w.id, w.user_id, w.title, w.description, w.duration_minutes, w.calories_burned, w.performed_at, w.ended_at, w.version, %s
+	FROM workouts w
+	WHERE %s
+	ORDER BY %s %s, w.id %s
+	LIMIT $%d
+	`, sortCol.cursorValue(), strings.Join(conditions, " AND "), sortCol.column, direction, direction, len(args))
+
+	rows, err := pg.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	page := &WorkoutPage{Workouts: []*Workout{}}
+	var lastSortValue string
+	for rows.Next() {
+		workout := &Workout{Entries: []WorkoutEntry{}}
+		var sortValue string
+		err = rows.Scan(
+			&workout.ID,
+			&workout.UserID,
+			&workout.Title,
+			&workout.Description,
+			&workout.DurationMinutes,
+			&workout.CaloriesBurned,
+			&workout.PerformedAt,
+			&workout.EndedAt,
+			&workout.Version,
+			&sortValue,
+		)
+		if err != nil {
+			return nil, err
+		}
+		if len(page.Workouts) == limit {
+			last := page.Workouts[len(page.Workouts)-1]
+			page.NextCursor = encodeWorkoutCursor(workoutCursor{Sort: sort, Value: lastSortValue, ID: last.ID})
+			break
+		}
+		lastSortValue = sortValue
+		page.Workouts = append(page.Workouts, workout)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	if len(page.Workouts) == 0 {
+		return page, nil
+	}
+
+	// load the entries of the whole page in one go instead of per workout
+	ids := make([]int64, 0, len(page.Workouts))
+	byID := make(map[int]*Workout, len(page.Workouts))
+	for _, workout := range page.Workouts {
+		ids = append(ids, int64(workout.ID))
+		byID[workout.ID] = workout
+	}
+
+	entryQuery := `
+	SELECT e.workout_id, e.id, e.exercise_id, e.exercise_name, e.sets, e.reps, e.duration_seconds, e.weight, e.notes, e.order_index,
+	       g.id, g.label, g.group_type, g.rounds, g.rest_between_rounds_seconds
+	FROM workout_entries e
+	LEFT JOIN workout_entry_groups g ON g.id = e.group_id
+	WHERE e.workout_id = ANY($1)
+	ORDER BY e.workout_id, e.order_index
+	`
+	entryRows, err := pg.db.QueryContext(ctx, entryQuery, ids)
+	if err != nil {
+		return nil, err
+	}
+	defer entryRows.Close()
+
+	for entryRows.Next() {
+		var workoutID int
+		var entry WorkoutEntry
+		var group nullableEntryGroup
+		err = entryRows.Scan(
+			&workoutID,
+			&entry.ID,
+			&entry.ExerciseID,
+			&entry.ExerciseName,
+			&entry.Sets,
+			&entry.Reps,
+			&entry.DurationSeconds,
+			&entry.Weight,
+			&entry.Notes,
+			&entry.OrderIndex,
+			&group.ID,
+			&group.Label,
+			&group.Type,
+			&group.Rounds,
+			&group.RestBetweenRoundsSeconds,
+		)
+		if err != nil {
+			return nil, err
+		}
+		entry.Group = group.get()
+		if workout, ok := byID[workoutID]; ok {
+			workout.Entries = append(workout.Entries, entry)
+		}
+	}
+	if err = entryRows.Err(); err != nil {
+		return nil, err
+	}
+
+	var entries []*WorkoutEntry
+	for _, workout := range page.Workouts {
+		for i := range workout.Entries {
+			entries = append(entries, &workout.Entries[i])
+		}
+	}
+	err = loadWorkoutSets(ctx, pg.db, entries)
+	if err != nil {
+		return nil, err
+	}
+
+	return page, nil
+}
@@ -1,10 +1,13 @@
 package store
 
 import (
+	"context"
 	"database/sql"
 	"testing"
+	"time"
 
 	_ "github.com/jackc/pgx/v4/stdlib"
+	"github.com/shiponcs/femProject/seeds"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -25,6 +28,12 @@ func setupTestDB(t *testing.T) *sql.DB {
 		t.Fatalf("truncating table err %v", err)
 	}
 
+	// entries can only reference exercises of the catalog
+	err = NewPostgresExerciseStore(db).SeedExercises(seeds.FS, "exercises.json")
+	if err != nil {
+		t.Fatalf("seeding exercises: %v", err)
+	}
+
 	return db
 }
 
@@ -48,7 +57,7 @@ func TestCreateWorkout(t *testing.T) {
 				CaloriesBurned:  200,
 				Entries: []WorkoutEntry{
 					{
-						ExerciseName: "bench press",
+						ExerciseName: "Bench Press",
 						Sets:         3,
 						Reps:         IntPtr(10),
 						Weight:       FloatPtr(122.2),
@@ -67,7 +76,7 @@ func TestCreateWorkout(t *testing.T) {
 				CaloriesBurned:  500,
 				Entries: []WorkoutEntry{
 					{
-						ExerciseName: "plank",
+						ExerciseName: "Plank",
 						Sets:         3,
 						Reps:         IntPtr(60),
 						Notes:        "keep form",
@@ -75,7 +84,7 @@ func TestCreateWorkout(t *testing.T) {
 					},
 					{
 
-						ExerciseName:    "squats",
+						ExerciseName:    "Squat",
 						Sets:            4,
 						Reps:            IntPtr(40),
 						DurationSeconds: IntPtr(4999),
@@ -90,14 +99,13 @@ func TestCreateWorkout(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			creaatedWorkout, err := store.CreateWorkout(tt.workout)
-			0
+			creaatedWorkout, err := store.CreateWorkout(context.Background(), tt.workout)
 			require.NoError(t, err)
 			assert.Equal(t, tt.workout.Title, creaatedWorkout.Title)
 			assert.Equal(t, tt.workout.Description, creaatedWorkout.Description)
 			assert.Equal(t, tt.workout.DurationMinutes, creaatedWorkout.DurationMinutes)
 
-			retrieved, err := store.GetWorkoutByID(int64(creaatedWorkout.ID))
+			retrieved, err := store.GetWorkoutByID(context.Background(), int64(creaatedWorkout.ID))
 			require.NoError(t, err)
 
 			for i := range retrieved.Entries {
@@ -110,6 +118,155 @@ func TestCreateWorkout(t *testing.T) {
 	}
 }
 
+func TestWorkoutEntries(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	store := NewPostgresWorkoutStore(db)
+	userID := createTestUser(t, db)
+
+	workout, err := store.CreateWorkout(context.Background(), &Workout{
+		UserID:          userID,
+		Title:           "leg day",
+		DurationMinutes: 45,
+		Entries: []WorkoutEntry{
+			{ExerciseName: "squat", Sets: 5, Reps: IntPtr(5), OrderIndex: 1},
+			{ExerciseName: "lunge", Sets: 3, Reps: IntPtr(12), OrderIndex: 2},
+		},
+	})
+	require.NoError(t, err)
+	workoutID := int64(workout.ID)
+
+	entry := &WorkoutEntry{ExerciseName: "calf raise", Sets: 3, Reps: IntPtr(15), OrderIndex: 3}
+	version, err := store.CreateWorkoutEntry(context.Background(), workoutID, 1, entry)
+	require.NoError(t, err)
+	assert.Equal(t, 2, version)
+	assert.NotZero(t, entry.ID)
+
+	_, err = store.CreateWorkoutEntry(context.Background(), workoutID, 1, &WorkoutEntry{ExerciseName: "plank", Sets: 1, Reps: IntPtr(1)})
+	assert.ErrorIs(t, err, ErrEditConflict)
+
+	entry.Sets = 4
+	version, err = store.UpdateWorkoutEntry(context.Background(), workoutID, version, entry)
+	require.NoError(t, err)
+
+	ids := []int64{int64(entry.ID), int64(workout.Entries[0].ID), int64(workout.Entries[1].ID)}
+	version, err = store.ReorderWorkoutEntries(context.Background(), workoutID, version, ids)
+	require.NoError(t, err)
+
+	_, err = store.ReorderWorkoutEntries(context.Background(), workoutID, version, ids[:2])
+	assert.ErrorIs(t, err, ErrInvalidEntryOrder)
+
+	retrieved, err := store.GetWorkoutByID(context.Background(), workoutID)
+	require.NoError(t, err)
+	require.Len(t, retrieved.Entries, 3)
+	assert.Equal(t, entry.ID, retrieved.Entries[0].ID)
+	assert.Equal(t, 4, retrieved.Entries[0].Sets)
+
+	version, err = store.DeleteWorkoutEntry(context.Background(), workoutID, int64(entry.ID), version)
+	require.NoError(t, err)
+	assert.Equal(t, 5, version)
+}
+
+func TestDecodeWorkoutCursor(t *testing.T) {
+	tests := []struct {
+		name    string
+		cursor  string
+		sort    string
+		wantErr bool
+	}{
+		{name: "timestamp", cursor: encodeWorkoutCursor(workoutCursor{Sort: "-performed_at", Value: "2025-06-02T18:00:00.123456Z", ID: 4}), sort: "-performed_at"},
+		{name: "integer", cursor: encodeWorkoutCursor(workoutCursor{Sort: "duration_minutes", Value: "45", ID: 4}), sort: "duration_minutes"},
+		{name: "text", cursor: encodeWorkoutCursor(workoutCursor{Sort: "title", Value: "leg day", ID: 4}), sort: "title"},
+		{name: "not base64", cursor: "%%%", sort: "title", wantErr: true},
+		{name: "other sort", cursor: encodeWorkoutCursor(workoutCursor{Sort: "title", Value: "leg day", ID: 4}), sort: "-title", wantErr: true},
+		{name: "tampered timestamp", cursor: encodeWorkoutCursor(workoutCursor{Sort: "-performed_at", Value: "yesterday", ID: 4}), sort: "-performed_at", wantErr: true},
+		{name: "tampered integer", cursor: encodeWorkoutCursor(workoutCursor{Sort: "duration_minutes", Value: "1 OR 1=1", ID: 4}), sort: "duration_minutes", wantErr: true},
+		{name: "integer out of range", cursor: encodeWorkoutCursor(workoutCursor{Sort: "calories_burned", Value: "99999999999", ID: 4}), sort: "calories_burned", wantErr: true},
+		{name: "nul in text", cursor: encodeWorkoutCursor(workoutCursor{Sort: "title", Value: "leg\x00day", ID: 4}), sort: "title", wantErr: true},
+		{name: "missing id", cursor: encodeWorkoutCursor(workoutCursor{Sort: "title", Value: "leg day"}), sort: "title", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cursor, err := decodeWorkoutCursor(tt.cursor, tt.sort)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidCursor)
+				return
+			}
+			require.NoError(t, err)
+			assert.NotNil(t, cursor.value)
+		})
+	}
+}
+
+func TestListWorkoutsCursor(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	ctx := context.Background()
+	store := NewPostgresWorkoutStore(db)
+	userID := createTestUser(t, db)
+
+	performedAt := time.Date(2025, 6, 2, 18, 0, 0, 123456000, time.UTC)
+	for i := 0; i < 3; i++ {
+		_, err := store.CreateWorkout(ctx, &Workout{
+			UserID:          userID,
+			Title:           "run",
+			DurationMinutes: 30,
+			PerformedAt:     performedAt.Add(time.Duration(i) * time.Microsecond),
+		})
+		require.NoError(t, err)
+	}
+
+	filter := WorkoutFilter{UserID: userID, Sort: "-performed_at", Limit: 2}
+	page, err := store.ListWorkouts(ctx, filter)
+	require.NoError(t, err)
+	require.Len(t, page.Workouts, 2)
+	require.NotEmpty(t, page.NextCursor)
+
+	filter.Cursor = page.NextCursor
+	page, err = store.ListWorkouts(ctx, filter)
+	require.NoError(t, err)
+	require.Len(t, page.Workouts, 1)
+	assert.True(t, performedAt.Equal(page.Workouts[0].PerformedAt))
+	assert.Empty(t, page.NextCursor)
+
+	filter.Cursor = encodeWorkoutCursor(workoutCursor{Sort: "-performed_at", Value: "not a time", ID: 1})
+	_, err = store.ListWorkouts(ctx, filter)
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+}
+
+func createTestUser(t *testing.T, db *sql.DB) int {
+	var id int
+	err := db.QueryRow(`
+	INSERT INTO users (username, email, password_hash)
+	VALUES ('store_test', 'store_test@example.com', 'x')
+	ON CONFLICT (username) DO UPDATE SET email = EXCLUDED.email
+	RETURNING id
+	`).Scan(&id)
+	if err != nil {
+		t.Fatalf("creating test user: %v", err)
+	}
+	return id
+}
+
+// createTestCoach upserts a second test user, 'store_test_coach', with the
+// given role.
+func createTestCoach(t *testing.T, db *sql.DB, role string) int {
+	var id int
+	err := db.QueryRow(`
+	INSERT INTO users (username, email, password_hash, role)
+	VALUES ('store_test_coach', 'store_test_coach@example.com', 'x', $1)
+	ON CONFLICT (username) DO UPDATE SET role = EXCLUDED.role
+	RETURNING id
+	`, role).Scan(&id)
+	if err != nil {
+		t.Fatalf("creating test coach: %v", err)
+	}
+	return id
+}
+
 func IntPtr(i int) *int {
 	return &i
 }
@@ -4,11 +4,18 @@ import (
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/base32"
+	"strings"
 	"time"
 )
 
 const (
-	ScopeAuth = "authentication"
+	ScopeAuth          = "authentication"
+	ScopeRefresh       = "refresh"
+	ScopePasswordReset = "password-reset"
+	ScopeActivation    = "activation"
+	// Scope2FAPending is handed out by a correct password of a user with
+	// two-factor authentication, it can only be exchanged at POST /tokens/2fa.
+	Scope2FAPending = "2fa-pending"
 )
 
 type Token struct {
@@ -17,6 +24,15 @@ type Token struct {
 	UserID    int       `json:"-"`
 	Expiry    time.Time `json:"expiry"`
 	Scope     string    `json:"-"`
+	// FamilyID links the tokens handed out by one login and all the
+	// refreshes that followed it, zero for tokens outside of a family.
+	FamilyID int64 `json:"-"`
+}
+
+// Hash returns the value stored in place of a plaintext token.
+func Hash(plaintext string) []byte {
+	hash := sha256.Sum256([]byte(plaintext))
+	return hash[:]
 }
 
 func GenerateToken(userID int, ttl time.Duration, scope string) (*Token, error) {
@@ -33,7 +49,37 @@ func GenerateToken(userID int, ttl time.Duration, scope string) (*Token, error)
 	}
 
 	token.Plaintext = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(emptyBytes)
-	hash := sha256.Sum256([]byte(token.Plaintext))
-	token.Hash = hash[:]
+	token.Hash = Hash(token.Plaintext)
 	return token, nil
 }
+
+// APIKeyPrefix starts every API key, so keys are easy to recognise in
+// configs and secret scanners and can't be mistaken for session tokens.
+const APIKeyPrefix = "wk_"
+
+type APIKey struct {
+	Plaintext string
+	// Prefix is the start of the key, stored in clear so users can tell
+	// their keys apart.
+	Prefix string
+	Hash   []byte
+}
+
+func GenerateAPIKey() (*APIKey, error) {
+	emptyBytes := make([]byte, 20)
+	_, err := rand.Read(emptyBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext := APIKeyPrefix + strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(emptyBytes))
+	return &APIKey{
+		Plaintext: plaintext,
+		Prefix:    plaintext[:len(APIKeyPrefix)+8],
+		Hash:      Hash(plaintext),
+	}, nil
+}
+
+func IsAPIKey(plaintext string) bool {
+	return strings.HasPrefix(plaintext, APIKeyPrefix)
+}
@@ -0,0 +1,53 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/shiponcs/femProject/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestMiddlewareContinuesTraceparent(t *testing.T) {
+	var out bytes.Buffer
+	shutdown, err := Setup(context.Background(), config.Tracing{Exporter: "stdout", SampleRatio: 1, ServiceName: "workouts"}, &out)
+	require.NoError(t, err)
+
+	var traceID trace.TraceID
+	r := chi.NewRouter()
+	r.Use(Middleware)
+	r.Get("/workouts/{id}", func(w http.ResponseWriter, r *http.Request) {
+		traceID = trace.SpanContextFromContext(r.Context()).TraceID()
+		_, span := otel.Tracer("test").Start(r.Context(), "SELECT")
+		span.End()
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/workouts/1", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+	require.NoError(t, shutdown(context.Background()))
+
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", traceID.String())
+	spans := out.String()
+	assert.Contains(t, spans, `"Name":"GET /workouts/{id}"`)
+	assert.Contains(t, spans, `"Name":"SELECT"`)
+	assert.Contains(t, spans, `"Value":"/workouts/{id}"`)
+	assert.Contains(t, spans, `"Code":"Error"`)
+}
+
+func TestSetupWithoutExporter(t *testing.T) {
+	shutdown, err := Setup(context.Background(), config.Tracing{Exporter: "none"}, nil)
+	require.NoError(t, err)
+	assert.NoError(t, shutdown(context.Background()))
+
+	_, err = Setup(context.Background(), config.Tracing{Exporter: "zipkin"}, nil)
+	assert.Error(t, err)
+}
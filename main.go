@@ -1,38 +1,84 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/shiponcs/femProject/internal/app"
+	"github.com/shiponcs/femProject/internal/config"
 	"github.com/shiponcs/femProject/internal/routes"
 )
 
 func main() {
-	var port int
-	flag.IntVar(&port, "port", 8080, "The backend server port")
-	flag.Parse()
+	cfg, err := config.Load(os.Args[1:], os.Getenv)
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
 
-	app, err := app.NewApplication()
+	app, err := app.NewApplication(cfg)
 	if err != nil {
 		panic(err)
 	}
-	defer app.DB.Close()
 
 	r := routes.SetupRoutes(app)
 	server := &http.Server{
-		Addr:         fmt.Sprintf(":%d", port),
+		Addr:         fmt.Sprintf(":%d", cfg.Port),
 		Handler:      r,
-		IdleTimeout:  time.Minute,
-		ReadTimeout:  10 * time.Second,
-		WriteTimeout: 30 * time.Second,
+		IdleTimeout:  cfg.HTTP.IdleTimeout,
+		ReadTimeout:  cfg.HTTP.ReadTimeout,
+		WriteTimeout: cfg.HTTP.WriteTimeout,
 	}
-	app.Logger.Println("The app is running at ", port)
 
-	err = server.ListenAndServe()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	serverErr := make(chan error, 1)
+	go func() {
+		app.Logger.Info("The app is running", "port", cfg.Port)
+		serverErr <- server.ListenAndServe()
+	}()
+
+	select {
+	case err = <-serverErr:
+		app.Logger.Error("server", "error", err)
+		app.DB.Close()
+		os.Exit(1)
+	case <-ctx.Done():
+		// a second signal kills the process right away
+		stop()
+	}
+
+	err = shutdown(app, server, cfg.HTTP)
 	if err != nil {
-		app.Logger.Fatal(err)
+		app.Logger.Error("shutdown", "error", err)
+		os.Exit(1)
 	}
+	app.Logger.Info("The app has stopped")
+}
+
+// shutdown fails the readiness check, gives load balancers the shutdown
+// delay to stop routing here, and then drains the in-flight requests and
+// the background tasks before closing the database.
+func shutdown(app *app.Application, server *http.Server, cfg config.HTTP) error {
+	app.Logger.Info("Shutting down, draining requests")
+	app.Drain()
+	time.Sleep(cfg.ShutdownDelay)
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+
+	shutdownErr := server.Shutdown(ctx)
+	closeErr := app.Close(ctx)
+	return errors.Join(shutdownErr, closeErr)
 }
@@ -0,0 +1,19 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE workouts
+ADD COLUMN performed_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+ADD COLUMN ended_at TIMESTAMP WITH TIME ZONE,
+ADD CONSTRAINT valid_workout_interval CHECK (ended_at IS NULL OR ended_at >= performed_at);
+
+UPDATE workouts SET performed_at = created_at WHERE created_at IS NOT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_workouts_user_performed_at ON workouts (user_id, performed_at, id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_workouts_user_performed_at;
+ALTER TABLE workouts DROP CONSTRAINT valid_workout_interval;
+ALTER TABLE workouts DROP COLUMN ended_at;
+ALTER TABLE workouts DROP COLUMN performed_at;
+-- +goose StatementEnd
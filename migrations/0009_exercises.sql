@@ -0,0 +1,43 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS exercises (
+  id BIGSERIAL PRIMARY KEY,
+  name VARCHAR(255) NOT NULL,
+  aliases TEXT[] NOT NULL DEFAULT '{}',
+  muscle_groups TEXT[] NOT NULL DEFAULT '{}',
+  equipment VARCHAR(100) NOT NULL DEFAULT '',
+  measurement_type VARCHAR(20) NOT NULL DEFAULT 'reps',
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+  updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+  CONSTRAINT valid_measurement_type CHECK (measurement_type IN ('reps', 'duration', 'distance'))
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_exercises_name ON exercises (lower(name));
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+-- every free-text name already logged becomes a catalog entry of its own
+INSERT INTO exercises (name, measurement_type)
+SELECT DISTINCT ON (lower(exercise_name)) exercise_name, CASE WHEN reps IS NULL THEN 'duration' ELSE 'reps' END
+FROM workout_entries
+ORDER BY lower(exercise_name), id
+ON CONFLICT DO NOTHING;
+
+ALTER TABLE workout_entries
+ADD COLUMN exercise_id BIGINT REFERENCES exercises(id) ON DELETE RESTRICT;
+
+UPDATE workout_entries e
+SET exercise_id = x.id
+FROM exercises x
+WHERE lower(x.name) = lower(e.exercise_name);
+
+ALTER TABLE workout_entries ALTER COLUMN exercise_id SET NOT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_workout_entries_exercise_id ON workout_entries (exercise_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE workout_entries DROP COLUMN exercise_id;
+DROP TABLE exercises;
+-- +goose StatementEnd
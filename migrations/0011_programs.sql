@@ -0,0 +1,50 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS programs (
+  id BIGSERIAL PRIMARY KEY,
+  user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  name VARCHAR(255) NOT NULL,
+  description TEXT NOT NULL DEFAULT '',
+  weeks INTEGER NOT NULL CHECK (weeks > 0),
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+  updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- day 1 of week 1 is the start date of an enrollment
+CREATE TABLE IF NOT EXISTS program_days (
+  id BIGSERIAL PRIMARY KEY,
+  program_id BIGINT NOT NULL REFERENCES programs(id) ON DELETE CASCADE,
+  week INTEGER NOT NULL CHECK (week > 0),
+  day INTEGER NOT NULL CHECK (day BETWEEN 1 AND 7),
+  template_id BIGINT NOT NULL REFERENCES workout_templates(id) ON DELETE RESTRICT,
+  UNIQUE (program_id, week, day)
+);
+
+CREATE TABLE IF NOT EXISTS program_enrollments (
+  id BIGSERIAL PRIMARY KEY,
+  program_id BIGINT NOT NULL REFERENCES programs(id) ON DELETE CASCADE,
+  user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  start_date DATE NOT NULL,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS program_sessions (
+  id BIGSERIAL PRIMARY KEY,
+  enrollment_id BIGINT NOT NULL REFERENCES program_enrollments(id) ON DELETE CASCADE,
+  program_day_id BIGINT NOT NULL REFERENCES program_days(id) ON DELETE CASCADE,
+  scheduled_date DATE NOT NULL,
+  workout_id BIGINT REFERENCES workouts(id) ON DELETE SET NULL,
+  completed_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS idx_program_sessions_enrollment_date ON program_sessions (enrollment_id, scheduled_date);
+CREATE INDEX IF NOT EXISTS idx_program_enrollments_user_id ON program_enrollments (user_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE program_sessions;
+DROP TABLE program_enrollments;
+DROP TABLE program_days;
+DROP TABLE programs;
+-- +goose StatementEnd
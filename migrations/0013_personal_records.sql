@@ -0,0 +1,21 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS personal_records (
+  id BIGSERIAL PRIMARY KEY,
+  user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  exercise_id BIGINT NOT NULL REFERENCES exercises(id) ON DELETE CASCADE,
+  record_type VARCHAR(30) NOT NULL,
+  -- the weight a max_reps_at_weight record was set at, 0 for the other types
+  weight DECIMAL(5, 2) NOT NULL DEFAULT 0,
+  value DECIMAL(10, 2) NOT NULL,
+  workout_id BIGINT NOT NULL REFERENCES workouts(id) ON DELETE CASCADE,
+  entry_id BIGINT NOT NULL REFERENCES workout_entries(id) ON DELETE CASCADE,
+  achieved_at TIMESTAMP WITH TIME ZONE NOT NULL,
+  UNIQUE (user_id, exercise_id, record_type, weight)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE personal_records;
+-- +goose StatementEnd
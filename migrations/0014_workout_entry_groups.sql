@@ -0,0 +1,24 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS workout_entry_groups (
+  id BIGSERIAL PRIMARY KEY,
+  workout_id BIGINT NOT NULL REFERENCES workouts(id) ON DELETE CASCADE,
+  -- client chosen name, e.g. "A", that ties the entries of a group together
+  label VARCHAR(50) NOT NULL,
+  group_type VARCHAR(20) NOT NULL,
+  rounds INTEGER NOT NULL DEFAULT 1 CHECK (rounds > 0),
+  rest_between_rounds_seconds INTEGER NOT NULL DEFAULT 0 CHECK (rest_between_rounds_seconds >= 0),
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+  UNIQUE (workout_id, label),
+  CONSTRAINT valid_group_type CHECK (group_type IN ('superset', 'circuit', 'emom', 'amrap'))
+);
+
+ALTER TABLE workout_entries
+ADD COLUMN group_id BIGINT REFERENCES workout_entry_groups(id) ON DELETE SET NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE workout_entries DROP COLUMN group_id;
+DROP TABLE workout_entry_groups;
+-- +goose StatementEnd
@@ -0,0 +1,19 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE SEQUENCE IF NOT EXISTS token_family_seq;
+
+-- every login starts a family, refreshing it hands out new tokens of the same
+-- family and marks the presented refresh token as rotated
+ALTER TABLE tokens
+ADD COLUMN family_id BIGINT,
+ADD COLUMN rotated_at TIMESTAMP(0) WITH TIME ZONE;
+
+CREATE INDEX IF NOT EXISTS tokens_family_id_idx ON tokens (family_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS tokens_family_id_idx;
+ALTER TABLE tokens DROP COLUMN rotated_at, DROP COLUMN family_id;
+DROP SEQUENCE IF EXISTS token_family_seq;
+-- +goose StatementEnd
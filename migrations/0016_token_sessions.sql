@@ -0,0 +1,30 @@
+-- +goose Up
+-- +goose StatementBegin
+-- a session is a token family, the columns describe the client that
+-- logged in and are shown when the user lists their sessions
+ALTER TABLE tokens
+ADD COLUMN created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+ADD COLUMN last_used_at TIMESTAMP(0) WITH TIME ZONE,
+ADD COLUMN user_agent TEXT NOT NULL DEFAULT '',
+ADD COLUMN ip TEXT NOT NULL DEFAULT '',
+ADD COLUMN label TEXT NOT NULL DEFAULT '';
+
+UPDATE tokens SET family_id = nextval('token_family_seq') WHERE family_id IS NULL;
+ALTER TABLE tokens ALTER COLUMN family_id SET DEFAULT nextval('token_family_seq');
+ALTER TABLE tokens ALTER COLUMN family_id SET NOT NULL;
+
+CREATE INDEX IF NOT EXISTS tokens_user_id_idx ON tokens (user_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS tokens_user_id_idx;
+ALTER TABLE tokens ALTER COLUMN family_id DROP NOT NULL;
+ALTER TABLE tokens ALTER COLUMN family_id DROP DEFAULT;
+ALTER TABLE tokens
+DROP COLUMN label,
+DROP COLUMN ip,
+DROP COLUMN user_agent,
+DROP COLUMN last_used_at,
+DROP COLUMN created_at;
+-- +goose StatementEnd
@@ -0,0 +1,12 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE users ADD COLUMN activated BOOLEAN NOT NULL DEFAULT false;
+
+-- accounts created before email verification existed stay usable
+UPDATE users SET activated = true;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE users DROP COLUMN activated;
+-- +goose StatementEnd
@@ -0,0 +1,27 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS user_two_factor (
+  user_id BIGINT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+  -- base32 TOTP secret, it has to be readable to compute codes
+  secret TEXT NOT NULL,
+  -- NULL until the user proved their authenticator works
+  confirmed_at TIMESTAMP WITH TIME ZONE,
+  -- last accepted time step, a code can't be replayed
+  last_step BIGINT NOT NULL DEFAULT 0,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS two_factor_recovery_codes (
+  id BIGSERIAL PRIMARY KEY,
+  user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  hash BYTEA NOT NULL,
+  used_at TIMESTAMP WITH TIME ZONE,
+  UNIQUE (user_id, hash)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE two_factor_recovery_codes;
+DROP TABLE user_two_factor;
+-- +goose StatementEnd
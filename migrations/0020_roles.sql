@@ -0,0 +1,33 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE users
+ADD COLUMN role VARCHAR(20) NOT NULL DEFAULT 'user' CHECK (role IN ('user', 'coach', 'admin'));
+
+-- athletes grant coaches access to their workouts
+CREATE TABLE IF NOT EXISTS coach_athletes (
+  coach_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  athlete_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (coach_id, athlete_id),
+  CHECK (coach_id <> athlete_id)
+);
+
+CREATE INDEX IF NOT EXISTS coach_athletes_athlete_id_idx ON coach_athletes (athlete_id);
+
+CREATE TABLE IF NOT EXISTS workout_comments (
+  id BIGSERIAL PRIMARY KEY,
+  workout_id BIGINT NOT NULL REFERENCES workouts(id) ON DELETE CASCADE,
+  user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  body TEXT NOT NULL,
+  created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS workout_comments_workout_id_idx ON workout_comments (workout_id, created_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE workout_comments;
+DROP TABLE coach_athletes;
+ALTER TABLE users DROP COLUMN role;
+-- +goose StatementEnd
@@ -0,0 +1,29 @@
+-- +goose Up
+-- +goose StatementBegin
+-- a relationship is an invitation until the athlete accepts it
+ALTER TABLE coach_athletes
+ADD COLUMN accepted_at TIMESTAMP WITH TIME ZONE;
+
+UPDATE coach_athletes SET accepted_at = created_at;
+
+-- templates a coach assigned to an athlete, started as a workout by the
+-- athlete
+CREATE TABLE IF NOT EXISTS coach_assignments (
+  id BIGSERIAL PRIMARY KEY,
+  coach_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  athlete_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  template_id BIGINT NOT NULL REFERENCES workout_templates(id) ON DELETE CASCADE,
+  note TEXT NOT NULL DEFAULT '',
+  due_date DATE,
+  workout_id BIGINT REFERENCES workouts(id) ON DELETE SET NULL,
+  created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS coach_assignments_athlete_id_idx ON coach_assignments (athlete_id, created_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE coach_assignments;
+ALTER TABLE coach_athletes DROP COLUMN accepted_at;
+-- +goose StatementEnd
@@ -0,0 +1,14 @@
+-- +goose Up
+-- +goose StatementBegin
+-- failed logins per username and per client IP, see auth.LoginLimiter
+CREATE TABLE IF NOT EXISTS login_failures (
+  key VARCHAR(300) PRIMARY KEY,
+  count INTEGER NOT NULL,
+  last_failure_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE login_failures;
+-- +goose StatementEnd
@@ -3,8 +3,10 @@ package utils
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 )
@@ -25,7 +27,11 @@ func WriteJSON(w http.ResponseWriter, status int, data Envelope) error {
 }
 
 func ReadParam(r *http.Request) (int64, error) {
-	idString := chi.URLParam(r, "id")
+	return ReadNamedParam(r, "id")
+}
+
+func ReadNamedParam(r *http.Request, name string) (int64, error) {
+	idString := chi.URLParam(r, name)
 	if idString == "" {
 		return 0, errors.New("invalid ID parameter")
 	}
@@ -36,3 +42,32 @@ func ReadParam(r *http.Request) (int64, error) {
 	}
 	return id, nil
 }
+
+// ReadQueryInt returns nil when the query parameter is absent.
+func ReadQueryInt(r *http.Request, key string) (*int, error) {
+	value := r.URL.Query().Get(key)
+	if value == "" {
+		return nil, nil
+	}
+
+	i, err := strconv.Atoi(value)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be an integer", key)
+	}
+	return &i, nil
+}
+
+// ReadQueryTime expects an RFC 3339 timestamp and returns nil when the
+// query parameter is absent.
+func ReadQueryTime(r *http.Request, key string) (*time.Time, error) {
+	value := r.URL.Query().Get(key)
+	if value == "" {
+		return nil, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be an RFC 3339 timestamp", key)
+	}
+	return &t, nil
+}